@@ -0,0 +1,86 @@
+package jsonquery
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"sync"
+)
+
+// arenaSlabSize is the number of nodes allocated at once by an Arena.
+const arenaSlabSize = 256
+
+// An Arena allocates the nodes of parsed documents from reusable slabs,
+// reducing allocations for parse-heavy workloads. Nodes are returned to
+// the arena by Release. An Arena may be used concurrently by multiple
+// goroutines.
+type Arena struct {
+	mu   sync.Mutex
+	free []*Node
+	slab []Node
+}
+
+// NewArena creates a new, empty Arena.
+func NewArena() *Arena {
+	return &Arena{}
+}
+
+// newNode returns a node from the arena, or from the heap if a is nil.
+func (a *Arena) newNode(typ NodeType, data string, level int) *Node {
+	if a == nil {
+		return &Node{Type: typ, Data: data, level: level}
+	}
+	a.mu.Lock()
+	var n *Node
+	if i := len(a.free) - 1; i >= 0 {
+		n = a.free[i]
+		a.free = a.free[:i]
+	} else {
+		if len(a.slab) == 0 {
+			a.slab = make([]Node, arenaSlabSize)
+		}
+		n = &a.slab[0]
+		a.slab = a.slab[1:]
+	}
+	a.mu.Unlock()
+	n.Type, n.Data, n.level = typ, data, level
+	return n
+}
+
+// Release returns root and all its descendants to the arena, so they can
+// be reused by later parses. The released tree, and any node in it, must
+// not be used afterward.
+func (a *Arena) Release(root *Node) {
+	var nodes []*Node
+	var walk func(*Node)
+	walk = func(n *Node) {
+		for c := n.FirstChild; c != nil; {
+			next := c.NextSibling
+			walk(c)
+			c = next
+		}
+		*n = Node{}
+		nodes = append(nodes, n)
+	}
+	walk(root)
+	a.mu.Lock()
+	a.free = append(a.free, nodes...)
+	a.mu.Unlock()
+}
+
+// ParseWithArena is like Parse but allocates the nodes of the document
+// from a. Call a.Release with the returned node once the document is no
+// longer used.
+func ParseWithArena(r io.Reader, a *Arena) (*Node, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var v interface{}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return nil, err
+	}
+	doc := a.newNode(DocumentNode, "", 0)
+	parseValue(v, doc, 1, a)
+	return doc, nil
+}
@@ -0,0 +1,62 @@
+package jsonquery
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseWithArena(t *testing.T) {
+	a := NewArena()
+	doc, err := ParseWithArena(strings.NewReader(testConfig), a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp, _ := parseString(testConfig)
+	if e, g := exp.String(), doc.String(); e != g {
+		t.Fatalf("expected %v but %v", e, g)
+	}
+	if e, g := "mark", FindOne(doc, "//people/*[age < 44]/name").InnerText(); e != g {
+		t.Fatalf("expected %v but %v", e, g)
+	}
+
+	a.Release(doc)
+	free := len(a.free)
+	if free == 0 {
+		t.Fatal("expected released nodes")
+	}
+	doc, err = ParseWithArena(strings.NewReader(testConfig), a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e, g := 0, len(a.free); e != g {
+		t.Fatalf("expected all %d released nodes reused but %v left", free, g)
+	}
+	if e, g := exp.String(), doc.String(); e != g {
+		t.Fatalf("expected %v but %v", e, g)
+	}
+
+	if _, err := ParseWithArena(strings.NewReader("{"), a); err == nil {
+		t.Fatal("expected error for invalid JSON")
+	}
+}
+
+func BenchmarkParse(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := parseString(testConfig); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkParseWithArena(b *testing.B) {
+	b.ReportAllocs()
+	a := NewArena()
+	for i := 0; i < b.N; i++ {
+		doc, err := ParseWithArena(strings.NewReader(testConfig), a)
+		if err != nil {
+			b.Fatal(err)
+		}
+		a.Release(doc)
+	}
+}
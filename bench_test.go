@@ -0,0 +1,137 @@
+package jsonquery
+
+import (
+	"bytes"
+	_ "embed"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+var (
+	// wideJSON is an object with 10K keys.
+	//go:embed testdata/wide.json
+	wideJSON []byte
+	// deepJSON is an object nested 1K levels deep.
+	//go:embed testdata/deep.json
+	deepJSON []byte
+	// arrayJSON is an array of 1K objects with 10 fields each.
+	//go:embed testdata/array.json
+	arrayJSON []byte
+)
+
+// largeJSON returns a document of about 1MB holding the items of
+// arrayJSON several times.
+func largeJSON() []byte {
+	items := bytes.TrimSuffix(bytes.TrimPrefix(arrayJSON, []byte(`{"items":[`)), []byte(`]}`))
+	var b bytes.Buffer
+	b.WriteString(`{"items":[`)
+	for b.Len() < 1<<20 {
+		if b.Len() > len(`{"items":[`) {
+			b.WriteByte(',')
+		}
+		b.Write(items)
+	}
+	b.WriteString(`]}`)
+	return b.Bytes()
+}
+
+func benchmarkParse(b *testing.B, data []byte) {
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := Parse(bytes.NewReader(data)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkParse10K(b *testing.B) {
+	benchmarkParse(b, wideJSON)
+}
+
+func BenchmarkParse1M(b *testing.B) {
+	benchmarkParse(b, largeJSON())
+}
+
+func BenchmarkParseDeep(b *testing.B) {
+	benchmarkParse(b, deepJSON)
+}
+
+func benchmarkQueryAll(b *testing.B, data []byte, expr string, want int) {
+	doc, err := Parse(bytes.NewReader(data))
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		nodes, err := QueryAll(doc, expr)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if len(nodes) != want {
+			b.Fatalf("expected %d nodes but %d", want, len(nodes))
+		}
+	}
+}
+
+func BenchmarkQueryAllShallow(b *testing.B) {
+	benchmarkQueryAll(b, arrayJSON, "items/*[category = 'a']/name", 255)
+}
+
+func BenchmarkQueryAllWide(b *testing.B) {
+	benchmarkQueryAll(b, wideJSON, "*[starts-with(name(), 'key09')]", 1000)
+}
+
+func BenchmarkQueryAllDeep(b *testing.B) {
+	benchmarkQueryAll(b, deepJSON, "//value", 1)
+}
+
+func BenchmarkConvertNodeToInterface(b *testing.B) {
+	doc, err := Parse(bytes.NewReader(arrayJSON))
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ConvertNodeToInterface(doc)
+	}
+}
+
+func TestBenchmarkFixtures(t *testing.T) {
+	for name, data := range map[string][]byte{"wide": wideJSON, "deep": deepJSON, "array": arrayJSON, "large": largeJSON()} {
+		doc, err := Parse(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if !strings.HasPrefix(doc.String(), "{") {
+			t.Fatalf("%s: expected an object", name)
+		}
+	}
+	if s := MustParse(string(deepJSON)).Stats(); s.MaxDepth != 1000 {
+		t.Fatalf("expected depth 1000 but %d", s.MaxDepth)
+	}
+}
+
+func BenchmarkQueryAllParallel(b *testing.B) {
+	doc, err := Parse(bytes.NewReader(largeJSON()))
+	if err != nil {
+		b.Fatal(err)
+	}
+	exp, err := Compile("//items/*[contains(name, '7') and price > 20 and tags/* = 't3']/id")
+	if err != nil {
+		b.Fatal(err)
+	}
+	for _, workers := range []int{1, 2, 4, 8} {
+		e := exp.WithParallel(workers)
+		b.Run(strconv.Itoa(workers), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := e.QueryAll(doc); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
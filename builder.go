@@ -0,0 +1,183 @@
+package jsonquery
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// A QueryBuilder builds an XPath expression step by step, such as
+//
+//	Q().Desc("people").Any().Where(Field("age").Lt(44))
+//
+// for `//people/*[age < 44]`. Names and values are quoted as needed, so
+// they may come from user input. Every method returns a new QueryBuilder,
+// so a partial query can be extended in several ways.
+type QueryBuilder struct {
+	path string
+	err  error
+}
+
+// Q returns a QueryBuilder for the root of the document.
+func Q() *QueryBuilder {
+	return &QueryBuilder{}
+}
+
+func (b *QueryBuilder) add(s string, err error) *QueryBuilder {
+	c := *b
+	c.path += s
+	if c.err == nil {
+		c.err = err
+	}
+	return &c
+}
+
+// Child adds a step to the child named name.
+func (b *QueryBuilder) Child(name string) *QueryBuilder {
+	return b.add("/"+nameTest(name), nil)
+}
+
+// Desc adds a step to the descendants named name.
+func (b *QueryBuilder) Desc(name string) *QueryBuilder {
+	return b.add("//"+nameTest(name), nil)
+}
+
+// Any adds a step to the children of any name, including array items.
+func (b *QueryBuilder) Any() *QueryBuilder {
+	return b.add("/*", nil)
+}
+
+// DescAny adds a step to the descendants of any name.
+func (b *QueryBuilder) DescAny() *QueryBuilder {
+	return b.add("//*", nil)
+}
+
+// Where keeps the nodes of the last step that satisfy c. Several
+// conditions apply one after the other.
+func (b *QueryBuilder) Where(c Cond) *QueryBuilder {
+	return b.add("["+c.expr+"]", c.err)
+}
+
+// At keeps the node of the last step at the 1-based position i among the
+// nodes found from the same parent, like `[i]`.
+func (b *QueryBuilder) At(i int) *QueryBuilder {
+	var err error
+	if i < 1 {
+		err = fmt.Errorf("invalid position %d", i)
+	}
+	return b.add("["+strconv.Itoa(i)+"]", err)
+}
+
+// String returns the XPath expression.
+func (b *QueryBuilder) String() string {
+	if b.path == "" {
+		return "/"
+	}
+	return b.path
+}
+
+// Compile compiles the XPath expression.
+// Return an error if a value of a condition cannot be used in a query.
+func (b *QueryBuilder) Compile() (*Expr, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+	return Compile(b.String())
+}
+
+// nameTest returns the XPath name test matching the name, using name()
+// if it is not a valid XPath name.
+func nameTest(name string) string {
+	valid := name != ""
+	for i, r := range name {
+		if i == 0 && !isNameStart(r) || !isNameChar(r) {
+			valid = false
+		}
+	}
+	if valid {
+		return name
+	}
+	lit, _ := xpathLiteral(name)
+	return "*[name() = " + lit + "]"
+}
+
+// A Cond is a condition of QueryBuilder.Where.
+type Cond struct {
+	expr string
+	err  error
+}
+
+// And returns a condition satisfied if c and other are.
+func (c Cond) And(other Cond) Cond {
+	return c.join("and", other)
+}
+
+// Or returns a condition satisfied if c or other is.
+func (c Cond) Or(other Cond) Cond {
+	cc := c.join("or", other)
+	cc.expr = "(" + cc.expr + ")"
+	return cc
+}
+
+func (c Cond) join(op string, other Cond) Cond {
+	if c.err == nil {
+		c.err = other.err
+	}
+	c.expr += " " + op + " " + other.expr
+	return c
+}
+
+// Not returns a condition satisfied if c is not.
+func Not(c Cond) Cond {
+	c.expr = "not(" + c.expr + ")"
+	return c
+}
+
+// A FieldRef refers to a member of the node tested by a condition.
+type FieldRef struct {
+	path string
+}
+
+// Field refers to the member reached from the node tested through names,
+// such as Field("address", "city").
+func Field(names ...string) FieldRef {
+	steps := make([]string, len(names))
+	for i, name := range names {
+		steps[i] = nameTest(name)
+	}
+	return FieldRef{strings.Join(steps, "/")}
+}
+
+func (f FieldRef) compare(op string, v interface{}) Cond {
+	lit, err := xpathLiteral(v)
+	return Cond{f.path + " " + op + " " + lit, err}
+}
+
+// Eq returns a condition satisfied if the field equals v, a string, a
+// number or a bool.
+func (f FieldRef) Eq(v interface{}) Cond { return f.compare("=", v) }
+
+// Ne returns a condition satisfied if the field exists and differs from v.
+func (f FieldRef) Ne(v interface{}) Cond { return f.compare("!=", v) }
+
+// Lt returns a condition satisfied if the field is less than v.
+func (f FieldRef) Lt(v interface{}) Cond { return f.compare("<", v) }
+
+// Le returns a condition satisfied if the field is at most v.
+func (f FieldRef) Le(v interface{}) Cond { return f.compare("<=", v) }
+
+// Gt returns a condition satisfied if the field is greater than v.
+func (f FieldRef) Gt(v interface{}) Cond { return f.compare(">", v) }
+
+// Ge returns a condition satisfied if the field is at least v.
+func (f FieldRef) Ge(v interface{}) Cond { return f.compare(">=", v) }
+
+// Exists returns a condition satisfied if the field exists.
+func (f FieldRef) Exists() Cond { return Cond{expr: f.path} }
+
+// Contains returns a condition satisfied if the text of the field
+// contains s.
+func (f FieldRef) Contains(s string) Cond {
+	lit, _ := xpathLiteral(s)
+	return Cond{expr: "contains(" + f.path + ", " + lit + ")"}
+}
@@ -0,0 +1,61 @@
+package jsonquery
+
+import "testing"
+
+func TestQueryBuilder(t *testing.T) {
+	doc, _ := parseString(testConfig)
+	for _, test := range []struct {
+		b    *QueryBuilder
+		want string
+	}{
+		{Q().Desc("name"), "//name"},
+		{Q().Desc("people").Any().Where(Field("age").Lt(44)), "//people/*[age < 44]"},
+		{Q().Desc("route-instance").Any().Where(Field("metric").Lt(44)), "//route-instance/*[metric < 44]"},
+		{Q().Desc("sites").Any().DescAny().Where(Field("area_id").Ne("0.0.0.1")), "//sites/*//*[area_id != '0.0.0.1']"},
+		{Q().Desc("people").Any().Where(Field("age").Lt(44)).Where(Field("name").Ne("joe")), "//people/*[age < 44][name != 'joe']"},
+		{Q().Child("top").Child("people").Any().At(2).Child("name"), "/top/people/*[2]/name"},
+		{Q().Desc("people").Any().Where(Field("age").Gt(40).Or(Field("name").Eq("mark")).And(Field("name").Exists())), "//people/*[(age > 40 or name = 'mark') and name]"},
+		{Q().Desc("people").Any().Where(Not(Field("name").Contains("o"))), "//people/*[not(contains(name, 'o'))]"},
+		{Q().Desc("sites").Any().Where(Field("ri1", "ospf").Exists()).DescAny().Where(Field("metric").Ge(1)), "//sites/*[ri1/ospf]//*[metric >= 1]"},
+		{Q().Desc("people").Any().Where(Field("name").Eq("O'Brien")), `//people/*[name = "O'Brien"]`},
+		{Q().Desc("odd key").Child("x"), "//*[name() = 'odd key']/x"},
+		{Q(), "/"},
+	} {
+		if g := test.b.String(); g != test.want {
+			t.Fatalf("expected %s but %s", test.want, g)
+		}
+		exp, err := test.b.Compile()
+		if err != nil {
+			t.Fatalf("%s: %v", test.want, err)
+		}
+		got, err := exp.QueryAll(doc)
+		if err != nil {
+			t.Fatalf("%s: %v", test.want, err)
+		}
+		want, err := QueryAll(doc, test.want)
+		if err != nil {
+			t.Fatalf("%s: %v", test.want, err)
+		}
+		if len(got) != len(want) {
+			t.Fatalf("%s: expected %d nodes but %d", test.want, len(want), len(got))
+		}
+		for i := range got {
+			if got[i] != want[i] {
+				t.Fatalf("%s: expected %v but %v", test.want, want[i], got[i])
+			}
+		}
+	}
+
+	doc = MustParse(`{"odd key":{"x":1}}`)
+	if n, err := Q().Desc("odd key").Child("x").Compile(); err != nil || FindOne(doc, n.String()).InnerText() != "1" {
+		t.Fatalf("expected to match a key that is not an XPath name but %v", err)
+	}
+	for _, b := range []*QueryBuilder{
+		Q().Desc("people").Any().Where(Field("age").Lt([]int{1})),
+		Q().Desc("people").At(0),
+	} {
+		if _, err := b.Compile(); err == nil {
+			t.Fatalf("expected error for %s", b)
+		}
+	}
+}
@@ -4,8 +4,6 @@ import (
 	"sync"
 
 	"github.com/golang/groupcache/lru"
-
-	"github.com/antchfx/xpath"
 )
 
 // DisableSelectorCache will disable caching for the query selector if value is true.
@@ -21,9 +19,9 @@ var (
 	cacheMutex sync.Mutex
 )
 
-func getQuery(expr string) (*xpath.Expr, error) {
+func getQuery(expr string) (*Expr, error) {
 	if DisableSelectorCache || SelectorCacheMaxEntries <= 0 {
-		return xpath.Compile(expr)
+		return Compile(expr)
 	}
 	cacheOnce.Do(func() {
 		cache = lru.New(SelectorCacheMaxEntries)
@@ -31,9 +29,9 @@ func getQuery(expr string) (*xpath.Expr, error) {
 	cacheMutex.Lock()
 	defer cacheMutex.Unlock()
 	if v, ok := cache.Get(expr); ok {
-		return v.(*xpath.Expr), nil
+		return v.(*Expr), nil
 	}
-	v, err := xpath.Compile(expr)
+	v, err := Compile(expr)
 	if err != nil {
 		return nil, err
 	}
@@ -41,3 +39,12 @@ func getQuery(expr string) (*xpath.Expr, error) {
 	return v, nil
 
 }
+
+// clearCache removes all cached selector objects.
+func clearCache() {
+	cacheMutex.Lock()
+	defer cacheMutex.Unlock()
+	if cache != nil {
+		cache.Clear()
+	}
+}
@@ -0,0 +1,140 @@
+package jsonquery
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// CanonicalJSON returns the canonical JSON encoding of n and all its child
+// nodes defined by RFC 8785 (JSON Canonicalization Scheme), for signing
+// and comparing documents: no white space, members sorted by the UTF-16
+// code units of their keys, numbers formatted as in ECMAScript, and
+// strings with only the required escapes.
+// Return an error if a number is not finite as a float64, or a string is
+// not valid UTF-8.
+func CanonicalJSON(n *Node) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := writeCanonical(&buf, n); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func writeCanonical(buf *bytes.Buffer, n *Node) error {
+	if n.Type == TextNode {
+		return writeCanonicalString(buf, n.Data)
+	}
+	switch n.ElType {
+	case MapNode:
+		members := elementChildren(n)
+		keys := make(map[*Node][]uint16, len(members))
+		for _, c := range members {
+			keys[c] = utf16.Encode([]rune(c.Data))
+		}
+		sort.SliceStable(members, func(i, j int) bool {
+			return lessUTF16(keys[members[i]], keys[members[j]])
+		})
+		buf.WriteByte('{')
+		for i, c := range members {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := writeCanonicalString(buf, c.Data); err != nil {
+				return err
+			}
+			buf.WriteByte(':')
+			if err := writeCanonical(buf, c); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+	case ArrayNode:
+		buf.WriteByte('[')
+		for i, c := range elementChildren(n) {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := writeCanonical(buf, c); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+	case NumberNode:
+		f, err := strconv.ParseFloat(n.InnerText(), 64)
+		if err != nil || math.IsInf(f, 0) || math.IsNaN(f) {
+			return fmt.Errorf("cannot canonicalize number %s", n.InnerText())
+		}
+		buf.WriteString(canonicalNumber(f))
+	case BooleanNode:
+		buf.WriteString(n.InnerText())
+	case NullNode:
+		buf.WriteString("null")
+	default:
+		return writeCanonicalString(buf, n.InnerText())
+	}
+	return nil
+}
+
+func lessUTF16(a, b []uint16) bool {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] {
+			return a[i] < b[i]
+		}
+	}
+	return len(a) < len(b)
+}
+
+// canonicalNumber formats f like Number.prototype.toString in
+// ECMAScript: the shortest digits that round trip, in exponent notation
+// below 1e-6 or from 1e21.
+func canonicalNumber(f float64) string {
+	if f == 0 {
+		return "0"
+	}
+	if abs := math.Abs(f); abs < 1e-6 || abs >= 1e21 {
+		s := strconv.FormatFloat(f, 'e', -1, 64)
+		// Remove the leading zero of a one-digit exponent: 1e-07 to 1e-7.
+		if i := len(s) - 2; s[i] == '0' && (s[i-1] == '-' || s[i-1] == '+') {
+			s = s[:i] + s[i+1:]
+		}
+		return s
+	}
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+func writeCanonicalString(buf *bytes.Buffer, s string) error {
+	if !utf8.ValidString(s) {
+		return fmt.Errorf("cannot canonicalize string %q: invalid UTF-8", s)
+	}
+	buf.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"', '\\':
+			buf.WriteByte('\\')
+			buf.WriteRune(r)
+		case '\b':
+			buf.WriteString(`\b`)
+		case '\f':
+			buf.WriteString(`\f`)
+		case '\n':
+			buf.WriteString(`\n`)
+		case '\r':
+			buf.WriteString(`\r`)
+		case '\t':
+			buf.WriteString(`\t`)
+		default:
+			if r < 0x20 {
+				fmt.Fprintf(buf, `\u%04x`, r)
+			} else {
+				buf.WriteRune(r)
+			}
+		}
+	}
+	buf.WriteByte('"')
+	return nil
+}
@@ -0,0 +1,77 @@
+package jsonquery
+
+import (
+	"math"
+	"strconv"
+	"testing"
+)
+
+func TestCanonicalJSON(t *testing.T) {
+	// The examples of RFC 8785.
+	for _, test := range []struct {
+		in, want string
+	}{
+		{
+			`{
+				"numbers": [333333333.33333329, 1E30, 4.50, 2e-3, 0.000000000000000000000000001],
+				"string": "\u20ac$\u000F\u000aA'\u0042\u0022\u005c\\\"\/",
+				"literals": [null, true, false]
+			}`,
+			`{"literals":[null,true,false],"numbers":[333333333.3333333,1e+30,4.5,0.002,1e-27],"string":"€$\u000f\nA'B\"\\\\\"/"}`,
+		},
+		{
+			`{
+				"\u20ac": "Euro Sign",
+				"\r": "Carriage Return",
+				"\ufb33": "Hebrew Letter Dalet With Dagesh",
+				"1": "One",
+				"\ud83d\ude00": "Emoji: Grinning Face",
+				"\u0080": "Control",
+				"\u00f6": "Latin Small Letter O With Diaeresis"
+			}`,
+			"{\"\\r\":\"Carriage Return\",\"1\":\"One\",\"\u0080\":\"Control\",\"ö\":\"Latin Small Letter O With Diaeresis\",\"€\":\"Euro Sign\",\"😀\":\"Emoji: Grinning Face\",\"\ufb33\":\"Hebrew Letter Dalet With Dagesh\"}",
+		},
+		{`[1, "a\b\f\t<>&\u2028", {}, []]`, "[1,\"a\\b\\f\\t<>&\u2028\",{},[]]"},
+		{`"text"`, `"text"`},
+	} {
+		doc, err := parseString(test.in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := CanonicalJSON(doc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if g := string(b); g != test.want {
+			t.Fatalf("expected %s but %s", test.want, g)
+		}
+	}
+
+	for _, test := range []struct {
+		f    float64
+		want string
+	}{
+		{0, "0"},
+		{math.Copysign(0, -1), "0"},
+		{5e-324, "5e-324"},
+		{-5e-324, "-5e-324"},
+		{1.7976931348623157e308, "1.7976931348623157e+308"},
+		{9007199254740992, "9007199254740992"},
+		{1e21, "1e+21"},
+		{999999999999999900000, "999999999999999900000"},
+		{0.000001, "0.000001"},
+		{1e-7, "1e-7"},
+		{1e23, "1e+23"},
+		{295147905179352830000, "295147905179352830000"},
+	} {
+		if g := canonicalNumber(test.f); g != test.want {
+			t.Fatalf("%v: expected %s but %s", test.f, test.want, g)
+		}
+	}
+
+	n := &Node{Type: DocumentNode, ElType: NumberNode}
+	appendChild(n, &Node{Type: TextNode, Data: strconv.FormatFloat(math.Inf(1), 'f', -1, 64)})
+	if _, err := CanonicalJSON(n); err == nil {
+		t.Fatal("expected error for an infinite number")
+	}
+}
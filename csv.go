@@ -0,0 +1,50 @@
+package jsonquery
+
+import (
+	"encoding/csv"
+	"errors"
+	"io"
+	"strconv"
+)
+
+// ParseCSV parses CSV data into a Node tree: an array with an object for
+// every record. If hasHeader is true, the first record holds the keys of
+// the objects, otherwise the keys are the column indexes "0", "1", etc.
+// Members are in column order and their values are strings. Every record
+// must have the same number of fields.
+func ParseCSV(r io.Reader, hasHeader bool) (*Node, error) {
+	cr := csv.NewReader(r)
+	var keys []string
+	if hasHeader {
+		header, err := cr.Read()
+		if err == io.EOF {
+			return nil, errors.New("missing CSV header")
+		}
+		if err != nil {
+			return nil, err
+		}
+		keys = header
+	}
+	doc := &Node{Type: DocumentNode, ElType: ArrayNode}
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		row := &Node{Type: ElementNode, ElType: MapNode}
+		appendChild(doc, row)
+		for i, field := range record {
+			key := strconv.Itoa(i)
+			if keys != nil {
+				key = keys[i]
+			}
+			n := &Node{Type: ElementNode, ElType: StringNode, Data: key}
+			appendChild(row, n)
+			appendChild(n, &Node{Type: TextNode, Data: field})
+		}
+	}
+	return doc, nil
+}
@@ -0,0 +1,52 @@
+package jsonquery
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseCSV(t *testing.T) {
+	doc, err := ParseCSV(strings.NewReader("name,age,city\njoe,45,\"Paris, FR\"\nmark,2,Oslo\n"), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e, g := `[{"age":"45","city":"Paris, FR","name":"joe"},{"age":"2","city":"Oslo","name":"mark"}]`, doc.String(); e != g {
+		t.Fatalf("expected %v but %v", e, g)
+	}
+	var keys []string
+	for _, n := range doc.FirstChild.ChildNodes() {
+		keys = append(keys, n.Data)
+	}
+	if e, g := "name,age,city", strings.Join(keys, ","); e != g {
+		t.Fatalf("expected columns %v but %v", e, g)
+	}
+	if v, err := ValueOf(doc, "//*[age > 10]/city"); err != nil || v != "Paris, FR" {
+		t.Fatalf("expected Paris, FR but %q, %v", v, err)
+	}
+	if n := FindOne(doc, "//age"); n.ElType != StringNode {
+		t.Fatalf("expected a string node but %v", n.ElType)
+	}
+
+	doc, err = ParseCSV(strings.NewReader("a,b\nc,d\n"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e, g := `[{"0":"a","1":"b"},{"0":"c","1":"d"}]`, doc.String(); e != g {
+		t.Fatalf("expected %v but %v", e, g)
+	}
+
+	doc, err = ParseCSV(strings.NewReader("a,b\n"), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e, g := `[]`, doc.String(); e != g {
+		t.Fatalf("expected %v but %v", e, g)
+	}
+
+	if _, err := ParseCSV(strings.NewReader("a,b\n1,2,3\n"), true); err == nil {
+		t.Fatal("expected error for a record with extra fields")
+	}
+	if _, err := ParseCSV(strings.NewReader(""), true); err == nil {
+		t.Fatal("expected error for a missing header")
+	}
+}
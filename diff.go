@@ -0,0 +1,111 @@
+package jsonquery
+
+import (
+	"encoding/json"
+	"io"
+	"sort"
+	"strings"
+)
+
+// DiffText writes a human-readable comparison of a and b to w, in the
+// style of diff: lines starting with "-" are only in a, lines starting
+// with "+" are only in b, and lines starting with " " are in both. Objects
+// and arrays that differ are compared member by member and item by item,
+// other values are written as compact JSON. Members are written in key
+// order, so the output is stable, as for golden files. For example:
+//
+//	 {
+//	   "age": 30
+//	-  "name": "joe"
+//	+  "name": "mark"
+//	+  "tags": ["a"]
+//	 }
+func DiffText(a, b *Node, w io.Writer) error {
+	d := &textDiff{w: w}
+	d.diff(a, b, "", 0)
+	return d.err
+}
+
+type textDiff struct {
+	w   io.Writer
+	err error
+}
+
+func (d *textDiff) line(prefix byte, depth int, s string) {
+	if d.err != nil {
+		return
+	}
+	_, d.err = io.WriteString(d.w, string(prefix)+strings.Repeat("  ", depth)+s+"\n")
+}
+
+// value writes n on a line prefixed with label.
+func (d *textDiff) value(prefix byte, depth int, label string, n *Node) {
+	d.line(prefix, depth, label+n.String())
+}
+
+func (d *textDiff) diff(a, b *Node, label string, depth int) {
+	if a.String() == b.String() {
+		d.value(' ', depth, label, a)
+		return
+	}
+	if a.ElType != b.ElType || a.ElType != MapNode && a.ElType != ArrayNode {
+		d.value('-', depth, label, a)
+		d.value('+', depth, label, b)
+		return
+	}
+	open, end := "{", "}"
+	if a.ElType == ArrayNode {
+		open, end = "[", "]"
+	}
+	d.line(' ', depth, label+open)
+	if a.ElType == ArrayNode {
+		as, bs := elementChildren(a), elementChildren(b)
+		for i := 0; i < len(as) || i < len(bs); i++ {
+			switch {
+			case i >= len(bs):
+				d.value('-', depth+1, "", as[i])
+			case i >= len(as):
+				d.value('+', depth+1, "", bs[i])
+			default:
+				d.diff(as[i], bs[i], "", depth+1)
+			}
+		}
+	} else {
+		am, bm := members(a), members(b)
+		keys := make([]string, 0, len(am)+len(bm))
+		for key := range am {
+			keys = append(keys, key)
+		}
+		for key := range bm {
+			if _, ok := am[key]; !ok {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			k, _ := json.Marshal(key)
+			label := string(k) + ": "
+			an, bn := am[key], bm[key]
+			switch {
+			case bn == nil:
+				d.value('-', depth+1, label, an)
+			case an == nil:
+				d.value('+', depth+1, label, bn)
+			default:
+				d.diff(an, bn, label, depth+1)
+			}
+		}
+	}
+	d.line(' ', depth, end)
+}
+
+// members returns the members of the object n by key.
+func members(n *Node) map[string]*Node {
+	m := make(map[string]*Node)
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == ElementNode {
+			m[c.Data] = c
+		}
+	}
+	return m
+}
@@ -0,0 +1,65 @@
+package jsonquery
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestDiffText(t *testing.T) {
+	a := MustParse(`{"name":"joe","age":30,"tags":["a","b","c"],"address":{"city":"Oslo","zip":"0150"},"admin":false,"x":{"y":1}}`)
+	b := MustParse(`{"name":"mark","age":30,"tags":["a","x"],"address":{"city":"Oslo","country":"NO"},"admin":null,"x":{"y":1},"new key":[1]}`)
+	var buf bytes.Buffer
+	if err := DiffText(a, b, &buf); err != nil {
+		t.Fatal(err)
+	}
+	e := ` {
+   "address": {
+     "city": "Oslo"
++    "country": "NO"
+-    "zip": "0150"
+   }
+-  "admin": false
++  "admin": null
+   "age": 30
+-  "name": "joe"
++  "name": "mark"
++  "new key": [1]
+   "tags": [
+     "a"
+-    "b"
++    "x"
+-    "c"
+   ]
+   "x": {"y":1}
+ }
+`
+	if g := buf.String(); g != e {
+		t.Fatalf("expected\n%s\nbut\n%s", e, g)
+	}
+
+	buf.Reset()
+	if err := DiffText(MustParse(`[1]`), MustParse(`{"a":1}`), &buf); err != nil {
+		t.Fatal(err)
+	}
+	if e, g := "-[1]\n+{\"a\":1}\n", buf.String(); e != g {
+		t.Fatalf("expected %q but %q", e, g)
+	}
+	buf.Reset()
+	if err := DiffText(a, a.Clone(), &buf); err != nil {
+		t.Fatal(err)
+	}
+	if e, g := " "+a.String()+"\n", buf.String(); e != g {
+		t.Fatalf("expected %q but %q", e, g)
+	}
+
+	if err := DiffText(a, b, failingWriter{}); err == nil {
+		t.Fatal("expected write error")
+	}
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("write failed")
+}
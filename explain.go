@@ -0,0 +1,145 @@
+package jsonquery
+
+import (
+	"fmt"
+	"strings"
+)
+
+// maxExplainCandidates is the number of candidate names reported for the
+// step of an explanation that matched nothing.
+const maxExplainCandidates = 5
+
+// An Explanation is the trace of the evaluation of a location path,
+// step by step, as returned by QueryExplain.
+type Explanation struct {
+	Expr  string
+	Steps []ExplainStep
+}
+
+// An ExplainStep is a step of an Explanation.
+type ExplainStep struct {
+	// Step is the step of the location path, such as "people" or
+	// "*[age > 40]", preceded by its separator.
+	Step string
+	// Expr is the location path up to and including Step.
+	Expr string
+	// Matched is the number of nodes matched by Expr.
+	Matched int
+	// Candidates holds the first names of the nodes that the step could
+	// have selected if it is the first step that matched nothing, such as
+	// the names of the children of the nodes matched by the previous
+	// step. Array items are reported as "*".
+	Candidates []string
+}
+
+// String formats the explanation with one line per step.
+func (e *Explanation) String() string {
+	var b strings.Builder
+	for _, s := range e.Steps {
+		fmt.Fprintf(&b, "%-20s %d matched", s.Step, s.Matched)
+		if len(s.Candidates) > 0 {
+			fmt.Fprintf(&b, ", candidates: %s", strings.Join(s.Candidates, ", "))
+		}
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+// QueryExplain evaluates the location path expr against top one step at
+// a time and reports how many nodes each step matched, to find out why a
+// query returns nothing: the first step that matched nothing carries the
+// names it could have selected, which often reveals a misspelled name.
+// An expression that is not a location path, such as a union, is a
+// single step.
+// Return an error if the expression `expr` cannot be parsed.
+func QueryExplain(top *Node, expr string) (*Explanation, error) {
+	if _, err := getQuery(expr); err != nil {
+		return nil, err
+	}
+	e := &Explanation{Expr: expr}
+	prev := []*Node{top}
+	for _, step := range splitSteps(expr) {
+		s := ExplainStep{Step: step.text, Expr: expr[:step.end]}
+		nodes, err := QueryAll(top, s.Expr)
+		if err != nil {
+			return nil, err
+		}
+		s.Matched = len(nodes)
+		if s.Matched == 0 && prev != nil {
+			s.Candidates = explainCandidates(prev, strings.HasPrefix(step.text, "//"))
+			prev = nil
+		} else if prev != nil {
+			prev = nodes
+		}
+		e.Steps = append(e.Steps, s)
+	}
+	return e, nil
+}
+
+type pathStep struct {
+	text string
+	end  int
+}
+
+// splitSteps splits a location path into its steps, each with the
+// separator that precedes it.
+func splitSteps(expr string) []pathStep {
+	var (
+		steps []pathStep
+		depth int
+		start int
+	)
+	for i := 0; i < len(expr); i++ {
+		switch c := expr[i]; c {
+		case '\'', '"':
+			if j := strings.IndexByte(expr[i+1:], c); j >= 0 {
+				i += j + 1
+			}
+		case '[', '(':
+			depth++
+		case ']', ')':
+			depth--
+		case '|':
+			if depth == 0 {
+				return []pathStep{{strings.TrimSpace(expr), len(expr)}}
+			}
+		case '/':
+			if depth != 0 || i == start || i == start+1 && expr[start] == '/' {
+				continue
+			}
+			steps = append(steps, pathStep{strings.TrimSpace(expr[start:i]), i})
+			start = i
+		}
+	}
+	return append(steps, pathStep{strings.TrimSpace(expr[start:]), len(expr)})
+}
+
+// explainCandidates returns the first distinct names of the children, or
+// descendants, of nodes.
+func explainCandidates(nodes []*Node, descendants bool) []string {
+	var names []string
+	seen := make(map[string]bool)
+	var visit func(*Node)
+	visit = func(n *Node) {
+		for c := n.FirstChild; c != nil && len(names) < maxExplainCandidates; c = c.NextSibling {
+			if c.Type != ElementNode {
+				continue
+			}
+			name := c.Data
+			if c.Parent.ElType == ArrayNode {
+				name = "*"
+			}
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+			if descendants {
+				visit(c)
+			}
+		}
+	}
+	for _, n := range nodes {
+		visit(n)
+	}
+	return names
+}
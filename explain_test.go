@@ -0,0 +1,53 @@
+package jsonquery
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestQueryExplain(t *testing.T) {
+	doc, _ := parseString(testConfig)
+	e, err := QueryExplain(doc, "/top/route-instnce/*[metric > 10]")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(e.Steps) != 3 {
+		t.Fatalf("expected 3 steps but %v", e.Steps)
+	}
+	want := []ExplainStep{
+		{Step: "/top", Expr: "/top", Matched: 1},
+		{Step: "/route-instnce", Expr: "/top/route-instnce", Candidates: []string{"inner", "people", "route-instance", "sites"}},
+		{Step: "/*[metric > 10]", Expr: "/top/route-instnce/*[metric > 10]"},
+	}
+	if !reflect.DeepEqual(e.Steps, want) {
+		t.Fatalf("expected %+v but %+v", want, e.Steps)
+	}
+	if s := e.String(); s != "/top                 1 matched\n"+
+		"/route-instnce       0 matched, candidates: inner, people, route-instance, sites\n"+
+		"/*[metric > 10]      0 matched\n" {
+		t.Fatalf("unexpected explanation:\n%s", s)
+	}
+
+	e, err = QueryExplain(doc, "//sites//ospf/area[metric = 1]")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var matched []int
+	for _, s := range e.Steps {
+		matched = append(matched, s.Matched)
+	}
+	if !reflect.DeepEqual(matched, []int{1, 3, 0}) {
+		t.Fatalf("expected matches [1 3 0] but %v", matched)
+	}
+	if c := e.Steps[2].Candidates; !reflect.DeepEqual(c, []string{"areas"}) {
+		t.Fatalf("expected candidate areas but %v", c)
+	}
+
+	e, err = QueryExplain(doc, "//people/name | //metric")
+	if err != nil || len(e.Steps) != 1 || e.Steps[0].Matched != 5 {
+		t.Fatalf("expected a single step for a union but %+v, %v", e, err)
+	}
+	if _, err := QueryExplain(doc, "//people/["); err == nil {
+		t.Fatal("expected error for invalid expression")
+	}
+}
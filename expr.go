@@ -0,0 +1,604 @@
+package jsonquery
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/antchfx/xpath"
+)
+
+// Expr is a compiled XPath expression. It may be used concurrently by
+// multiple goroutines.
+type Expr struct {
+	s    string
+	expr *xpath.Expr
+	// lookup resolves the extension functions of s, to compile it again
+	// for the types of the values of its variables.
+	lookup func(string) (Func, bool)
+	// binds holds the copies of the expression compiled for the types of
+	// the values bound to its variables.
+	binds *bindCache
+	// vars holds the values bound to the variables of the expression.
+	vars map[string]interface{}
+	// xs is s with the extension function calls rewritten, as compiled.
+	xs    string
+	calls []*funcCall
+	// call is set if the whole expression is a single extension call.
+	call *funcCall
+	// timeout limits the duration of each evaluation if positive.
+	timeout time.Duration
+	// limit is the maximum number of nodes returned by QueryAll if
+	// positive, after skipping offset nodes.
+	limit, offset int
+	// foldCase makes names match regardless of case; the name tests of
+	// the expression must be in lower case.
+	foldCase bool
+	// evalExprs holds copies of expr for Evaluate, which modifies the
+	// state of the expression unlike Select.
+	evalExprs *sync.Pool
+	// parallel is set if QueryAll splits the search among goroutines.
+	parallel *parallelPlan
+	// forExpr is set instead of expr if the expression is a for
+	// expression.
+	forExpr *forExpr
+}
+
+// ErrQueryTimeout is returned by the queries of an expression whose
+// evaluation takes longer than the timeout set with Expr.WithTimeout.
+var ErrQueryTimeout = errors.New("jsonquery: query timeout")
+
+// A QueryError is returned when an XPath expression cannot be compiled.
+type QueryError struct {
+	Expr string
+	// Offset is the byte offset in Expr where parsing failed, or -1 if
+	// it is unknown.
+	Offset int
+	// Hint describes the problem, such as "unterminated string literal".
+	Hint string
+	// Err is the error returned by the XPath compiler.
+	Err error
+}
+
+func (e *QueryError) Error() string {
+	if e.Offset < 0 {
+		return fmt.Sprintf("jsonquery: invalid expression %q: %s", e.Expr, e.Hint)
+	}
+	return fmt.Sprintf("jsonquery: invalid expression %q: %s at offset %d", e.Expr, e.Hint, e.Offset)
+}
+
+func (e *QueryError) Unwrap() error {
+	return e.Err
+}
+
+// newQueryError returns a QueryError for the compilation error err of
+// expr, locating the problem if it is a common mistake.
+func newQueryError(expr string, err error) *QueryError {
+	e := &QueryError{Expr: expr, Offset: -1, Hint: err.Error(), Err: err}
+	var open []int
+	for i := 0; i < len(expr); i++ {
+		switch c := expr[i]; c {
+		case '\'', '"':
+			j := strings.IndexByte(expr[i+1:], c)
+			if j < 0 {
+				e.Offset, e.Hint = i, "unterminated string literal"
+				return e
+			}
+			i += j + 1
+		case '[', '(':
+			open = append(open, i)
+		case ']', ')':
+			opener := byte('[')
+			if c == ')' {
+				opener = '('
+			}
+			if len(open) == 0 || expr[open[len(open)-1]] != opener {
+				e.Offset, e.Hint = i, "unexpected "+string(c)
+				return e
+			}
+			open = open[:len(open)-1]
+		}
+	}
+	if len(open) > 0 {
+		i := open[len(open)-1]
+		e.Offset, e.Hint = i, "unclosed "+string(expr[i])
+		return e
+	}
+	const unknownFunc = "not yet support this function "
+	if msg := err.Error(); strings.HasPrefix(msg, unknownFunc) {
+		name := strings.TrimSuffix(strings.TrimPrefix(msg, unknownFunc), "()")
+		e.Hint = "unknown function " + name
+		for i := 0; i < len(expr); i++ {
+			if strings.HasPrefix(expr[i:], name) && (i == 0 || !isNameChar(rune(expr[i-1]))) {
+				rest := strings.TrimLeft(expr[i+len(name):], " \t\r\n")
+				if strings.HasPrefix(rest, "(") {
+					e.Offset = i
+					break
+				}
+			}
+		}
+	}
+	return e
+}
+
+// Compile compiles an XPath expression string, resolving extension
+// functions among the functions registered with RegisterFunction.
+//
+// The expression may also be an XPath 2.0 for expression such as
+// `for $x in //item return $x/price`, which evaluates the return clause
+// with $x bound to each node selected by the in clause and collects the
+// results. $x is only visible in the return clause, where relative paths
+// are evaluated from the same node as the in clause, as in XPath 2.0.
+func Compile(expr string) (*Expr, error) {
+	e, err := compile(expr, lookupFunc, nil)
+	if err != nil {
+		return nil, newQueryError(expr, err)
+	}
+	return e, nil
+}
+
+// CompileFuncs is like Compile but resolves extension functions among
+// funcs before the functions registered with RegisterFunction, so that
+// they are only visible to the returned expression.
+func CompileFuncs(expr string, funcs map[string]Func) (*Expr, error) {
+	e, err := compile(expr, func(name string) (Func, bool) {
+		if fn, ok := funcs[name]; ok {
+			return fn, true
+		}
+		return lookupFunc(name)
+	}, nil)
+	if err != nil {
+		return nil, newQueryError(expr, err)
+	}
+	return e, nil
+}
+
+// compile compiles expr, replacing every extension function call and
+// variable reference with a reference to the attribute holding its value.
+// types holds the types of the values of the variables, as for
+// rewriteCalls.
+func compile(expr string, lookup func(string) (Func, bool), types map[string]resultType) (*Expr, error) {
+	if e, ok, err := compileFor(expr, lookup, types); ok {
+		return e, err
+	}
+	s, calls, err := rewriteCalls(expr, lookup, types)
+	if err != nil {
+		return nil, err
+	}
+	exp, err := xpath.Compile(s)
+	if err != nil {
+		return nil, err
+	}
+	e := &Expr{s: expr, xs: s, expr: exp, calls: calls, lookup: lookup, binds: &bindCache{}}
+	e.evalExprs = &sync.Pool{New: func() interface{} {
+		// s compiled successfully already.
+		x, _ := xpath.Compile(s)
+		return x
+	}}
+	if len(calls) == 1 && strings.TrimSpace(s) == calls[0].typ.ref(0) {
+		e.call = calls[0]
+	}
+	return e, nil
+}
+
+// String returns the XPath expression string.
+func (e *Expr) String() string {
+	return e.s
+}
+
+// WithTimeout returns a copy of e whose queries stop and return
+// ErrQueryTimeout once their evaluation takes longer than d, such as an
+// accidentally quadratic expression on a large document. A d <= 0 means
+// no timeout.
+func (e *Expr) WithTimeout(d time.Duration) *Expr {
+	c := *e
+	c.timeout = d
+	return &c
+}
+
+// WithLimit returns a copy of e whose QueryAll and QueryAllVars return at
+// most n nodes, stopping the search as soon as they are found. A n <= 0
+// means no limit.
+//
+// The nodes are counted in the order the expression finds them, which is
+// document order except for expressions such as unions whose operands
+// are searched one after the other, so `//b | //a` finds every b before
+// any a. The nodes returned are still sorted in document order.
+func (e *Expr) WithLimit(n int) *Expr {
+	c := *e
+	c.limit = n
+	return &c
+}
+
+// WithOffset returns a copy of e whose QueryAll and QueryAllVars skip the
+// first n nodes found, in the order described by WithLimit, for paging
+// through results with WithLimit.
+func (e *Expr) WithOffset(n int) *Expr {
+	c := *e
+	c.offset = n
+	return &c
+}
+
+// QueryAll searches the Node that matches the expression. Nodes are
+// returned in document order without duplicates.
+func (e *Expr) QueryAll(top *Node) ([]*Node, error) {
+	return e.QueryAllVars(top, nil)
+}
+
+// QueryAllVars is like QueryAll but binds the variables referenced by the
+// expression to the values in vars.
+func (e *Expr) QueryAllVars(top *Node, vars map[string]interface{}) (nodes []*Node, err error) {
+	b, err := e.bind(vars)
+	if err != nil {
+		return nil, err
+	}
+	if b.parallel != nil {
+		if nodes, ok, err := b.queryAllParallel(top); ok {
+			return nodes, err
+		}
+	}
+	t := b.selectFrom(b.navigator(top))
+	defer recoverFuncError(&err)
+	seen := make(map[*Node]bool)
+	skip := e.offset
+	for t.MoveNext() {
+		n := t.Current().(*NodeNavigator).node()
+		if seen[n] {
+			continue
+		}
+		seen[n] = true
+		if skip > 0 {
+			skip--
+			continue
+		}
+		nodes = append(nodes, n)
+		if len(nodes) == e.limit {
+			break
+		}
+	}
+	return sortDocumentOrder(nodes), nil
+}
+
+// next returns the next node of t that is not in seen and adds it to seen,
+// or nil at the end of t. It returns an extension function error raised
+// while searching instead of panicking.
+func (e *Expr) next(t nodeIterator, seen map[*Node]bool) (n *Node, err error) {
+	defer recoverFuncError(&err)
+	for t.MoveNext() {
+		n := t.Current().(*NodeNavigator).node()
+		if !seen[n] {
+			seen[n] = true
+			return n, nil
+		}
+	}
+	return nil, nil
+}
+
+// Query searches the Node that matches the expression, and returns first
+// element of matched.
+func (e *Expr) Query(top *Node) (node *Node, err error) {
+	t, err := e.selectVars(top, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer recoverFuncError(&err)
+	if t.MoveNext() {
+		return t.Current().(*NodeNavigator).node(), nil
+	}
+	return nil, nil
+}
+
+// Evaluate evaluates the expression against top and returns the result,
+// which is one of float64, string, bool or []*Node. A for expression
+// returns the nodes of all the results of its return clause in a []*Node
+// if they are node-sets, or else the results in a []interface{}.
+func (e *Expr) Evaluate(top *Node) (v interface{}, err error) {
+	b, err := e.bind(nil)
+	if err != nil {
+		return nil, err
+	}
+	defer recoverFuncError(&err)
+	return b.evaluate(b.navigator(top)), nil
+}
+
+// selectVars binds vars and returns an iterator over the matched nodes.
+// The caller must recover extension function errors raised while
+// iterating.
+func (e *Expr) selectVars(top *Node, vars map[string]interface{}) (nodeIterator, error) {
+	b, err := e.bind(vars)
+	if err != nil {
+		return nil, err
+	}
+	return b.selectFrom(b.navigator(top)), nil
+}
+
+// nodeIterator iterates over the nodes selected by an expression, like
+// xpath.NodeIterator.
+type nodeIterator interface {
+	MoveNext() bool
+	Current() xpath.NodeNavigator
+}
+
+// selectFrom returns an iterator over the nodes selected from the current
+// node of nav, whose extension calls must be those of e.
+func (e *Expr) selectFrom(nav *NodeNavigator) nodeIterator {
+	if e.forExpr != nil {
+		return e.forExpr.selectFrom(nav)
+	}
+	return e.expr.Select(nav)
+}
+
+func (e *Expr) navigator(top *Node) *NodeNavigator {
+	nav := &NodeNavigator{cur: top, root: top, ext: e, vars: e.vars, foldCase: e.foldCase}
+	if e.timeout > 0 {
+		nav.deadline = &deadline{t: time.Now().Add(e.timeout)}
+	}
+	return nav
+}
+
+// deadline stops the evaluation of an expression once its time is up.
+// It is shared by the copies of a navigator.
+type deadline struct {
+	t     time.Time
+	moves int
+}
+
+// deadlineCheckInterval is the number of navigator moves between two
+// checks of the deadline.
+const deadlineCheckInterval = 256
+
+// check raises ErrQueryTimeout as an extension function error if the
+// deadline has passed. It only reads the clock periodically.
+func (d *deadline) check() {
+	if d == nil {
+		return
+	}
+	d.moves++
+	if d.moves%deadlineCheckInterval == 0 && time.Now().After(d.t) {
+		panic(&funcError{ErrQueryTimeout})
+	}
+}
+
+// bind returns a copy of e with the variables it references bound to
+// their values in vars, or e itself if it references none. The values are
+// not part of the expression: the navigator looks them up as it evaluates
+// the expression. Only their types are, so that they keep their XPath
+// types, and e is compiled again once for each combination of the types
+// of the values bound to it.
+// Return an error if a variable is missing from vars or its value has an
+// unsupported type.
+func (e *Expr) bind(vars map[string]interface{}) (*Expr, error) {
+	values := make(map[string]interface{})
+	var walk func(*Expr, map[string]bool) error
+	walk = func(e *Expr, scope map[string]bool) error {
+		if f := e.forExpr; f != nil {
+			if err := walk(f.in, scope); err != nil {
+				return err
+			}
+			return walk(f.body, withName(scope, f.name))
+		}
+		for _, call := range e.calls {
+			if !call.variable {
+				for _, arg := range call.args {
+					if err := walk(arg, scope); err != nil {
+						return err
+					}
+				}
+				continue
+			}
+			if scope[call.name] {
+				continue
+			}
+			v, ok := vars[call.name]
+			if !ok {
+				return fmt.Errorf("undeclared variable in XPath expression: $%s", call.name)
+			}
+			x, err := xpathValue(v)
+			if err != nil {
+				return fmt.Errorf("variable $%s: %v", call.name, err)
+			}
+			values[call.name] = x
+		}
+		return nil
+	}
+	if err := walk(e, nil); err != nil {
+		return nil, err
+	}
+	if len(values) == 0 {
+		return e, nil
+	}
+	types := make(map[string]resultType, len(values))
+	for name, v := range values {
+		types[name] = valueResultType(v)
+	}
+	b, err := e.binds.get(types, func() (*Expr, error) {
+		return compile(e.s, e.lookup, types)
+	})
+	if err != nil {
+		return nil, err
+	}
+	c := *b
+	c.vars = values
+	c.timeout, c.limit, c.offset, c.foldCase = e.timeout, e.limit, e.offset, e.foldCase
+	if e.parallel != nil {
+		c.parallel = newParallelPlan(c.xs, e.parallel.workers)
+	}
+	return &c, nil
+}
+
+// withName returns a copy of scope with name.
+func withName(scope map[string]bool, name string) map[string]bool {
+	c := map[string]bool{name: true}
+	for n := range scope {
+		c[n] = true
+	}
+	return c
+}
+
+// bindCache holds the copies of an expression compiled for the types of
+// the values of its variables, by types.
+type bindCache struct {
+	mu    sync.Mutex
+	exprs map[string]*Expr
+}
+
+// get returns the copy of the expression for types, calling compile to
+// compile it if it is not in the cache.
+func (c *bindCache) get(types map[string]resultType, compile func() (*Expr, error)) (*Expr, error) {
+	names := make([]string, 0, len(types))
+	for name := range types {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var key strings.Builder
+	for _, name := range names {
+		fmt.Fprintf(&key, "%s=%d;", name, types[name])
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.exprs[key.String()]; ok {
+		return e, nil
+	}
+	e, err := compile()
+	if err != nil {
+		return nil, err
+	}
+	if c.exprs == nil {
+		c.exprs = make(map[string]*Expr)
+	}
+	c.exprs[key.String()] = e
+	return e, nil
+}
+
+// BuildQuery returns template with each {} placeholder replaced by the
+// XPath literal of the next argument, so that `//people/*[name = {}]`
+// with "O'Brien" gives `//people/*[name = "O'Brien"]`. A string becomes a
+// quoted string literal, using concat() if it contains both quote
+// characters, a number a numeric literal and a bool the string 'true' or
+// 'false', which is the text of JSON booleans.
+// Variables bound with QueryAllVars avoid building queries altogether.
+// Return an error if the number of placeholders and arguments differ or
+// an argument has another type.
+func BuildQuery(template string, args ...interface{}) (string, error) {
+	var buf strings.Builder
+	n := 0
+	for {
+		i := strings.Index(template, "{}")
+		if i < 0 {
+			break
+		}
+		if n == len(args) {
+			return "", fmt.Errorf("missing argument for placeholder %d", n+1)
+		}
+		lit, err := xpathLiteral(args[n])
+		if err != nil {
+			return "", fmt.Errorf("argument %d: %v", n+1, err)
+		}
+		buf.WriteString(template[:i])
+		buf.WriteString(lit)
+		template = template[i+2:]
+		n++
+	}
+	if n != len(args) {
+		return "", fmt.Errorf("%d arguments for %d placeholders", len(args), n)
+	}
+	buf.WriteString(template)
+	return buf.String(), nil
+}
+
+// xpathLiteral returns the XPath expression of the value v.
+func xpathLiteral(v interface{}) (string, error) {
+	x, err := xpathValue(v)
+	if err != nil {
+		return "", err
+	}
+	switch x := x.(type) {
+	case bool:
+		// A node-set compared to a boolean is converted to a boolean,
+		// so match the text of JSON booleans instead.
+		return "'" + strconv.FormatBool(x) + "'", nil
+	case float64:
+		if math.IsNaN(x) || math.IsInf(x, 0) {
+			return "", fmt.Errorf("unsupported number %v", x)
+		}
+		return strconv.FormatFloat(x, 'f', -1, 64), nil
+	}
+	s := x.(string)
+	switch {
+	case !strings.Contains(s, "'"):
+		return "'" + s + "'", nil
+	case !strings.Contains(s, `"`):
+		return `"` + s + `"`, nil
+	}
+	// Quote the parts of s between apostrophes with apostrophes and the
+	// apostrophes with quotation marks.
+	var parts []string
+	for i, part := range strings.Split(s, "'") {
+		if i > 0 {
+			parts = append(parts, `"'"`)
+		}
+		if part != "" {
+			parts = append(parts, "'"+part+"'")
+		}
+	}
+	return "concat(" + strings.Join(parts, ", ") + ")", nil
+}
+
+// xpathValue converts v to a number, string or boolean.
+func xpathValue(v interface{}) (interface{}, error) {
+	switch v := v.(type) {
+	case string, bool, float64:
+		return v, nil
+	case float32:
+		return float64(v), nil
+	case int:
+		return float64(v), nil
+	case int8:
+		return float64(v), nil
+	case int16:
+		return float64(v), nil
+	case int32:
+		return float64(v), nil
+	case int64:
+		return float64(v), nil
+	case uint:
+		return float64(v), nil
+	case uint8:
+		return float64(v), nil
+	case uint16:
+		return float64(v), nil
+	case uint32:
+		return float64(v), nil
+	case uint64:
+		return float64(v), nil
+	}
+	return nil, fmt.Errorf("unsupported type %T", v)
+}
+
+// evaluate returns the value of the expression as a float64, string,
+// bool or []*Node, or a []interface{} for a for expression.
+func (e *Expr) evaluate(nav *NodeNavigator) interface{} {
+	if e.forExpr != nil {
+		return e.forExpr.evaluate(nav)
+	}
+	if e.call != nil {
+		return e.call.evaluate(nav)
+	}
+	x := e.evalExprs.Get().(*xpath.Expr)
+	defer e.evalExprs.Put(x)
+	switch v := x.Evaluate(nav).(type) {
+	case *xpath.NodeIterator:
+		var nodes []*Node
+		for v.MoveNext() {
+			nodes = append(nodes, v.Current().(*NodeNavigator).node())
+		}
+		return nodes
+	default:
+		return v
+	}
+}
@@ -0,0 +1,178 @@
+package jsonquery
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/antchfx/xpath"
+)
+
+// forExpr is an XPath 2.0 for expression, `for $name in in return body`,
+// whose body is evaluated with $name bound to each node selected by in.
+type forExpr struct {
+	name     string
+	in, body *Expr
+}
+
+// compileFor compiles expr if it is a for expression, reporting false
+// otherwise.
+func compileFor(expr string, lookup func(string) (Func, bool), types map[string]resultType) (*Expr, bool, error) {
+	name, in, ret, ok := splitFor(expr)
+	if !ok {
+		return nil, false, nil
+	}
+	inExpr, err := compile(in, lookup, types)
+	if err != nil {
+		return nil, true, err
+	}
+	// The variable hides any bound variable of the same name.
+	bodyTypes := make(map[string]resultType, len(types))
+	for n, typ := range types {
+		if n != name {
+			bodyTypes[n] = typ
+		}
+	}
+	bodyExpr, err := compile(ret, lookup, bodyTypes)
+	if err != nil {
+		return nil, true, err
+	}
+	f := &forExpr{name: name, in: inExpr, body: bodyExpr}
+	return &Expr{s: expr, forExpr: f, lookup: lookup, binds: &bindCache{}}, true, nil
+}
+
+// splitFor splits the for expression expr into the name of its variable,
+// its in clause and its return clause.
+func splitFor(expr string) (name, in, ret string, ok bool) {
+	s := strings.TrimSpace(expr)
+	if !strings.HasPrefix(s, "for") || len(s) == 3 || !unicode.IsSpace(rune(s[3])) {
+		return "", "", "", false
+	}
+	s = strings.TrimLeft(s[3:], " \t\r\n")
+	if !strings.HasPrefix(s, "$") {
+		return "", "", "", false
+	}
+	j := 1
+	for j < len(s) && isNameChar(rune(s[j])) && (j > 1 || isNameStart(rune(s[j]))) {
+		j++
+	}
+	name, s = s[1:j], strings.TrimLeft(s[j:], " \t\r\n")
+	if name == "" || !strings.HasPrefix(s, "in") || len(s) == 2 || !unicode.IsSpace(rune(s[2])) {
+		return "", "", "", false
+	}
+	s = s[2:]
+	i := indexReturn(s)
+	if i < 0 {
+		return "", "", "", false
+	}
+	in, ret = strings.TrimSpace(s[:i]), strings.TrimSpace(s[i+len("return"):])
+	return name, in, ret, in != "" && ret != ""
+}
+
+// indexReturn returns the index of the first return keyword of s outside
+// literals, brackets and parentheses, or -1.
+func indexReturn(s string) int {
+	var (
+		quote byte
+		depth int
+	)
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '[' || c == '(':
+			depth++
+		case c == ']' || c == ')':
+			depth--
+		case depth == 0 && i > 0 && unicode.IsSpace(rune(s[i-1])) && strings.HasPrefix(s[i:], "return"):
+			if end := i + len("return"); end == len(s) || !isNameChar(rune(s[end])) {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// selectFrom returns an iterator over the distinct nodes selected by the
+// body for each node selected by the in clause, in that order.
+func (f *forExpr) selectFrom(nav *NodeNavigator) nodeIterator {
+	return &forIterator{
+		f:    f,
+		nav:  nav,
+		in:   f.in.selectFrom(nav.at(f.in, nav.cur)),
+		seen: make(map[*Node]bool),
+	}
+}
+
+// evaluate returns the values of the body for each node selected by the
+// in clause: the nodes of all the values in a []*Node if they are all
+// node-sets, or else the values in a []interface{}.
+func (f *forExpr) evaluate(nav *NodeNavigator) interface{} {
+	var (
+		nodes  []*Node
+		values []interface{}
+		atomic bool
+	)
+	t := f.in.selectFrom(nav.at(f.in, nav.cur))
+	for t.MoveNext() {
+		v := f.body.evaluate(f.iteration(nav, t.Current().(*NodeNavigator).node()))
+		if ns, ok := v.([]*Node); ok {
+			nodes = append(nodes, ns...)
+		} else {
+			atomic = true
+		}
+		values = append(values, v)
+	}
+	if atomic {
+		return values
+	}
+	return nodes
+}
+
+// iteration returns a navigator for the body at the context node of nav,
+// with $name bound to n.
+func (f *forExpr) iteration(nav *NodeNavigator, n *Node) *NodeNavigator {
+	vars := make(map[string]interface{}, len(nav.vars)+1)
+	for name, v := range nav.vars {
+		vars[name] = v
+	}
+	vars[f.name] = []*Node{n}
+	c := nav.at(f.body, nav.cur)
+	c.vars = vars
+	return c
+}
+
+type forIterator struct {
+	f        *forExpr
+	nav      *NodeNavigator
+	in, body nodeIterator
+	seen     map[*Node]bool
+	cur      xpath.NodeNavigator
+}
+
+func (t *forIterator) MoveNext() bool {
+	for {
+		if t.body != nil && t.body.MoveNext() {
+			c := t.body.Current()
+			if n := c.(*NodeNavigator).node(); !t.seen[n] {
+				t.seen[n] = true
+				t.cur = c
+				return true
+			}
+			continue
+		}
+		if !t.in.MoveNext() {
+			return false
+		}
+		n := t.in.Current().(*NodeNavigator).node()
+		t.body = t.f.body.selectFrom(t.f.iteration(t.nav, n))
+	}
+}
+
+func (t *forIterator) Current() xpath.NodeNavigator {
+	return t.cur
+}
@@ -0,0 +1,612 @@
+package jsonquery
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// A Func is an extension function that can be called from an XPath
+// expression. Each argument is one of float64, string, bool or []*Node
+// (for node-set arguments). The result must be one of float64, string,
+// bool, nil or []*Node; a node-set result has the value of its first node.
+//
+// The xpath package has no notion of extension functions, so each call
+// is exposed to the expression as an attribute of the context node whose
+// value is the result of the call. A false or nil result is exposed as a
+// missing attribute, which makes `[f(...)]` and `not(f(...))` behave as
+// boolean tests, while any other result is true in a boolean context,
+// even 0 or an empty string. The built-in functions that return numbers,
+// such as min(), are numbers to the expression instead. The attribute
+// steps of the expression, such as `@*`, never select these attributes.
+type Func func(args ...interface{}) (interface{}, error)
+
+var (
+	funcs      = map[string]Func{}
+	funcsMutex sync.RWMutex
+)
+
+func init() {
+	funcs["min"] = minFunc
+	funcs["max"] = maxFunc
+	funcs["avg"] = avgFunc
+	funcs["base64-decode"] = base64DecodeFunc
+	funcs["url-decode"] = urlDecodeFunc
+	funcs["date"] = dateFunc
+}
+
+// RegisterFunction registers fn as the extension function name for all
+// expressions, replacing any function previously registered with that
+// name. It panics if name is not a valid XPath name or fn is nil.
+func RegisterFunction(name string, fn Func) {
+	if fn == nil {
+		panic("jsonquery: RegisterFunction with nil function")
+	}
+	for i, r := range name {
+		if i == 0 && !isNameStart(r) || !isNameChar(r) {
+			panic("jsonquery: invalid function name " + name)
+		}
+	}
+	if name == "" {
+		panic("jsonquery: invalid function name " + name)
+	}
+	funcsMutex.Lock()
+	funcs[name] = fn
+	funcsMutex.Unlock()
+	// Cached expressions hold the functions they were compiled with.
+	clearCache()
+}
+
+func lookupFunc(name string) (Func, bool) {
+	funcsMutex.RLock()
+	defer funcsMutex.RUnlock()
+	fn, ok := funcs[name]
+	return fn, ok
+}
+
+// funcCall is an extension function call or a variable reference found
+// in an expression.
+type funcCall struct {
+	name     string
+	fn       Func
+	args     []*Expr
+	variable bool
+	// rootFn is set instead of fn for the built-in functions that need
+	// the root of the navigator.
+	rootFn rootFunc
+	// typ is the type of the result in the expression.
+	typ resultType
+}
+
+// A resultType is the XPath type an expression gives to the result of an
+// extension call.
+type resultType int
+
+const (
+	// attrResult is an attribute, so the result is a node-set.
+	attrResult resultType = iota
+	// nodeSetResult is the node-set of the result.
+	nodeSetResult
+	// numberResult is the number of the result, NaN if it is nil.
+	numberResult
+	// stringResult is the string of the result.
+	stringResult
+	// booleanResult is true if the result is true.
+	booleanResult
+)
+
+// ref returns the reference to the i-th call of an expression whose
+// result has type t.
+func (t resultType) ref(i int) string {
+	attr := "@" + funcAttrName(i)
+	switch t {
+	case nodeSetResult:
+		// The parent of the attribute of a node-set is its first node.
+		return "(" + attr + "/..)"
+	case numberResult:
+		return "number(" + attr + ")"
+	case stringResult:
+		return "string(" + attr + ")"
+	case booleanResult:
+		return "boolean(" + attr + ")"
+	}
+	return attr
+}
+
+// valueResultType returns the type of v, which is one of float64, string
+// or bool.
+func valueResultType(v interface{}) resultType {
+	switch v.(type) {
+	case float64:
+		return numberResult
+	case string:
+		return stringResult
+	case bool:
+		return booleanResult
+	}
+	return attrResult
+}
+
+// numberFuncs are the built-in extension functions whose results are
+// numbers or nil.
+var numberFuncs = []Func{minFunc, maxFunc, avgFunc, sumFunc, dateFunc}
+
+// funcResultType returns the type of the results of fn.
+func funcResultType(fn Func) resultType {
+	p := reflect.ValueOf(fn).Pointer()
+	for _, f := range numberFuncs {
+		if reflect.ValueOf(f).Pointer() == p {
+			return numberResult
+		}
+	}
+	return attrResult
+}
+
+// rootFunc is a built-in extension function called with the root of the
+// node tree being queried. Its result is a node-set, which the expression
+// can navigate as in `pointer('/a')/b`, like the variable of a for
+// expression.
+type rootFunc func(root *Node, args ...interface{}) (interface{}, error)
+
+var rootFuncs = map[string]rootFunc{
+	"pointer": pointerFunc,
+}
+
+// funcAliases maps the names of the functions that are alternative names
+// for XPath functions, unless registered with RegisterFunction, to the
+// names of these functions.
+var funcAliases = map[string]string{
+	// key() is the name of an object member.
+	"key": "name",
+}
+
+// funcError carries an error returned by an extension function out of
+// the xpath evaluator.
+type funcError struct {
+	err error
+}
+
+func funcAttrName(i int) string {
+	return "jsonquery-fn-" + strconv.Itoa(i)
+}
+
+func isNameStart(r rune) bool {
+	return unicode.IsLetter(r) || r == '_'
+}
+
+func isNameChar(r rune) bool {
+	return isNameStart(r) || unicode.IsDigit(r) || r == '-' || r == '.'
+}
+
+// rewriteCalls replaces the extension function calls and variable
+// references of expr with references to the attributes holding their
+// values. types holds the types of the values of the variables, which
+// are node-sets if missing, as for the variables of for expressions.
+func rewriteCalls(expr string, lookup func(string) (Func, bool), types map[string]resultType) (string, []*funcCall, error) {
+	var (
+		buf   strings.Builder
+		calls []*funcCall
+		rs    = []rune(expr)
+		prev  rune
+	)
+	for i := 0; i < len(rs); {
+		r := rs[i]
+		switch {
+		case r == '\'' || r == '"':
+			j := i + 1
+			for j < len(rs) && rs[j] != r {
+				j++
+			}
+			if j == len(rs) {
+				return "", nil, fmt.Errorf("unterminated string literal in %s", expr)
+			}
+			buf.WriteString(string(rs[i : j+1]))
+			i = j + 1
+		case r == '$' && i+1 < len(rs) && isNameStart(rs[i+1]):
+			j := i + 1
+			for j < len(rs) && isNameChar(rs[j]) {
+				j++
+			}
+			name := string(rs[i+1 : j])
+			typ, ok := types[name]
+			if !ok {
+				typ = nodeSetResult
+			}
+			buf.WriteString(typ.ref(len(calls)))
+			calls = append(calls, &funcCall{name: name, variable: true, typ: typ})
+			i = j
+		case r == '@':
+			// JSON nodes have no attributes, and the attributes holding
+			// the results of the calls are not for the expression to see.
+			buf.WriteString(noAttributes)
+			i = nameTestEnd(rs, i+1)
+		case isNameStart(r) && prev != ':' && axisEnd(rs, i, "attribute") > 0:
+			buf.WriteString(noAttributes)
+			i = nameTestEnd(rs, axisEnd(rs, i, "attribute"))
+		case isNameStart(r) && prev != '@' && prev != ':':
+			j := i
+			for j < len(rs) && isNameChar(rs[j]) {
+				j++
+			}
+			name := string(rs[i:j])
+			k := j
+			for k < len(rs) && unicode.IsSpace(rs[k]) {
+				k++
+			}
+			fn, ok := lookup(name)
+			rootFn, isRootFunc := rootFuncs[name]
+			if !ok && !isRootFunc || k == len(rs) || rs[k] != '(' {
+				if alias, isAlias := funcAliases[name]; isAlias && !ok && k < len(rs) && rs[k] == '(' {
+					name = alias
+				}
+				buf.WriteString(name)
+				i = j
+				break
+			}
+			args, end, err := splitArgs(rs, k)
+			if err != nil {
+				return "", nil, fmt.Errorf("%s in %s", err, expr)
+			}
+			call := &funcCall{name: name, fn: fn, typ: funcResultType(fn)}
+			if !ok {
+				call.rootFn, call.typ = rootFn, nodeSetResult
+			}
+			for _, arg := range args {
+				c, err := compile(arg, lookup, types)
+				if err != nil {
+					return "", nil, err
+				}
+				call.args = append(call.args, c)
+			}
+			buf.WriteString(call.typ.ref(len(calls)))
+			calls = append(calls, call)
+			i = end + 1
+		default:
+			buf.WriteRune(r)
+			i++
+		}
+		if !unicode.IsSpace(rs[i-1]) {
+			prev = rs[i-1]
+		}
+	}
+	return buf.String(), calls, nil
+}
+
+// noAttributes replaces the attribute steps of an expression, selecting
+// nothing.
+const noAttributes = "self::node()[false()]"
+
+// axisEnd returns the position after the axis name and "::" starting at
+// rs[i], or -1 if rs[i:] does not start with them.
+func axisEnd(rs []rune, i int, name string) int {
+	j := i + len(name)
+	if j > len(rs) || string(rs[i:j]) != name {
+		return -1
+	}
+	for j < len(rs) && unicode.IsSpace(rs[j]) {
+		j++
+	}
+	if j+1 >= len(rs) || rs[j] != ':' || rs[j+1] != ':' {
+		return -1
+	}
+	return j + 2
+}
+
+// nameTestEnd returns the position after the name test or node type test
+// starting at rs[i], after any space.
+func nameTestEnd(rs []rune, i int) int {
+	for i < len(rs) && unicode.IsSpace(rs[i]) {
+		i++
+	}
+	if i < len(rs) && rs[i] == '*' {
+		return i + 1
+	}
+	for i < len(rs) && (isNameChar(rs[i]) || rs[i] == ':' && i+1 < len(rs) && (isNameStart(rs[i+1]) || rs[i+1] == '*')) {
+		if rs[i] == ':' && rs[i+1] == '*' {
+			return i + 2
+		}
+		i++
+	}
+	j := i
+	for j < len(rs) && unicode.IsSpace(rs[j]) {
+		j++
+	}
+	if j+1 < len(rs) && rs[j] == '(' && rs[j+1] == ')' {
+		return j + 2
+	}
+	return i
+}
+
+// splitArgs splits the arguments of the call whose opening parenthesis is
+// at rs[open], and returns the position of the closing parenthesis.
+func splitArgs(rs []rune, open int) ([]string, int, error) {
+	var (
+		args  []string
+		depth int
+		start = open + 1
+	)
+	for i := open + 1; i < len(rs); i++ {
+		switch r := rs[i]; r {
+		case '\'', '"':
+			for i++; i < len(rs) && rs[i] != r; i++ {
+			}
+		case '(', '[':
+			depth++
+		case ')', ']':
+			if depth > 0 {
+				depth--
+				break
+			}
+			if r == ']' {
+				return nil, 0, fmt.Errorf("unexpected ] at %d", i)
+			}
+			if arg := strings.TrimSpace(string(rs[start:i])); arg != "" || len(args) > 0 {
+				args = append(args, arg)
+			}
+			return args, i, nil
+		case ',':
+			if depth == 0 {
+				args = append(args, strings.TrimSpace(string(rs[start:i])))
+				start = i + 1
+			}
+		}
+	}
+	return nil, 0, fmt.Errorf("missing ) after argument list")
+}
+
+// evaluate calls the extension function with its arguments evaluated
+// against the current node of nav.
+func (f *funcCall) evaluate(nav *NodeNavigator) interface{} {
+	if f.variable {
+		return nav.vars[f.name]
+	}
+	args := make([]interface{}, len(f.args))
+	for i, arg := range f.args {
+		args[i] = arg.evaluate(nav.at(arg, nav.cur))
+	}
+	var (
+		v   interface{}
+		err error
+	)
+	if f.rootFn != nil {
+		v, err = f.rootFn(nav.root, args...)
+	} else {
+		v, err = f.fn(args...)
+	}
+	if err != nil {
+		panic(&funcError{fmt.Errorf("%s(): %v", f.name, err)})
+	}
+	return v
+}
+
+// recoverFuncError stores an error raised by an extension function in err.
+func recoverFuncError(err *error) {
+	if r := recover(); r != nil {
+		e, ok := r.(*funcError)
+		if !ok {
+			panic(r)
+		}
+		*err = e.err
+	}
+}
+
+// funcValue formats the result of an extension function as the value of
+// its attribute, reporting false if the attribute should not exist.
+func funcValue(v interface{}) (string, bool) {
+	switch v := v.(type) {
+	case nil:
+		return "", false
+	case bool:
+		return "true", v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	case string:
+		return v, true
+	case []*Node:
+		if len(v) == 0 {
+			return "", false
+		}
+		return v[0].InnerText(), true
+	default:
+		return fmt.Sprint(v), true
+	}
+}
+
+// stringArg converts an argument to a string according to the XPath
+// string() function.
+func stringArg(v interface{}) string {
+	switch v := v.(type) {
+	case []*Node:
+		if len(v) == 0 {
+			return ""
+		}
+		return v[0].InnerText()
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	case string:
+		return v
+	}
+	return fmt.Sprint(v)
+}
+
+// base64DecodeFunc is base64-decode(string), the decoded value of a
+// standard or URL base64 encoded string, or an empty string if it cannot
+// be decoded.
+func base64DecodeFunc(args ...interface{}) (interface{}, error) {
+	if len(args) != 1 {
+		return nil, errors.New("expected 1 argument")
+	}
+	s := stringArg(args[0])
+	for _, enc := range []*base64.Encoding{base64.StdEncoding, base64.URLEncoding, base64.RawStdEncoding, base64.RawURLEncoding} {
+		if b, err := enc.DecodeString(s); err == nil {
+			return string(b), nil
+		}
+	}
+	return "", nil
+}
+
+// urlDecodeFunc is url-decode(string), the decoded value of a
+// percent-encoded string, or an empty string if it cannot be decoded.
+func urlDecodeFunc(args ...interface{}) (interface{}, error) {
+	if len(args) != 1 {
+		return nil, errors.New("expected 1 argument")
+	}
+	s, err := url.QueryUnescape(stringArg(args[0]))
+	if err != nil {
+		return "", nil
+	}
+	return s, nil
+}
+
+// dateLayouts are the layouts tried by date() without a layout argument.
+var dateLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+}
+
+// dateFunc is date(string[, layout]), the number of seconds since the
+// Unix epoch of a time in the Go layout, or ISO-8601 (RFC 3339 or a date)
+// if omitted. A time without a zone is in UTC. Returns nil, which is NaN
+// to the expression, if the string cannot be parsed, so that comparisons
+// with it are false.
+func dateFunc(args ...interface{}) (interface{}, error) {
+	if len(args) != 1 && len(args) != 2 {
+		return nil, errors.New("expected 1 or 2 arguments")
+	}
+	s := strings.TrimSpace(stringArg(args[0]))
+	layouts := dateLayouts
+	if len(args) == 2 {
+		layouts = []string{stringArg(args[1])}
+	}
+	for _, layout := range layouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return float64(t.Unix()) + float64(t.Nanosecond())/1e9, nil
+		}
+	}
+	return nil, nil
+}
+
+// numbers converts the arguments of an aggregate function to numbers.
+func numbers(args []interface{}) ([]float64, error) {
+	var a []float64
+	for _, arg := range args {
+		switch v := arg.(type) {
+		case float64:
+			a = append(a, v)
+		case []*Node:
+			for _, n := range v {
+				f, err := nodeNumber(n)
+				if err != nil {
+					return nil, err
+				}
+				a = append(a, f)
+			}
+		default:
+			return nil, fmt.Errorf("argument must be a node-set or number, got %T", arg)
+		}
+	}
+	return a, nil
+}
+
+// nodeNumber converts the value of n to a number according to its
+// ElementType. Objects, arrays and booleans are not numbers.
+func nodeNumber(n *Node) (float64, error) {
+	typ := n.ElType
+	if n.Type == TextNode && n.Parent != nil {
+		typ = n.Parent.ElType
+	}
+	switch typ {
+	case NumberNode, StringNode:
+		s := n.InnerText()
+		if f, err := strconv.ParseFloat(strings.TrimSpace(s), 64); err == nil {
+			return f, nil
+		}
+		return 0, fmt.Errorf("%q is not a number", s)
+	case BooleanNode:
+		return 0, fmt.Errorf("boolean %s is not a number", n.InnerText())
+	case ArrayNode:
+		return 0, fmt.Errorf("array %s is not a number", n.Data)
+	case NullNode:
+		return 0, fmt.Errorf("null %s is not a number", n.Data)
+	default:
+		return 0, fmt.Errorf("object %s is not a number", n.Data)
+	}
+}
+
+// aggregateFuncs are the functions that replace the XPath functions of
+// the same name in the expressions of QueryAggregate.
+var aggregateFuncs = map[string]Func{
+	"sum": sumFunc,
+}
+
+// sumFunc is sum(node-set) in QueryAggregate, which unlike the XPath
+// function reports non-numeric values as errors instead of returning NaN.
+func sumFunc(args ...interface{}) (interface{}, error) {
+	a, err := numbers(args)
+	if err != nil {
+		return nil, err
+	}
+	var sum float64
+	for _, f := range a {
+		sum += f
+	}
+	return sum, nil
+}
+
+// minFunc is min(node-set), returns NaN for an empty node-set.
+func minFunc(args ...interface{}) (interface{}, error) {
+	a, err := numbers(args)
+	if err != nil {
+		return nil, err
+	}
+	v := math.NaN()
+	for i, f := range a {
+		if i == 0 || f < v {
+			v = f
+		}
+	}
+	return v, nil
+}
+
+// maxFunc is max(node-set), returns NaN for an empty node-set.
+func maxFunc(args ...interface{}) (interface{}, error) {
+	a, err := numbers(args)
+	if err != nil {
+		return nil, err
+	}
+	v := math.NaN()
+	for i, f := range a {
+		if i == 0 || f > v {
+			v = f
+		}
+	}
+	return v, nil
+}
+
+// avgFunc is avg(node-set), returns NaN for an empty node-set.
+func avgFunc(args ...interface{}) (interface{}, error) {
+	a, err := numbers(args)
+	if err != nil {
+		return nil, err
+	}
+	if len(a) == 0 {
+		return math.NaN(), nil
+	}
+	var sum float64
+	for _, f := range a {
+		sum += f
+	}
+	return sum / float64(len(a)), nil
+}
@@ -0,0 +1,282 @@
+package jsonquery
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestAggregateFuncs(t *testing.T) {
+	doc, err := parseString(testConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range []struct {
+		expr string
+		want float64
+	}{
+		{"max(//areas/*/metric)", 2},
+		{"min(//areas/*/metric)", 0},
+		{"avg(//areas/*/metric)", 1},
+		{"max(//route-instance/*/metric)", 89},
+		{"avg(//route-instance/*/metric) + 1", 57.5},
+	} {
+		got, err := Evaluate(doc, v.expr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != v.want {
+			t.Fatalf("%s: expected %v but %v", v.expr, v.want, got)
+		}
+	}
+
+	n, err := Query(doc, "//areas/*[metric = max(//areas/*/metric)]")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e, g := "0.0.0.2", n.SelectElement("area_id").InnerText(); e != g {
+		t.Fatalf("expected %v but %v", e, g)
+	}
+	n, err = Query(doc, "//route-instance/*[metric = max(//route-instance/*/metric)]")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e, g := "ri2", n.Data; e != g {
+		t.Fatalf("expected %v but %v", e, g)
+	}
+	list, err := QueryAll(doc, "//areas/*[metric < avg(//areas/*/metric)]")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e, g := 1, len(list); e != g {
+		t.Fatalf("expected %v but %v", e, g)
+	}
+
+	v, err := Evaluate(doc, "max(//missing)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f, ok := v.(float64); !ok || !math.IsNaN(f) {
+		t.Fatalf("expected NaN but %v", v)
+	}
+	if _, err := QueryAll(doc, "//people/*[age = max(//name)]"); err == nil {
+		t.Fatal("expected error for non-numeric values")
+	}
+
+	// The results are numbers, so 0 is false and NaN is not equal to
+	// anything.
+	for _, v := range []struct {
+		expr string
+		want interface{}
+	}{
+		{"boolean(min(//areas/*/metric))", false},
+		{"boolean(max(//areas/*/metric))", true},
+		{"min(//areas/*/metric) = 0", true},
+		{"string(min(//areas/*/metric))", "0"},
+		{"min(//missing) = min(//missing)", false},
+		{"count(//areas/*[metric < avg(//missing) or metric >= avg(//missing)])", float64(0)},
+		{"string(avg(//missing))", "NaN"},
+		{"count(//areas/*[metric = min(//areas/*/metric)])", float64(1)},
+	} {
+		got, err := Evaluate(doc, v.expr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != v.want {
+			t.Errorf("%s: expected %v but %v", v.expr, v.want, got)
+		}
+	}
+}
+
+func TestQueryAggregate(t *testing.T) {
+	doc, err := parseString(testConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range []struct {
+		expr string
+		want float64
+	}{
+		{"sum(//metric)", 116},
+		{"avg(//metric)", 23.2},
+		{"sum(//areas/*/metric)", 3},
+		{"avg(//areas/*/metric)", 1},
+		{"min(//metric)", 0},
+		{"max(//metric)", 89},
+		{"count(//metric)", 5},
+		{"sum(//missing)", 0},
+	} {
+		got, err := QueryAggregate(doc, v.expr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != v.want {
+			t.Fatalf("%s: expected %v but %v", v.expr, v.want, got)
+		}
+	}
+	for _, expr := range []string{"sum(//name)", "avg(//people)", "//metric"} {
+		if _, err := QueryAggregate(doc, expr); err == nil {
+			t.Fatalf("%s: expected error", expr)
+		}
+	}
+	// Other queries keep the XPath function, which ignores them.
+	if v, err := Evaluate(doc, "sum(//name)"); err != nil {
+		t.Fatalf("expected the XPath sum() but %v, %v", v, err)
+	}
+}
+
+func argString(v interface{}) string {
+	switch v := v.(type) {
+	case []*Node:
+		if len(v) == 0 {
+			return ""
+		}
+		return v[0].InnerText()
+	case string:
+		return v
+	}
+	return fmt.Sprint(v)
+}
+
+func cidrContains(args ...interface{}) (interface{}, error) {
+	if len(args) != 2 {
+		return nil, errors.New("expected 2 arguments")
+	}
+	_, subnet, err := net.ParseCIDR(argString(args[0]))
+	if err != nil {
+		return nil, err
+	}
+	return subnet.Contains(net.ParseIP(argString(args[1]))), nil
+}
+
+func TestRegisterFunction(t *testing.T) {
+	s := `{
+		"interfaces": [
+			{ "name": "eth0", "subnet": "10.1.2.0/24" },
+			{ "name": "eth1", "subnet": "192.168.0.0/16" },
+			{ "name": "eth2", "subnet": "10.0.0.0/8" }
+		]
+	}`
+	doc, _ := parseString(s)
+	names := func(nodes []*Node) string {
+		var a []string
+		for _, n := range nodes {
+			a = append(a, n.SelectElement("name").InnerText())
+		}
+		return strings.Join(a, ",")
+	}
+
+	if _, err := QueryAll(doc, "//interfaces/*[cidr-contains(subnet, '10.1.2.3')]"); err == nil {
+		t.Fatal("expected error for unknown function")
+	}
+	RegisterFunction("cidr-contains", cidrContains)
+	nodes, err := QueryAll(doc, "//interfaces/*[cidr-contains(subnet, '10.1.2.3')]")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e, g := "eth0,eth2", names(nodes); e != g {
+		t.Fatalf("expected %v but %v", e, g)
+	}
+	nodes, err = QueryAll(doc, "//interfaces/*[not(cidr-contains(subnet, '10.1.2.3'))]")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e, g := "eth1", names(nodes); e != g {
+		t.Fatalf("expected %v but %v", e, g)
+	}
+	_, err = QueryAll(doc, "//interfaces/*[cidr-contains(name, '10.1.2.3')]")
+	if err == nil || !strings.Contains(err.Error(), "cidr-contains()") {
+		t.Fatalf("expected cidr-contains() error but %v", err)
+	}
+
+	exp, err := CompileFuncs("//interfaces/*[upper(name) = 'ETH1']", map[string]Func{
+		"upper": func(args ...interface{}) (interface{}, error) {
+			return strings.ToUpper(argString(args[0])), nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	nodes, err = exp.QueryAll(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e, g := "eth1", names(nodes); e != g {
+		t.Fatalf("expected %v but %v", e, g)
+	}
+	if _, err := Compile("//interfaces/*[upper(name) = 'ETH1']"); err == nil {
+		t.Fatal("expected error for function scoped to another expression")
+	}
+}
+
+func TestDecodeFuncs(t *testing.T) {
+	s := `{
+		"messages": [
+			{ "id": 1, "payload": "aGVsbG8=", "query": "q=hello%20world" },
+			{ "id": 2, "payload": "d29ybGQ", "query": "q=a+b%26c" },
+			{ "id": 3, "payload": "!!not base64!!", "query": "%zz" }
+		]
+	}`
+	doc := MustParse(s)
+	for _, v := range []struct {
+		expr, ids string
+	}{
+		{`//messages/*[base64-decode(payload) = "hello"]`, "1"},
+		{`//messages/*[base64-decode(payload) = "world"]`, "2"},
+		{`//messages/*[base64-decode(payload) = ""]`, "3"},
+		{`//messages/*[url-decode(query) = "q=hello world"]`, "1"},
+		{`//messages/*[contains(url-decode(query), "a b&c")]`, "2"},
+		{`//messages/*[url-decode(query) = ""]`, "3"},
+	} {
+		nodes, err := QueryAll(doc, v.expr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var ids []string
+		for _, n := range nodes {
+			ids = append(ids, n.SelectElement("id").InnerText())
+		}
+		if e, g := v.ids, strings.Join(ids, ","); e != g {
+			t.Fatalf("%s: expected %v but %v", v.expr, e, g)
+		}
+	}
+}
+
+func TestDateFunc(t *testing.T) {
+	doc := MustParse(`{
+		"events": [
+			{ "id": 1, "created": "2022-12-31T23:30:00-02:00", "day": "02/01/2023" },
+			{ "id": 2, "created": "2023-01-01T00:30:00+02:00", "day": "31/12/2022" },
+			{ "id": 3, "created": "2023-06-01", "day": "15/06/2023" },
+			{ "id": 4, "created": "yesterday", "day": "" }
+		]
+	}`)
+	for _, v := range []struct {
+		expr, ids string
+	}{
+		// Lexically "2022-12-31T23:30:00-02:00" < "2023-01-01".
+		{`//events/*[date(created) > date("2023-01-01")]`, "1,3"},
+		{`//events/*[date(created) < date("2023-01-01T00:00:00Z")]`, "2"},
+		{`//events/*[date(created) = date("2023-01-01T01:30:00Z")]`, "1"},
+		{`//events/*[date(day, "02/01/2006") >= date("2023-01-01")]`, "1,3"},
+		{`//events/*[not(date(created) = date(created))]`, "4"},
+	} {
+		nodes, err := QueryAll(doc, v.expr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var ids []string
+		for _, n := range nodes {
+			ids = append(ids, n.SelectElement("id").InnerText())
+		}
+		if e, g := v.ids, strings.Join(ids, ","); e != g {
+			t.Fatalf("%s: expected %v but %v", v.expr, e, g)
+		}
+	}
+	if _, err := QueryAll(doc, `//events/*[date()]`); err == nil {
+		t.Fatal("expected error for missing argument")
+	}
+}
@@ -1,9 +1,16 @@
 module github.com/wingeng/jsonquery
 
-go 1.14
+go 1.18
 
 require (
-	github.com/antchfx/xpath v1.1.6
+	github.com/BurntSushi/toml v1.6.0
+	github.com/antchfx/xpath v1.3.8
 	github.com/golang/groupcache v0.0.0-20200121045136-8c9f03a8e57e
 	github.com/stretchr/testify v1.5.1
 )
+
+require (
+	github.com/davecgh/go-spew v1.1.0 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	gopkg.in/yaml.v2 v2.2.2 // indirect
+)
@@ -0,0 +1,103 @@
+package jsonquery
+
+import "errors"
+
+// A DocumentHistory records the states of a Node tree as it is changed
+// through it, so that changes can be undone and redone, as in an editor.
+// Each state is kept as a deep copy of the tree.
+type DocumentHistory struct {
+	root *Node
+	undo []*Node
+	redo []*Node
+	max  int
+}
+
+// NewDocumentHistory returns a DocumentHistory for root, with no undo
+// steps. root must only be changed through the DocumentHistory afterwards,
+// or the changes cannot be undone.
+func NewDocumentHistory(root *Node) *DocumentHistory {
+	return &DocumentHistory{root: root}
+}
+
+// Root returns the tree of h. Undo and Redo change it in place.
+func (h *DocumentHistory) Root() *Node {
+	return h.root
+}
+
+// Apply calls fn with the tree of h and records the change as an undo
+// step. If fn returns an error, the tree is restored and the error is
+// returned. Any undone step can no longer be redone.
+func (h *DocumentHistory) Apply(fn func(root *Node) error) error {
+	prev := h.root.Clone()
+	if err := fn(h.root); err != nil {
+		h.restore(prev)
+		return err
+	}
+	h.undo = append(h.undo, prev)
+	h.redo = nil
+	h.trim()
+	return nil
+}
+
+// ApplyPatch applies the JSON Patch document patch to the tree, as the
+// ApplyPatch function, and records the change as an undo step.
+func (h *DocumentHistory) ApplyPatch(patch []byte) error {
+	return h.Apply(func(root *Node) error { return ApplyPatch(root, patch) })
+}
+
+// ApplyMergePatch applies the JSON Merge Patch document patch to the
+// tree, as the ApplyMergePatch function, and records the change as an
+// undo step.
+func (h *DocumentHistory) ApplyMergePatch(patch []byte) error {
+	return h.Apply(func(root *Node) error { return ApplyMergePatch(root, patch) })
+}
+
+// Undo reverts the last change of the tree not undone yet.
+// Return an error if there is no change to undo.
+func (h *DocumentHistory) Undo() error {
+	if len(h.undo) == 0 {
+		return errors.New("nothing to undo")
+	}
+	h.redo = append(h.redo, h.root.Clone())
+	h.restore(h.undo[len(h.undo)-1])
+	h.undo = h.undo[:len(h.undo)-1]
+	return nil
+}
+
+// Redo applies again the last change reverted by Undo.
+// Return an error if there is no change to redo.
+func (h *DocumentHistory) Redo() error {
+	if len(h.redo) == 0 {
+		return errors.New("nothing to redo")
+	}
+	h.undo = append(h.undo, h.root.Clone())
+	h.restore(h.redo[len(h.redo)-1])
+	h.redo = h.redo[:len(h.redo)-1]
+	h.trim()
+	return nil
+}
+
+// Snapshots returns the number of changes that can be undone.
+func (h *DocumentHistory) Snapshots() int {
+	return len(h.undo)
+}
+
+// MaxSnapshots limits the number of changes that can be undone to n,
+// forgetting the oldest ones first. If n <= 0, the number is not limited,
+// which is the default.
+func (h *DocumentHistory) MaxSnapshots(n int) {
+	h.max = n
+	h.trim()
+}
+
+func (h *DocumentHistory) trim() {
+	if h.max > 0 && len(h.undo) > h.max {
+		h.undo = append(h.undo[:0:0], h.undo[len(h.undo)-h.max:]...)
+	}
+}
+
+// restore replaces the value of the tree with the value of snapshot,
+// which is consumed.
+func (h *DocumentHistory) restore(snapshot *Node) {
+	mutate(h.root, func() { replaceValue(h.root, snapshot) })
+}
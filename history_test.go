@@ -0,0 +1,94 @@
+package jsonquery
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestDocumentHistory(t *testing.T) {
+	doc, _ := parseString(`{"name":"joe","age":45}`)
+	h := NewDocumentHistory(doc)
+	if err := h.Undo(); err == nil {
+		t.Fatal("expected error for nothing to undo")
+	}
+	if err := h.ApplyMergePatch([]byte(`{"age":46}`)); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.ApplyPatch([]byte(`[{"op":"remove","path":"/name"}]`)); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Apply(func(root *Node) error {
+		return root.SelectElement("age").SetValue(float64(47))
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if e, g := 3, h.Snapshots(); e != g {
+		t.Fatalf("expected %d snapshots but %d", e, g)
+	}
+
+	states := []string{
+		`{"age":47}`,
+		`{"age":46}`,
+		`{"age":46,"name":"joe"}`,
+		`{"age":45,"name":"joe"}`,
+	}
+	for i, e := range states {
+		if i > 0 {
+			if err := h.Undo(); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if g := doc.String(); e != g {
+			t.Fatalf("expected %v but %v", e, g)
+		}
+	}
+	if err := h.Undo(); err == nil {
+		t.Fatal("expected error for nothing to undo")
+	}
+	for i := len(states) - 2; i >= 0; i-- {
+		if err := h.Redo(); err != nil {
+			t.Fatal(err)
+		}
+		if e, g := states[i], doc.String(); e != g {
+			t.Fatalf("expected %v but %v", e, g)
+		}
+	}
+	if err := h.Redo(); err == nil {
+		t.Fatal("expected error for nothing to redo")
+	}
+
+	// A new change discards the undone ones.
+	h.Undo()
+	h.ApplyMergePatch([]byte(`{"age":1}`))
+	if err := h.Redo(); err == nil {
+		t.Fatal("expected error for nothing to redo")
+	}
+
+	// A failed change is reverted and not recorded.
+	errFail := errors.New("fail")
+	err := h.Apply(func(root *Node) error {
+		root.SelectElement("age").SetValue(float64(2))
+		return errFail
+	})
+	if err != errFail {
+		t.Fatalf("expected %v but %v", errFail, err)
+	}
+	if e, g := `{"age":1}`, doc.String(); e != g {
+		t.Fatalf("expected %v but %v", e, g)
+	}
+	if e, g := 3, h.Snapshots(); e != g {
+		t.Fatalf("expected %d snapshots but %d", e, g)
+	}
+
+	h.MaxSnapshots(1)
+	if e, g := 1, h.Snapshots(); e != g {
+		t.Fatalf("expected %d snapshots but %d", e, g)
+	}
+	h.Undo()
+	if e, g := `{"age":46}`, doc.String(); e != g {
+		t.Fatalf("expected %v but %v", e, g)
+	}
+	if err := h.Undo(); err == nil {
+		t.Fatal("expected error for nothing to undo")
+	}
+}
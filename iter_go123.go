@@ -0,0 +1,54 @@
+//go:build go1.23
+// +build go1.23
+
+package jsonquery
+
+import "iter"
+
+// QueryIter returns an iterator over the nodes that match the specified
+// XPath expr, for use with range:
+//
+//	for n, err := range QueryIter(doc, "//name") {
+//		if err != nil {
+//			return err
+//		}
+//		...
+//	}
+//
+// Nodes are searched as the loop runs, so breaking out of the loop stops
+// the search. An error, such as when `expr` cannot be parsed, is yielded
+// with a nil node and ends the iteration.
+func QueryIter(top *Node, expr string) iter.Seq2[*Node, error] {
+	exp, err := getQuery(expr)
+	if err != nil {
+		return func(yield func(*Node, error) bool) {
+			yield(nil, err)
+		}
+	}
+	return exp.QueryIter(top)
+}
+
+// QueryIter is like QueryAll but returns an iterator over the nodes, as
+// described by the QueryIter function. The nodes are yielded without
+// duplicates in the order they are found, which is document order except
+// for expressions such as unions, as described by WithLimit.
+func (e *Expr) QueryIter(top *Node) iter.Seq2[*Node, error] {
+	return func(yield func(*Node, error) bool) {
+		t, err := e.selectVars(top, nil)
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+		seen := make(map[*Node]bool)
+		for {
+			n, err := e.next(t, seen)
+			if err != nil {
+				yield(nil, err)
+				return
+			}
+			if n == nil || !yield(n, nil) {
+				return
+			}
+		}
+	}
+}
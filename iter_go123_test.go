@@ -0,0 +1,68 @@
+//go:build go1.23
+// +build go1.23
+
+package jsonquery
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestQueryIter(t *testing.T) {
+	doc, _ := parseString(testConfig)
+	var names []string
+	for n, err := range QueryIter(doc, "//name | //people/*[1]/name") {
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, n.InnerText())
+	}
+	if e, g := "joe,mark", strings.Join(names, ","); e != g {
+		t.Fatalf("expected %v but %v", e, g)
+	}
+
+	visits := 0
+	exp, err := CompileFuncs("//areas/*[visit()]/area_id", map[string]Func{
+		"visit": func(args ...interface{}) (interface{}, error) {
+			visits++
+			return true, nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for n, err := range exp.QueryIter(doc) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n.InnerText() != "0.0.0.0" {
+			t.Fatalf("expected 0.0.0.0 but %v", n.InnerText())
+		}
+		break
+	}
+	if visits != 1 {
+		t.Fatalf("expected the search to stop after 1 visit but %d", visits)
+	}
+
+	for _, expr := range []string{"//name[", "//people/*[min(name) > 1]"} {
+		count := 0
+		for n, err := range QueryIter(doc, expr) {
+			count++
+			if n != nil || err == nil {
+				t.Fatalf("%s: expected an error but %v, %v", expr, n, err)
+			}
+		}
+		if count != 1 {
+			t.Fatalf("%s: expected 1 error but %d", expr, count)
+		}
+	}
+	exp, _ = CompileFuncs("//name[fail()]", map[string]Func{
+		"fail": func(args ...interface{}) (interface{}, error) { return nil, errors.New("failing") },
+	})
+	for _, err := range exp.QueryIter(doc) {
+		if err == nil || !strings.Contains(err.Error(), "failing") {
+			t.Fatalf("expected failing but %v", err)
+		}
+	}
+}
@@ -0,0 +1,651 @@
+package jsonquery
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// QueryJSONPath searches the Node that matches by the specified JSONPath
+// expression, such as `$.store.book[*].author`.
+//
+// The core of JSONPath is supported: child (`.name`, `['name']`),
+// recursive descent (`..`), wildcards (`*`), array indexes (negative
+// indexes count from the end), slices (`[start:end:step]`), unions
+// (`[0,1]`, `['a','b']`) and filter expressions such as
+// `[?(@.age < 44 && @.name != 'joe')]`. Filters compare numbers as
+// numbers and strings as strings according to the ElementType of the
+// nodes. Return an error if the expression `path` cannot be parsed.
+func QueryJSONPath(top *Node, path string) ([]*Node, error) {
+	p := &jsonPathParser{s: path}
+	segs, err := p.parseQuery('$')
+	if err != nil {
+		return nil, err
+	}
+	if p.pos != len(p.s) {
+		return nil, p.errorf("unexpected %q", p.s[p.pos:])
+	}
+	return selectSegments([]*Node{top}, top, segs), nil
+}
+
+// A jsonPathSegment selects nodes from the children of a node, or from
+// the node and all its descendants if descendant is set.
+type jsonPathSegment struct {
+	descendant bool
+	selectors  []jsonPathSelector
+}
+
+type jsonPathSelector interface {
+	// selectNodes appends the children of n selected by the selector.
+	selectNodes(dst []*Node, n, root *Node) []*Node
+}
+
+type (
+	nameSelector     string
+	wildcardSelector struct{}
+	indexSelector    int
+	sliceSelector    struct {
+		start, end, step int
+		hasStart, hasEnd bool
+	}
+	filterSelector struct {
+		expr jsonPathExpr
+	}
+)
+
+// elementChildren returns the element children of n.
+func elementChildren(n *Node) []*Node {
+	var a []*Node
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == ElementNode {
+			a = append(a, c)
+		}
+	}
+	return a
+}
+
+func (s nameSelector) selectNodes(dst []*Node, n, root *Node) []*Node {
+	if n.ElType != MapNode {
+		return dst
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == ElementNode && c.Data == string(s) {
+			dst = append(dst, c)
+		}
+	}
+	return dst
+}
+
+func (wildcardSelector) selectNodes(dst []*Node, n, root *Node) []*Node {
+	return append(dst, elementChildren(n)...)
+}
+
+func (s indexSelector) selectNodes(dst []*Node, n, root *Node) []*Node {
+	if n.ElType != ArrayNode {
+		return dst
+	}
+	a := elementChildren(n)
+	i := int(s)
+	if i < 0 {
+		i += len(a)
+	}
+	if i >= 0 && i < len(a) {
+		dst = append(dst, a[i])
+	}
+	return dst
+}
+
+func (s sliceSelector) selectNodes(dst []*Node, n, root *Node) []*Node {
+	if n.ElType != ArrayNode || s.step == 0 {
+		return dst
+	}
+	a := elementChildren(n)
+	norm := func(i int) int {
+		if i < 0 {
+			i += len(a)
+		}
+		return i
+	}
+	clamp := func(i, lo, hi int) int {
+		if i < lo {
+			return lo
+		}
+		if i > hi {
+			return hi
+		}
+		return i
+	}
+	if s.step > 0 {
+		start, end := 0, len(a)
+		if s.hasStart {
+			start = clamp(norm(s.start), 0, len(a))
+		}
+		if s.hasEnd {
+			end = clamp(norm(s.end), 0, len(a))
+		}
+		for i := start; i < end; i += s.step {
+			dst = append(dst, a[i])
+		}
+		return dst
+	}
+	start, end := len(a)-1, -1
+	if s.hasStart {
+		start = clamp(norm(s.start), -1, len(a)-1)
+	}
+	if s.hasEnd {
+		end = clamp(norm(s.end), -1, len(a)-1)
+	}
+	for i := start; i > end; i += s.step {
+		dst = append(dst, a[i])
+	}
+	return dst
+}
+
+func (s filterSelector) selectNodes(dst []*Node, n, root *Node) []*Node {
+	for _, c := range elementChildren(n) {
+		if s.expr.test(c, root) {
+			dst = append(dst, c)
+		}
+	}
+	return dst
+}
+
+func selectSegments(nodes []*Node, root *Node, segs []jsonPathSegment) []*Node {
+	for _, seg := range segs {
+		var next []*Node
+		for _, n := range nodes {
+			if !seg.descendant {
+				for _, sel := range seg.selectors {
+					next = sel.selectNodes(next, n, root)
+				}
+				continue
+			}
+			var walk func(*Node)
+			walk = func(n *Node) {
+				for _, sel := range seg.selectors {
+					next = sel.selectNodes(next, n, root)
+				}
+				for _, c := range elementChildren(n) {
+					walk(c)
+				}
+			}
+			walk(n)
+		}
+		nodes = next
+	}
+	return nodes
+}
+
+// jsonPathExpr is a logical expression of a filter selector.
+type jsonPathExpr interface {
+	test(n, root *Node) bool
+}
+
+type (
+	orExpr  []jsonPathExpr
+	andExpr []jsonPathExpr
+	notExpr struct {
+		expr jsonPathExpr
+	}
+	// existExpr tests that a query selects at least one node.
+	existExpr struct {
+		query *jsonPathQuery
+	}
+	cmpExpr struct {
+		op          string
+		left, right jsonPathOperand
+	}
+)
+
+func (e orExpr) test(n, root *Node) bool {
+	for _, x := range e {
+		if x.test(n, root) {
+			return true
+		}
+	}
+	return false
+}
+
+func (e andExpr) test(n, root *Node) bool {
+	for _, x := range e {
+		if !x.test(n, root) {
+			return false
+		}
+	}
+	return true
+}
+
+func (e notExpr) test(n, root *Node) bool {
+	return !e.expr.test(n, root)
+}
+
+func (e existExpr) test(n, root *Node) bool {
+	return len(e.query.selectNodes(n, root)) > 0
+}
+
+func (e cmpExpr) test(n, root *Node) bool {
+	a, aok := e.left.value(n, root)
+	b, bok := e.right.value(n, root)
+	switch e.op {
+	case "==":
+		return aok == bok && (!aok || jsonPathEqual(a, b))
+	case "!=":
+		return aok != bok || (aok && !jsonPathEqual(a, b))
+	}
+	if !aok || !bok {
+		return false
+	}
+	switch a := a.(type) {
+	case float64:
+		b, ok := b.(float64)
+		if !ok {
+			return false
+		}
+		switch e.op {
+		case "<":
+			return a < b
+		case "<=":
+			return a <= b
+		case ">":
+			return a > b
+		case ">=":
+			return a >= b
+		}
+	case string:
+		b, ok := b.(string)
+		if !ok {
+			return false
+		}
+		switch e.op {
+		case "<":
+			return a < b
+		case "<=":
+			return a <= b
+		case ">":
+			return a > b
+		case ">=":
+			return a >= b
+		}
+	}
+	return false
+}
+
+func jsonPathEqual(a, b interface{}) bool {
+	if x, ok := a.(*Node); ok {
+		y, ok := b.(*Node)
+		return ok && x.String() == y.String()
+	}
+	return a == b
+}
+
+// jsonPathOperand is a literal or a singular query in a comparison.
+type jsonPathOperand interface {
+	// value returns the value of the operand, and false if a query
+	// selects nothing.
+	value(n, root *Node) (interface{}, bool)
+}
+
+type literalOperand struct {
+	v interface{}
+}
+
+func (o literalOperand) value(n, root *Node) (interface{}, bool) {
+	return o.v, true
+}
+
+type jsonPathQuery struct {
+	absolute bool
+	segs     []jsonPathSegment
+}
+
+func (q *jsonPathQuery) selectNodes(n, root *Node) []*Node {
+	if q.absolute {
+		n = root
+	}
+	return selectSegments([]*Node{n}, root, q.segs)
+}
+
+func (q *jsonPathQuery) value(n, root *Node) (interface{}, bool) {
+	nodes := q.selectNodes(n, root)
+	if len(nodes) != 1 {
+		return nil, false
+	}
+	return nodeValue(nodes[0]), true
+}
+
+// nodeValue returns the value of n as a float64, string or bool according
+// to its ElementType, or n itself for objects and arrays.
+func nodeValue(n *Node) interface{} {
+	switch n.ElType {
+	case NumberNode:
+		if f, err := strconv.ParseFloat(n.InnerText(), 64); err == nil {
+			return f
+		}
+		return n.InnerText()
+	case StringNode:
+		return n.InnerText()
+	case BooleanNode:
+		return n.InnerText() == "true"
+	}
+	return n
+}
+
+type jsonPathParser struct {
+	s   string
+	pos int
+}
+
+func (p *jsonPathParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("jsonpath %s: at %d: %s", p.s, p.pos, fmt.Sprintf(format, args...))
+}
+
+func (p *jsonPathParser) skipSpace() {
+	for p.pos < len(p.s) && (p.s[p.pos] == ' ' || p.s[p.pos] == '\t' || p.s[p.pos] == '\n' || p.s[p.pos] == '\r') {
+		p.pos++
+	}
+}
+
+func (p *jsonPathParser) consume(prefix string) bool {
+	if strings.HasPrefix(p.s[p.pos:], prefix) {
+		p.pos += len(prefix)
+		return true
+	}
+	return false
+}
+
+// parseQuery parses the identifier root ($ or @) and the segments after it.
+func (p *jsonPathParser) parseQuery(root byte) ([]jsonPathSegment, error) {
+	if p.pos >= len(p.s) || p.s[p.pos] != root {
+		return nil, p.errorf("expected %c", root)
+	}
+	p.pos++
+	var segs []jsonPathSegment
+	for p.pos < len(p.s) {
+		var seg jsonPathSegment
+		switch {
+		case p.consume(".."):
+			seg.descendant = true
+			if p.pos < len(p.s) && p.s[p.pos] == '[' {
+				sels, err := p.parseBracket()
+				if err != nil {
+					return nil, err
+				}
+				seg.selectors = sels
+			} else {
+				sel, err := p.parseDotSelector()
+				if err != nil {
+					return nil, err
+				}
+				seg.selectors = []jsonPathSelector{sel}
+			}
+		case p.consume("."):
+			sel, err := p.parseDotSelector()
+			if err != nil {
+				return nil, err
+			}
+			seg.selectors = []jsonPathSelector{sel}
+		case p.s[p.pos] == '[':
+			sels, err := p.parseBracket()
+			if err != nil {
+				return nil, err
+			}
+			seg.selectors = sels
+		default:
+			return segs, nil
+		}
+		segs = append(segs, seg)
+	}
+	return segs, nil
+}
+
+func isJSONPathNameChar(c byte) bool {
+	return c == '_' || c == '-' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c >= 0x80
+}
+
+func (p *jsonPathParser) parseDotSelector() (jsonPathSelector, error) {
+	if p.consume("*") {
+		return wildcardSelector{}, nil
+	}
+	start := p.pos
+	for p.pos < len(p.s) && isJSONPathNameChar(p.s[p.pos]) {
+		p.pos++
+	}
+	if start == p.pos {
+		return nil, p.errorf("expected member name")
+	}
+	return nameSelector(p.s[start:p.pos]), nil
+}
+
+func (p *jsonPathParser) parseBracket() ([]jsonPathSelector, error) {
+	p.pos++ // [
+	var sels []jsonPathSelector
+	for {
+		p.skipSpace()
+		sel, err := p.parseSelector()
+		if err != nil {
+			return nil, err
+		}
+		sels = append(sels, sel)
+		p.skipSpace()
+		if p.consume("]") {
+			return sels, nil
+		}
+		if !p.consume(",") {
+			return nil, p.errorf("expected , or ]")
+		}
+	}
+}
+
+func (p *jsonPathParser) parseSelector() (jsonPathSelector, error) {
+	if p.pos >= len(p.s) {
+		return nil, p.errorf("unexpected end of expression")
+	}
+	switch c := p.s[p.pos]; {
+	case c == '*':
+		p.pos++
+		return wildcardSelector{}, nil
+	case c == '\'' || c == '"':
+		s, err := p.parseString()
+		if err != nil {
+			return nil, err
+		}
+		return nameSelector(s), nil
+	case c == '?':
+		p.pos++
+		p.skipSpace()
+		paren := p.consume("(")
+		expr, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		p.skipSpace()
+		if paren && !p.consume(")") {
+			return nil, p.errorf("expected )")
+		}
+		return filterSelector{expr}, nil
+	}
+	// index or slice
+	var (
+		nums [3]int
+		has  [3]bool
+		n    int
+	)
+	for {
+		p.skipSpace()
+		if p.pos < len(p.s) && (p.s[p.pos] == '-' || p.s[p.pos] >= '0' && p.s[p.pos] <= '9') {
+			v, err := p.parseInt()
+			if err != nil {
+				return nil, err
+			}
+			nums[n], has[n] = v, true
+		}
+		p.skipSpace()
+		if n < 2 && p.consume(":") {
+			n++
+			continue
+		}
+		break
+	}
+	if n == 0 {
+		if !has[0] {
+			return nil, p.errorf("expected selector")
+		}
+		return indexSelector(nums[0]), nil
+	}
+	step := 1
+	if has[2] {
+		step = nums[2]
+	}
+	return sliceSelector{start: nums[0], end: nums[1], step: step, hasStart: has[0], hasEnd: has[1]}, nil
+}
+
+func (p *jsonPathParser) parseInt() (int, error) {
+	start := p.pos
+	if p.s[p.pos] == '-' {
+		p.pos++
+	}
+	for p.pos < len(p.s) && p.s[p.pos] >= '0' && p.s[p.pos] <= '9' {
+		p.pos++
+	}
+	v, err := strconv.Atoi(p.s[start:p.pos])
+	if err != nil {
+		return 0, p.errorf("invalid integer %q", p.s[start:p.pos])
+	}
+	return v, nil
+}
+
+func (p *jsonPathParser) parseString() (string, error) {
+	quote := p.s[p.pos]
+	var b strings.Builder
+	for p.pos++; p.pos < len(p.s); p.pos++ {
+		c := p.s[p.pos]
+		switch {
+		case c == quote:
+			p.pos++
+			return b.String(), nil
+		case c == '\\' && p.pos+1 < len(p.s):
+			p.pos++
+			b.WriteByte(p.s[p.pos])
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", p.errorf("unterminated string literal")
+}
+
+func (p *jsonPathParser) parseOr() (jsonPathExpr, error) {
+	var e orExpr
+	for {
+		x, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		e = append(e, x)
+		p.skipSpace()
+		if !p.consume("||") {
+			break
+		}
+	}
+	if len(e) == 1 {
+		return e[0], nil
+	}
+	return e, nil
+}
+
+func (p *jsonPathParser) parseAnd() (jsonPathExpr, error) {
+	var e andExpr
+	for {
+		x, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		e = append(e, x)
+		p.skipSpace()
+		if !p.consume("&&") {
+			break
+		}
+	}
+	if len(e) == 1 {
+		return e[0], nil
+	}
+	return e, nil
+}
+
+func (p *jsonPathParser) parseUnary() (jsonPathExpr, error) {
+	p.skipSpace()
+	if strings.HasPrefix(p.s[p.pos:], "!") && !strings.HasPrefix(p.s[p.pos:], "!=") {
+		p.pos++
+		x, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return notExpr{x}, nil
+	}
+	if p.consume("(") {
+		x, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		p.skipSpace()
+		if !p.consume(")") {
+			return nil, p.errorf("expected )")
+		}
+		return x, nil
+	}
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	for _, op := range []string{"==", "!=", "<=", ">=", "<", ">"} {
+		if p.consume(op) {
+			p.skipSpace()
+			right, err := p.parseOperand()
+			if err != nil {
+				return nil, err
+			}
+			return cmpExpr{op: op, left: left, right: right}, nil
+		}
+	}
+	q, ok := left.(*jsonPathQuery)
+	if !ok {
+		return nil, p.errorf("expected comparison")
+	}
+	return existExpr{q}, nil
+}
+
+func (p *jsonPathParser) parseOperand() (jsonPathOperand, error) {
+	if p.pos >= len(p.s) {
+		return nil, p.errorf("unexpected end of expression")
+	}
+	switch c := p.s[p.pos]; {
+	case c == '@' || c == '$':
+		segs, err := p.parseQuery(c)
+		if err != nil {
+			return nil, err
+		}
+		return &jsonPathQuery{absolute: c == '$', segs: segs}, nil
+	case c == '\'' || c == '"':
+		s, err := p.parseString()
+		if err != nil {
+			return nil, err
+		}
+		return literalOperand{s}, nil
+	case c == '-' || c >= '0' && c <= '9':
+		start := p.pos
+		p.pos++
+		for p.pos < len(p.s) && strings.IndexByte("0123456789.eE+-", p.s[p.pos]) >= 0 {
+			p.pos++
+		}
+		f, err := strconv.ParseFloat(p.s[start:p.pos], 64)
+		if err != nil {
+			return nil, p.errorf("invalid number %q", p.s[start:p.pos])
+		}
+		return literalOperand{f}, nil
+	case p.consume("true"):
+		return literalOperand{true}, nil
+	case p.consume("false"):
+		return literalOperand{false}, nil
+	}
+	return nil, p.errorf("unexpected %q", p.s[p.pos:])
+}
@@ -0,0 +1,65 @@
+package jsonquery
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestQueryJSONPath(t *testing.T) {
+	doc, err := parseString(testConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range []struct {
+		path, xpath string
+	}{
+		{"$..name", "//name"},
+		{"$.top.people[*].name", "/top/people/*/name"},
+		{"$..people[?(@.age < 44)]", "//people/*[age < 44]"},
+		{"$..people[?(@.age >= 2 && @.name != 'mark')]", "//people/*[age >= 2 and name != 'mark']"},
+		{"$..['route-instance'][?(@.metric < 44)]", "//route-instance/*[metric < 44]"},
+		{"$..sites[*]..areas[?(@.area_id != '0.0.0.1')]", `//sites/*//*[area_id != "0.0.0.1"]`},
+		{"$..areas[?(!(@.metric > 0))].area_id", "//areas/*[not(metric > 0)]/area_id"},
+		{"$..[?(@.metric)]", "//*[metric]"},
+		{"$.top.inner[1:3]", "/top/inner/*[position() > 1 and position() <= 3]"},
+		{"$.top.inner[-1]", "/top/inner/*[last()]"},
+		{"$.top.inner[::2]", "/top/inner/*[position() mod 2 = 1]"},
+		{"$.top.inner[0,3]", "/top/inner/*[position() = 1 or position() = 4]"},
+		{"$.top.people[?(@.name == $.top.people[1].name)]", "/top/people/*[name = 'mark']"},
+	} {
+		got, err := QueryJSONPath(doc, v.path)
+		if err != nil {
+			t.Fatalf("%s: %v", v.path, err)
+		}
+		exp := Find(doc, v.xpath)
+		if len(exp) == 0 {
+			t.Fatalf("%s: no nodes matched", v.xpath)
+		}
+		if e, g := len(exp), len(got); e != g {
+			t.Fatalf("%s: expected %v nodes but %v", v.path, e, g)
+		}
+		for i := range exp {
+			if exp[i] != got[i] {
+				t.Fatalf("%s: expected %v but %v", v.path, exp[i], got[i])
+			}
+		}
+	}
+
+	got, err := QueryJSONPath(doc, "$.top.inner[::-1]")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var a []string
+	for _, n := range got {
+		a = append(a, n.InnerText())
+	}
+	if e, g := "3,2,1,0", strings.Join(a, ","); e != g {
+		t.Fatalf("expected %v but %v", e, g)
+	}
+
+	for _, path := range []string{"top", "$.top[", "$.top[?(@.a <)]", "$['a"} {
+		if _, err := QueryJSONPath(doc, path); err == nil {
+			t.Fatalf("%s: expected error", path)
+		}
+	}
+}
@@ -0,0 +1,35 @@
+// Package jsonquerygzip parses JSON documents that may be compressed with
+// gzip.
+package jsonquerygzip
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"io"
+
+	"github.com/wingeng/jsonquery"
+)
+
+// gzipMagic is the header of gzip data.
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// ParseGzip parses the JSON document read from r like jsonquery.Parse,
+// decompressing it first if it is gzip data. Concatenated gzip members
+// are read as one document.
+func ParseGzip(r io.Reader, opts ...jsonquery.ParseOption) (*jsonquery.Node, error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(len(gzipMagic))
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	if !bytes.Equal(magic, gzipMagic) {
+		return jsonquery.Parse(br, opts...)
+	}
+	zr, err := gzip.NewReader(br)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	return jsonquery.Parse(zr, opts...)
+}
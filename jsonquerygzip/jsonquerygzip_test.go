@@ -0,0 +1,79 @@
+package jsonquerygzip
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/wingeng/jsonquery"
+)
+
+// readTestdata returns the content of the file name of the testdata
+// directory.
+func readTestdata(t *testing.T, name string) []byte {
+	b, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func gzipBytes(t *testing.T, b []byte) []byte {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(b); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestParseGzip(t *testing.T) {
+	// A copy of the document of the TestConvert test of jsonquery and of
+	// its expected conversion.
+	config := readTestdata(t, "convert.json")
+	want := strings.TrimSpace(string(readTestdata(t, "convert_expected.json")))
+	for name, data := range map[string][]byte{
+		"gzip":  gzipBytes(t, config),
+		"plain": config,
+	} {
+		doc, err := ParseGzip(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		g, err := json.MarshalIndent(jsonquery.ConvertNodeToInterface(doc), "", "  ")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(g) != want {
+			t.Fatalf("%s: expected %s but %s", name, want, g)
+		}
+		if v, err := jsonquery.ValueOf(doc, "//people/*[age > 10]/name"); err != nil || v != "joe" {
+			t.Fatalf("%s: expected joe but %q, %v", name, v, err)
+		}
+	}
+
+	upper := jsonquery.WithKeyTransform(strings.ToUpper)
+	doc, err := ParseGzip(bytes.NewReader(gzipBytes(t, []byte(`{"a":1}`))), upper)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e, g := `{"A":1}`, doc.String(); e != g {
+		t.Fatalf("expected %v but %v", e, g)
+	}
+
+	corrupt := gzipBytes(t, config)
+	corrupt = corrupt[:len(corrupt)/2]
+	if _, err := ParseGzip(bytes.NewReader(corrupt)); err == nil {
+		t.Fatal("expected error for truncated gzip data")
+	}
+	if _, err := ParseGzip(strings.NewReader("")); err == nil {
+		t.Fatal("expected error for empty input")
+	}
+}
@@ -0,0 +1,17 @@
+module github.com/wingeng/jsonquery/jsonquerypb
+
+go 1.23
+
+require (
+	github.com/wingeng/jsonquery v0.0.0
+	google.golang.org/protobuf v1.33.0
+)
+
+require (
+	github.com/BurntSushi/toml v1.6.0 // indirect
+	github.com/antchfx/xpath v1.3.8 // indirect
+	github.com/golang/groupcache v0.0.0-20200121045136-8c9f03a8e57e // indirect
+	github.com/google/go-cmp v0.7.0 // indirect
+)
+
+replace github.com/wingeng/jsonquery => ../
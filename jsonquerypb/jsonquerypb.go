@@ -0,0 +1,73 @@
+// Package jsonquerypb converts jsonquery nodes to and from the
+// google.protobuf.Struct well-known type, used to pass arbitrary JSON
+// data through protobuf APIs such as gRPC services.
+//
+// It is a module of its own so that jsonquery does not depend on
+// protobuf.
+package jsonquerypb
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/wingeng/jsonquery"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// ToProtobuf converts the object n and its members to a Struct. Numbers
+// become NumberValue, strings StringValue, booleans BoolValue, null
+// NullValue, arrays ListValue and objects StructValue.
+// Return an error if n is not an object, or a number cannot be
+// represented as a float64.
+func ToProtobuf(n *jsonquery.Node) (*structpb.Struct, error) {
+	if n.ElType != jsonquery.MapNode {
+		return nil, fmt.Errorf("cannot convert %s to a Struct: not an object", n.Data)
+	}
+	s := &structpb.Struct{Fields: make(map[string]*structpb.Value)}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		v, err := toValue(c)
+		if err != nil {
+			return nil, err
+		}
+		s.Fields[c.Data] = v
+	}
+	return s, nil
+}
+
+func toValue(n *jsonquery.Node) (*structpb.Value, error) {
+	switch n.ElType {
+	case jsonquery.MapNode:
+		s, err := ToProtobuf(n)
+		if err != nil {
+			return nil, err
+		}
+		return structpb.NewStructValue(s), nil
+	case jsonquery.ArrayNode:
+		l := &structpb.ListValue{}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			v, err := toValue(c)
+			if err != nil {
+				return nil, err
+			}
+			l.Values = append(l.Values, v)
+		}
+		return structpb.NewListValue(l), nil
+	case jsonquery.NumberNode:
+		f, err := strconv.ParseFloat(n.InnerText(), 64)
+		if err != nil {
+			return nil, fmt.Errorf("cannot convert %s to a NumberValue: %v", n.InnerText(), err)
+		}
+		return structpb.NewNumberValue(f), nil
+	case jsonquery.BooleanNode:
+		return structpb.NewBoolValue(n.InnerText() == "true"), nil
+	case jsonquery.NullNode:
+		return structpb.NewNullValue(), nil
+	}
+	return structpb.NewStringValue(n.InnerText()), nil
+}
+
+// FromProtobuf creates a document whose root is the object s. Its members
+// are sorted by key, as by jsonquery.Parse.
+func FromProtobuf(s *structpb.Struct) *jsonquery.Node {
+	return jsonquery.ParseTree(s.AsMap())
+}
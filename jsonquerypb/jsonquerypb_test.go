@@ -0,0 +1,66 @@
+package jsonquerypb
+
+import (
+	"testing"
+
+	"github.com/wingeng/jsonquery"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+func TestToProtobuf(t *testing.T) {
+	doc := jsonquery.MustParse(`{"name":"joe","age":45,"ok":true,"none":null,"tags":["a",1,[false]],"address":{"city":"x"}}`)
+	s, err := ToProtobuf(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := s.Fields
+	if v, ok := f["name"].Kind.(*structpb.Value_StringValue); !ok || v.StringValue != "joe" {
+		t.Fatalf("expected a StringValue joe but %v", f["name"])
+	}
+	if v, ok := f["age"].Kind.(*structpb.Value_NumberValue); !ok || v.NumberValue != 45 {
+		t.Fatalf("expected a NumberValue 45 but %v", f["age"])
+	}
+	if v, ok := f["ok"].Kind.(*structpb.Value_BoolValue); !ok || !v.BoolValue {
+		t.Fatalf("expected a BoolValue true but %v", f["ok"])
+	}
+	if _, ok := f["none"].Kind.(*structpb.Value_NullValue); !ok {
+		t.Fatalf("expected a NullValue but %v", f["none"])
+	}
+	if v, ok := f["tags"].Kind.(*structpb.Value_ListValue); !ok || len(v.ListValue.Values) != 3 {
+		t.Fatalf("expected a ListValue of 3 values but %v", f["tags"])
+	}
+	if v, ok := f["address"].Kind.(*structpb.Value_StructValue); !ok || v.StructValue.Fields["city"].GetStringValue() != "x" {
+		t.Fatalf("expected a StructValue but %v", f["address"])
+	}
+
+	b, err := protojson.Marshal(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e, g := doc.String(), jsonquery.MustParse(string(b)).String(); e != g {
+		t.Fatalf("expected %v but %v", e, g)
+	}
+
+	if _, err := ToProtobuf(jsonquery.MustParse(`[1]`)); err == nil {
+		t.Fatal("expected error for an array")
+	}
+}
+
+func TestFromProtobuf(t *testing.T) {
+	src := `{"address":{"city":"x"},"age":45,"name":"joe","none":null,"ok":true,"tags":["a",1,[false]]}`
+	s, err := ToProtobuf(jsonquery.MustParse(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc := FromProtobuf(s)
+	if g := doc.String(); g != src {
+		t.Fatalf("expected %v but %v", src, g)
+	}
+	if e, g := "x", jsonquery.FindOne(doc, "//city").InnerText(); e != g {
+		t.Fatalf("expected %v but %v", e, g)
+	}
+	if e, g := jsonquery.NumberNode, doc.SelectElement("age").ElType; e != g {
+		t.Fatalf("expected %v but %v", e, g)
+	}
+}
@@ -0,0 +1,85 @@
+// Package jsonquerytest provides helpers for tests that work with JSON
+// documents.
+package jsonquerytest
+
+import (
+	"encoding/json"
+	"reflect"
+
+	"github.com/wingeng/jsonquery"
+)
+
+// TB is the subset of testing.TB used by the helpers.
+type TB interface {
+	Helper()
+	Errorf(format string, args ...interface{})
+}
+
+// EqualJSON reports whether got and want hold the same JSON value, and
+// reports an error to t if they don't. Whitespace and object key order
+// are ignored. A string, []byte or json.RawMessage is compared as JSON
+// text. A *jsonquery.Node is compared as the value it holds, converted
+// with jsonquery.ConvertNodeToInterfaceTyped so that its numbers and
+// booleans keep their JSON types, and a []*jsonquery.Node as an array of
+// these values. Any other value is marshaled to JSON first.
+func EqualJSON(t TB, got, want interface{}) bool {
+	t.Helper()
+	g, err := normalize(got)
+	if err != nil {
+		t.Errorf("invalid JSON in got: %v", err)
+		return false
+	}
+	w, err := normalize(want)
+	if err != nil {
+		t.Errorf("invalid JSON in want: %v", err)
+		return false
+	}
+	if !reflect.DeepEqual(g, w) {
+		t.Errorf("JSON not equal\ngot:\n%s\nwant:\n%s", indent(g), indent(w))
+		return false
+	}
+	return true
+}
+
+func normalize(v interface{}) (interface{}, error) {
+	var b []byte
+	switch v := v.(type) {
+	case string:
+		b = []byte(v)
+	case []byte:
+		b = v
+	case json.RawMessage:
+		b = v
+	case *jsonquery.Node:
+		return normalize(nodeValue(v))
+	case []*jsonquery.Node:
+		a := make([]interface{}, len(v))
+		for i, n := range v {
+			a[i] = nodeValue(n)
+		}
+		return normalize(a)
+	default:
+		var err error
+		if b, err = json.Marshal(v); err != nil {
+			return nil, err
+		}
+	}
+	var x interface{}
+	if err := json.Unmarshal(b, &x); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// nodeValue returns the value held by n, or nil if n is nil.
+func nodeValue(n *jsonquery.Node) interface{} {
+	if n == nil {
+		return nil
+	}
+	return jsonquery.ConvertNodeToInterfaceTyped(n)
+}
+
+func indent(v interface{}) string {
+	b, _ := json.MarshalIndent(v, "", "  ")
+	return string(b)
+}
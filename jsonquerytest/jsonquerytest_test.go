@@ -0,0 +1,75 @@
+package jsonquerytest
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/wingeng/jsonquery"
+)
+
+type recorder struct {
+	errors []string
+}
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Errorf(format string, args ...interface{}) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func TestEqualJSON(t *testing.T) {
+	got := `{"b": [1, 2], "a": {"y": "1", "x": true}}`
+	want := `{
+		"a": { "x": true, "y": "1" },
+		"b": [ 1, 2 ]
+	}`
+	if !EqualJSON(t, got, want) {
+		t.Fatal("expected equal")
+	}
+	if !EqualJSON(t, []byte(`[1.0]`), []interface{}{1.0}) {
+		t.Fatal("expected equal")
+	}
+
+	r := &recorder{}
+	if EqualJSON(r, `{"a": [1, 2]}`, `{"a": [2, 1]}`) {
+		t.Fatal("expected not equal")
+	}
+	if EqualJSON(r, `{"a": "1"}`, `{"a": 1}`) {
+		t.Fatal("expected not equal")
+	}
+	if EqualJSON(r, `{"a": `, `{}`) {
+		t.Fatal("expected not equal")
+	}
+	if e, g := 3, len(r.errors); e != g {
+		t.Fatalf("expected %v errors but %v", e, g)
+	}
+}
+
+func TestEqualJSONNode(t *testing.T) {
+	doc := jsonquery.MustParse(`{"people": [{"name": "joe", "age": 45, "admin": true}, {"name": "mark", "age": 2, "admin": false}]}`)
+	n := jsonquery.FindOne(doc, "//people/*[1]")
+	if !EqualJSON(t, n, `{"age": 45, "admin": true, "name": "joe"}`) {
+		t.Fatal("expected equal")
+	}
+	if !EqualJSON(t, doc, doc.String()) {
+		t.Fatal("expected equal")
+	}
+	names := jsonquery.Find(doc, "//people/*/name")
+	if !EqualJSON(t, names, `["joe", "mark"]`) {
+		t.Fatal("expected equal")
+	}
+	if !EqualJSON(t, jsonquery.FindOne(doc, "//missing"), `null`) {
+		t.Fatal("expected equal")
+	}
+
+	r := &recorder{}
+	if EqualJSON(r, n, `{"age": "45", "admin": true, "name": "joe"}`) {
+		t.Fatal("expected not equal")
+	}
+	if EqualJSON(r, names, `["mark", "joe"]`) {
+		t.Fatal("expected not equal")
+	}
+	if e, g := 2, len(r.errors); e != g {
+		t.Fatalf("expected %v errors but %v", e, g)
+	}
+}
@@ -0,0 +1,70 @@
+package jsonquery
+
+import (
+	"sort"
+	"sync"
+)
+
+// A DocMatch is a node matched by Expr.SelectMany with the label of its
+// document.
+type DocMatch struct {
+	Label string
+	Match
+}
+
+// SelectMany runs e on each of docs, keyed by label, and returns all the
+// matches, ordered by label and then by document order. If workers is
+// greater than 1, up to workers documents are queried at the same time.
+// Return the error of the first document, by label, that failed.
+func (e *Expr) SelectMany(docs map[string]*Node, workers int) ([]DocMatch, error) {
+	labels := make([]string, 0, len(docs))
+	for label := range docs {
+		labels = append(labels, label)
+	}
+	sort.Strings(labels)
+	results := make([][]DocMatch, len(labels))
+	errs := make([]error, len(labels))
+	run := func(i int) {
+		nodes, err := e.QueryAll(docs[labels[i]])
+		if err != nil {
+			errs[i] = err
+			return
+		}
+		nodes = sortDocumentOrder(nodes)
+		ms := make([]DocMatch, len(nodes))
+		for j, m := range newMatches(nodes, newLocator()) {
+			ms[j] = DocMatch{labels[i], m}
+		}
+		results[i] = ms
+	}
+	if workers > 1 {
+		var wg sync.WaitGroup
+		next := make(chan int)
+		for w := 0; w < workers; w++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := range next {
+					run(i)
+				}
+			}()
+		}
+		for i := range labels {
+			next <- i
+		}
+		close(next)
+		wg.Wait()
+	} else {
+		for i := range labels {
+			run(i)
+		}
+	}
+	var all []DocMatch
+	for i, ms := range results {
+		if errs[i] != nil {
+			return nil, errs[i]
+		}
+		all = append(all, ms...)
+	}
+	return all, nil
+}
@@ -0,0 +1,48 @@
+package jsonquery
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestSelectMany(t *testing.T) {
+	docs := make(map[string]*Node)
+	for label, metrics := range map[string][2]int{
+		"r3": {60, 10},
+		"r1": {24, 89},
+		"r2": {51, 70},
+	} {
+		doc, err := parseString(fmt.Sprintf(`{"route-instance":{"ri1":{"metric":%d},"ri2":{"metric":%d}}}`, metrics[0], metrics[1]))
+		if err != nil {
+			t.Fatal(err)
+		}
+		docs[label] = doc
+	}
+	exp, err := Compile("//route-instance/*[metric > 50]")
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := []string{
+		"r1 /route-instance/ri2",
+		"r2 /route-instance/ri1",
+		"r2 /route-instance/ri2",
+		"r3 /route-instance/ri1",
+	}
+	for _, workers := range []int{0, 1, 2, 8} {
+		ms, err := exp.SelectMany(docs, workers)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(ms) != len(e) {
+			t.Fatalf("%d workers: expected %d matches but %d", workers, len(e), len(ms))
+		}
+		for i, m := range ms {
+			if g := m.Label + " " + m.Pointer; e[i] != g {
+				t.Fatalf("%d workers: expected %v but %v", workers, e[i], g)
+			}
+			if m.Node != docs[m.Label].SelectElement("route-instance").SelectElement(m.Key) {
+				t.Fatalf("%d workers: unexpected node for %v", workers, m.Pointer)
+			}
+		}
+	}
+}
@@ -0,0 +1,348 @@
+package jsonquery
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"strconv"
+)
+
+// ParseMsgPack parses a MessagePack document into a Node tree with the
+// same element types as the equivalent JSON document. Integers keep their
+// exact value and binary data becomes a StringNode with its standard
+// base64 encoding, like encoding/json does for []byte. Map keys must be
+// strings and extension types are not supported.
+func ParseMsgPack(r io.Reader) (*Node, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	d := &msgpackDecoder{b: b}
+	v, err := d.decode(0)
+	if err != nil {
+		return nil, err
+	}
+	if d.off != len(b) {
+		return nil, fmt.Errorf("msgpack: invalid data at offset %d after top-level value", d.off)
+	}
+	doc := &Node{Type: DocumentNode}
+	parseValue(v, doc, 1, nil)
+	return doc, nil
+}
+
+// msgpackMaxDepth limits the nesting of the arrays and maps decoded by
+// ParseMsgPack.
+const msgpackMaxDepth = 10000
+
+var errMsgPackShort = errors.New("msgpack: unexpected end of data")
+
+type msgpackDecoder struct {
+	b   []byte
+	off int
+}
+
+func (d *msgpackDecoder) next(n int) ([]byte, error) {
+	if n < 0 || len(d.b)-d.off < n {
+		return nil, errMsgPackShort
+	}
+	p := d.b[d.off : d.off+n]
+	d.off += n
+	return p, nil
+}
+
+// uint reads a big-endian unsigned integer of size bytes.
+func (d *msgpackDecoder) uint(size int) (uint64, error) {
+	p, err := d.next(size)
+	if err != nil {
+		return 0, err
+	}
+	var u uint64
+	for _, c := range p {
+		u = u<<8 | uint64(c)
+	}
+	return u, nil
+}
+
+// length reads a length of size bytes, which is at most the number of
+// bytes left since every item takes at least one byte.
+func (d *msgpackDecoder) length(size int) (int, error) {
+	u, err := d.uint(size)
+	if err != nil {
+		return 0, err
+	}
+	if u > uint64(len(d.b)-d.off) {
+		return 0, errMsgPackShort
+	}
+	return int(u), nil
+}
+
+// decode decodes a value into the values produced by encoding/json,
+// except for integers which are decoded as hookedNumber values to keep
+// their exact value.
+func (d *msgpackDecoder) decode(depth int) (interface{}, error) {
+	if depth > msgpackMaxDepth {
+		return nil, errors.New("msgpack: exceeded max depth")
+	}
+	p, err := d.next(1)
+	if err != nil {
+		return nil, err
+	}
+	c := p[0]
+	switch {
+	case c <= 0x7f:
+		return msgpackInt(int64(c)), nil
+	case c >= 0xe0:
+		return msgpackInt(int64(int8(c))), nil
+	case c&0xf0 == 0x80:
+		return d.decodeMap(int(c&0x0f), depth)
+	case c&0xf0 == 0x90:
+		return d.decodeArray(int(c&0x0f), depth)
+	case c&0xe0 == 0xa0:
+		return d.decodeString(int(c & 0x1f))
+	}
+	switch c {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xc4, 0xc5, 0xc6:
+		n, err := d.length(1 << (c - 0xc4))
+		if err != nil {
+			return nil, err
+		}
+		b, _ := d.next(n)
+		return base64.StdEncoding.EncodeToString(b), nil
+	case 0xca:
+		u, err := d.uint(4)
+		if err != nil {
+			return nil, err
+		}
+		f := math.Float32frombits(uint32(u))
+		return msgpackFloat(float64(f), 32)
+	case 0xcb:
+		u, err := d.uint(8)
+		if err != nil {
+			return nil, err
+		}
+		return msgpackFloat(math.Float64frombits(u), 64)
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		u, err := d.uint(1 << (c - 0xcc))
+		if err != nil {
+			return nil, err
+		}
+		return hookedNumber{text: strconv.FormatUint(u, 10), typ: NumberNode}, nil
+	case 0xd0, 0xd1, 0xd2, 0xd3:
+		size := 1 << (c - 0xd0)
+		u, err := d.uint(size)
+		if err != nil {
+			return nil, err
+		}
+		// Sign-extend the integer to 64 bits.
+		shift := uint(64 - 8*size)
+		return msgpackInt(int64(u<<shift) >> shift), nil
+	case 0xd9, 0xda, 0xdb:
+		n, err := d.length(1 << (c - 0xd9))
+		if err != nil {
+			return nil, err
+		}
+		return d.decodeString(n)
+	case 0xdc, 0xdd:
+		n, err := d.length(2 << (c - 0xdc))
+		if err != nil {
+			return nil, err
+		}
+		return d.decodeArray(n, depth)
+	case 0xde, 0xdf:
+		n, err := d.length(2 << (c - 0xde))
+		if err != nil {
+			return nil, err
+		}
+		return d.decodeMap(n, depth)
+	}
+	return nil, fmt.Errorf("msgpack: unsupported type 0x%02x at offset %d", c, d.off-1)
+}
+
+func (d *msgpackDecoder) decodeString(n int) (interface{}, error) {
+	b, err := d.next(n)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+func (d *msgpackDecoder) decodeArray(n, depth int) (interface{}, error) {
+	a := make([]interface{}, 0, n)
+	for i := 0; i < n; i++ {
+		v, err := d.decode(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		a = append(a, v)
+	}
+	return a, nil
+}
+
+func (d *msgpackDecoder) decodeMap(n, depth int) (interface{}, error) {
+	m := make(map[string]interface{}, n)
+	for i := 0; i < n; i++ {
+		off := d.off
+		k, err := d.decode(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		key, ok := k.(string)
+		if !ok {
+			return nil, fmt.Errorf("msgpack: map key at offset %d is not a string", off)
+		}
+		v, err := d.decode(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		m[key] = v
+	}
+	return m, nil
+}
+
+func msgpackInt(i int64) hookedNumber {
+	return hookedNumber{text: strconv.FormatInt(i, 10), typ: NumberNode}
+}
+
+// msgpackFloat formats f with the precision of its encoding, so that a
+// float32 0.1 is not read as 0.10000000149011612.
+func msgpackFloat(f float64, bitSize int) (interface{}, error) {
+	if math.IsInf(f, 0) || math.IsNaN(f) {
+		return nil, fmt.Errorf("msgpack: unsupported number %v", f)
+	}
+	return hookedNumber{text: strconv.FormatFloat(f, 'f', -1, bitSize), typ: NumberNode}, nil
+}
+
+// ToMsgPack returns the MessagePack encoding of n. The members of objects
+// are encoded in document order and numbers as integers if they are
+// integral and fit in 64 bits, or as float64 otherwise.
+func (n *Node) ToMsgPack() ([]byte, error) {
+	var buf bytes.Buffer
+	if err := encodeMsgPack(&buf, n); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func encodeMsgPack(buf *bytes.Buffer, n *Node) error {
+	if n.Type == TextNode {
+		writeMsgPackString(buf, n.Data)
+		return nil
+	}
+	switch n.ElType {
+	case MapNode, ArrayNode:
+		var children []*Node
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if c.Type == ElementNode {
+				children = append(children, c)
+			}
+		}
+		if n.ElType == MapNode {
+			writeMsgPackHeader(buf, len(children), 0x80, 0xde)
+		} else {
+			writeMsgPackHeader(buf, len(children), 0x90, 0xdc)
+		}
+		for _, c := range children {
+			if n.ElType == MapNode {
+				writeMsgPackString(buf, c.Data)
+			}
+			if err := encodeMsgPack(buf, c); err != nil {
+				return err
+			}
+		}
+	case StringNode:
+		writeMsgPackString(buf, n.InnerText())
+	case NumberNode:
+		return writeMsgPackNumber(buf, n.InnerText())
+	case BooleanNode:
+		if n.InnerText() == "true" {
+			buf.WriteByte(0xc3)
+		} else {
+			buf.WriteByte(0xc2)
+		}
+	case NullNode:
+		buf.WriteByte(0xc0)
+	default:
+		return fmt.Errorf("msgpack: unsupported element type %v", n.ElType)
+	}
+	return nil
+}
+
+// writeMsgPackHeader writes the header of a map or an array of n items,
+// with fix the type of the fix format and code the type of the 16-bit
+// format.
+func writeMsgPackHeader(buf *bytes.Buffer, n int, fix, code byte) {
+	switch {
+	case n < 16:
+		buf.WriteByte(fix | byte(n))
+	case n <= math.MaxUint16:
+		buf.WriteByte(code)
+		binary.Write(buf, binary.BigEndian, uint16(n))
+	default:
+		buf.WriteByte(code + 1)
+		binary.Write(buf, binary.BigEndian, uint32(n))
+	}
+}
+
+func writeMsgPackString(buf *bytes.Buffer, s string) {
+	switch n := len(s); {
+	case n < 32:
+		buf.WriteByte(0xa0 | byte(n))
+	case n <= math.MaxUint8:
+		buf.WriteByte(0xd9)
+		buf.WriteByte(byte(n))
+	case n <= math.MaxUint16:
+		buf.WriteByte(0xda)
+		binary.Write(buf, binary.BigEndian, uint16(n))
+	default:
+		buf.WriteByte(0xdb)
+		binary.Write(buf, binary.BigEndian, uint32(n))
+	}
+	buf.WriteString(s)
+}
+
+func writeMsgPackNumber(buf *bytes.Buffer, s string) error {
+	if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+		switch {
+		case i >= 0 && i <= 0x7f:
+			buf.WriteByte(byte(i))
+		case i < 0 && i >= -32:
+			buf.WriteByte(byte(int8(i)))
+		case i >= math.MinInt8 && i <= math.MaxInt8:
+			buf.WriteByte(0xd0)
+			buf.WriteByte(byte(int8(i)))
+		case i >= math.MinInt16 && i <= math.MaxInt16:
+			buf.WriteByte(0xd1)
+			binary.Write(buf, binary.BigEndian, int16(i))
+		case i >= math.MinInt32 && i <= math.MaxInt32:
+			buf.WriteByte(0xd2)
+			binary.Write(buf, binary.BigEndian, int32(i))
+		default:
+			buf.WriteByte(0xd3)
+			binary.Write(buf, binary.BigEndian, i)
+		}
+		return nil
+	}
+	if u, err := strconv.ParseUint(s, 10, 64); err == nil {
+		buf.WriteByte(0xcf)
+		binary.Write(buf, binary.BigEndian, u)
+		return nil
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return fmt.Errorf("msgpack: invalid number %q", s)
+	}
+	buf.WriteByte(0xcb)
+	binary.Write(buf, binary.BigEndian, math.Float64bits(f))
+	return nil
+}
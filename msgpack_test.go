@@ -0,0 +1,71 @@
+package jsonquery
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestParseMsgPack(t *testing.T) {
+	data := []byte{
+		0x85,            // map of 5
+		0xa1, 'a', 0x2a, // "a": 42
+		0xa1, 'b', 0x94, // "b": [
+		0xc3, 0xc0, 0xfb, //   true, nil, -5,
+		0xcb, 0x3f, 0xf8, 0, 0, 0, 0, 0, 0, //   1.5]
+		0xa1, 'c', 0xd9, 3, 'x', 'y', 'z', // "c": "xyz"
+		0xa1, 'd', 0xc4, 2, 0x01, 0x02, // "d": bin [1 2]
+		0xa1, 'e', 0xcf, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, // "e": 2^64-1
+	}
+	doc, err := ParseMsgPack(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e, g := `{"a":42,"b":[true,null,-5,1.5],"c":"xyz","d":"AQI=","e":18446744073709551615}`, doc.String(); e != g {
+		t.Fatalf("expected %v but %v", e, g)
+	}
+	if sum, err := QueryAggregate(doc, "sum(//b/*[. = number(.)]) + a"); err != nil || sum != 38.5 {
+		t.Fatalf("expected 38.5 but %v, %v", sum, err)
+	}
+	if n := FindOne(doc, "//b/*[2]"); n.ElType != NullNode {
+		t.Fatalf("expected a null node but %v", n.ElType)
+	}
+
+	for _, data := range [][]byte{
+		{0x81, 0x01, 0x02},    // integer key
+		{0x92, 0x01},          // truncated array
+		{0xd9, 0x05, 'a'},     // truncated string
+		{0xc7, 0x01, 0x01, 0}, // extension type
+		{0x01, 0x02},          // trailing data
+	} {
+		if _, err := ParseMsgPack(bytes.NewReader(data)); err == nil {
+			t.Fatalf("expected error for % x", data)
+		}
+	}
+}
+
+func TestToMsgPack(t *testing.T) {
+	s := `{"n":[0,127,128,-32,-33,-200,40000,-40000,3000000000,-3000000000,1.25,18446744073709551615],` +
+		`"s":["","` + strings.Repeat("x", 40) + `","` + strings.Repeat("y", 300) + `"],` +
+		`"t":true,"f":false,"z":null,"m":{},"big":[` + strings.Repeat("1,", 19) + `1]}`
+	doc := MustParse(s)
+	b, err := doc.ToMsgPack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc2, err := ParseMsgPack(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e, g := doc.String(), doc2.String(); e != g {
+		t.Fatalf("expected %v but %v", e, g)
+	}
+
+	b, err = MustParse(`{"b":1,"a":[true]}`).ToMsgPack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e := []byte{0x82, 0xa1, 'a', 0x91, 0xc3, 0xa1, 'b', 0x01}; !bytes.Equal(b, e) {
+		t.Fatalf("expected % x but % x", e, b)
+	}
+}
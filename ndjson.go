@@ -0,0 +1,97 @@
+package jsonquery
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// WriteResultsNDJSON writes the compact JSON encoding of each of nodes to
+// w as newline-delimited JSON, one line per node.
+func WriteResultsNDJSON(w io.Writer, nodes []*Node) error {
+	bw := bufio.NewWriter(w)
+	for _, n := range nodes {
+		b, err := n.ToJSON()
+		if err != nil {
+			return err
+		}
+		bw.Write(b)
+		bw.WriteByte('\n')
+	}
+	return bw.Flush()
+}
+
+// A StreamOption configures QueryStream.
+type StreamOption func(*streamOptions)
+
+type streamOptions struct {
+	onLineError func(lineNo int, err error) error
+}
+
+// OnLineError makes QueryStream call fn with the 1-based number of each
+// line that is not valid JSON and the parse error, instead of stopping.
+// The stream goes on if fn returns nil, otherwise QueryStream returns the
+// error of fn.
+func OnLineError(fn func(lineNo int, err error) error) StreamOption {
+	return func(o *streamOptions) {
+		o.onLineError = fn
+	}
+}
+
+// QueryStream reads newline-delimited JSON from r, and calls fn with the
+// 1-based number and the nodes matching expr of each line as it is read,
+// even if none matched. Blank lines are skipped. The tree of a line is
+// released once fn returns, so fn must not keep the matched nodes; use
+// Clone for the ones that are needed later.
+// Return an error if expr cannot be parsed, ctx is done, reading r fails,
+// a line is not valid JSON and OnLineError is not set, or fn returns one.
+func QueryStream(ctx context.Context, r io.Reader, expr string, fn func(lineNo int, matches []*Node) error, opts ...StreamOption) error {
+	exp, err := getQuery(expr)
+	if err != nil {
+		return err
+	}
+	var o streamOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	a := NewArena()
+	br := bufio.NewReader(r)
+	for lineNo := 1; ; lineNo++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		line, rerr := br.ReadBytes('\n')
+		if rerr != nil && rerr != io.EOF {
+			return rerr
+		}
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			if err := streamLine(a, exp, lineNo, line, fn, &o); err != nil {
+				return err
+			}
+		}
+		if rerr == io.EOF {
+			return nil
+		}
+	}
+}
+
+func streamLine(a *Arena, exp *Expr, lineNo int, line []byte, fn func(int, []*Node) error, o *streamOptions) error {
+	var v interface{}
+	if err := json.Unmarshal(line, &v); err != nil {
+		if o.onLineError == nil {
+			return fmt.Errorf("line %d: %v", lineNo, err)
+		}
+		return o.onLineError(lineNo, err)
+	}
+	doc := a.newNode(DocumentNode, "", 0)
+	parseValue(v, doc, 1, a)
+	defer a.Release(doc)
+	matches, err := exp.QueryAll(doc)
+	if err != nil {
+		return err
+	}
+	return fn(lineNo, matches)
+}
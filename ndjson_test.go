@@ -0,0 +1,114 @@
+package jsonquery
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestWriteResultsNDJSON(t *testing.T) {
+	doc, _ := parseString(testConfig)
+	var buf bytes.Buffer
+	if err := WriteResultsNDJSON(&buf, Find(doc, "//people/*")); err != nil {
+		t.Fatal(err)
+	}
+	e := `{"age":45,"name":"joe"}
+{"age":2,"name":"mark"}
+`
+	if g := buf.String(); e != g {
+		t.Fatalf("expected %v but %v", e, g)
+	}
+
+	buf.Reset()
+	if err := WriteResultsNDJSON(&buf, Find(doc, "//people/*/name")); err != nil {
+		t.Fatal(err)
+	}
+	if e, g := "\"joe\"\n\"mark\"\n", buf.String(); e != g {
+		t.Fatalf("expected %v but %v", e, g)
+	}
+}
+
+func TestQueryStream(t *testing.T) {
+	var buf bytes.Buffer
+	for i := 0; i < 1000; i++ {
+		fmt.Fprintf(&buf, `{"id":%d,"tags":["a","b"],"ok":%t}`+"\n", i, i%4 == 0)
+		if i%100 == 50 {
+			buf.WriteString("\n")
+		}
+	}
+	var lines, matched int
+	seen := make(map[*Node]bool)
+	err := QueryStream(context.Background(), &buf, "id[../ok = 'true']", func(lineNo int, matches []*Node) error {
+		lines++
+		matched += len(matches)
+		for _, n := range matches {
+			seen[n] = true
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e, g := 1000, lines; e != g {
+		t.Fatalf("expected %d lines but %d", e, g)
+	}
+	if e, g := 250, matched; e != g {
+		t.Fatalf("expected %d matches but %d", e, g)
+	}
+	if len(seen) > 10 {
+		t.Fatalf("expected the nodes of released lines reused but %d distinct nodes", len(seen))
+	}
+}
+
+func TestQueryStreamErrors(t *testing.T) {
+	input := "{\"a\":1}\n{\"a\":\n{\"a\":3}"
+	var sum int
+	fn := func(lineNo int, matches []*Node) error {
+		for _, n := range matches {
+			i, _ := strconv.Atoi(n.InnerText())
+			sum += i
+		}
+		return nil
+	}
+	err := QueryStream(context.Background(), strings.NewReader(input), "a", fn)
+	if err == nil || !strings.HasPrefix(err.Error(), "line 2:") {
+		t.Fatalf("expected an error for line 2 but %v", err)
+	}
+
+	sum = 0
+	var bad []int
+	err = QueryStream(context.Background(), strings.NewReader(input), "a", fn, OnLineError(func(lineNo int, err error) error {
+		bad = append(bad, lineNo)
+		return nil
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e, g := 4, sum; e != g {
+		t.Fatalf("expected sum %d but %d", e, g)
+	}
+	if len(bad) != 1 || bad[0] != 2 {
+		t.Fatalf("expected line 2 reported but %v", bad)
+	}
+
+	errStop := errors.New("stop")
+	err = QueryStream(context.Background(), strings.NewReader(input), "a", func(lineNo int, matches []*Node) error {
+		return errStop
+	})
+	if err != errStop {
+		t.Fatalf("expected %v but %v", errStop, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := QueryStream(ctx, strings.NewReader(input), "a", fn); err != context.Canceled {
+		t.Fatalf("expected %v but %v", context.Canceled, err)
+	}
+	if err := QueryStream(context.Background(), strings.NewReader(input), "[", fn); err == nil {
+		t.Fatal("expected error for invalid expression")
+	}
+}
@@ -3,11 +3,14 @@ package jsonquery
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
 	"sort"
 	"strconv"
+	"strings"
 )
 
 // A NodeType is the type of a Node.
@@ -32,10 +35,22 @@ const (
 	StringNode
 	NumberNode
 	BooleanNode
+	// NullNode is a JSON null value. It has no child nodes.
+	NullNode
 )
 
 // A Node consists of a NodeType and some Data (tag name for
 // element nodes, content for text) and are part of a tree of Nodes.
+//
+// The children of an array are in array order and have no name. The
+// children of an object are sorted by key when parsed, and members added
+// later are appended, so both have a meaningful sibling order for the
+// following-sibling and preceding-sibling axes.
+//
+// Queries do not modify a tree, so any number of goroutines may query
+// the same tree concurrently. Modifying a tree, such as with ApplyPatch
+// or SetValue, while it is queried requires external locking; NodeSync
+// provides it.
 type Node struct {
 	Parent, PrevSibling, NextSibling, FirstChild, LastChild *Node
 
@@ -44,6 +59,35 @@ type Node struct {
 	Data   string
 
 	level int
+	// extra holds the state of the features that few nodes use, nil
+	// until one of them does.
+	extra *nodeExtra
+}
+
+// nodeExtra is the state of a Node for OnChange and Delete, kept out of
+// Node so that the nodes of a document stay small.
+type nodeExtra struct {
+	// observers holds the callbacks registered with OnChange.
+	observers []*observer
+	// deleted holds the names of the members deleted from an object, for
+	// MarshalOptions.EmitNullForDeleted.
+	deleted []string
+}
+
+// extras returns the extra state of n, allocating it if needed.
+func (n *Node) extras() *nodeExtra {
+	if n.extra == nil {
+		n.extra = &nodeExtra{}
+	}
+	return n.extra
+}
+
+// deletedMembers returns the names of the members deleted from n.
+func (n *Node) deletedMembers() []string {
+	if n.extra == nil {
+		return nil
+	}
+	return n.extra.deleted
 }
 
 // ChildNodes gets all child nodes of the node.
@@ -55,6 +99,79 @@ func (n *Node) ChildNodes() []*Node {
 	return a
 }
 
+// EachChild calls fn for each child node of n in turn, like ChildNodes
+// without allocating, until fn returns false. fn may remove the child
+// it is called with from the tree.
+func (n *Node) EachChild(fn func(*Node) bool) {
+	for c := n.FirstChild; c != nil; {
+		next := c.NextSibling
+		if !fn(c) {
+			return
+		}
+		c = next
+	}
+}
+
+// ForEach calls fn for each member of an object or item of an array in
+// document order, with the member name or the item index as key. It does
+// nothing for other nodes.
+func (n *Node) ForEach(fn func(key string, child *Node)) {
+	i := 0
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type != ElementNode {
+			continue
+		}
+		key := c.Data
+		if n.ElType == ArrayNode {
+			key = strconv.Itoa(i)
+		}
+		fn(key, c)
+		i++
+	}
+}
+
+// Ancestors returns the chain of parent nodes of n, starting with the
+// parent of n and ending with the root (usually the DocumentNode).
+func (n *Node) Ancestors() []*Node {
+	var a []*Node
+	for p := n.Parent; p != nil; p = p.Parent {
+		a = append(a, p)
+	}
+	return a
+}
+
+// Depth returns the number of ancestors of n, so the root of a tree
+// returns 0 and its children return 1.
+func (n *Node) Depth() int {
+	depth := 0
+	for p := n.Parent; p != nil; p = p.Parent {
+		depth++
+	}
+	return depth
+}
+
+// NextElement returns the next sibling of n that is an element node, or
+// nil if there is none.
+func (n *Node) NextElement() *Node {
+	for s := n.NextSibling; s != nil; s = s.NextSibling {
+		if s.Type == ElementNode {
+			return s
+		}
+	}
+	return nil
+}
+
+// PrevElement returns the previous sibling of n that is an element node,
+// or nil if there is none.
+func (n *Node) PrevElement() *Node {
+	for s := n.PrevSibling; s != nil; s = s.PrevSibling {
+		if s.Type == ElementNode {
+			return s
+		}
+	}
+	return nil
+}
+
 // InnerText gets the value of the node and all its child nodes.
 func (n *Node) InnerText() string {
 	var output func(*bytes.Buffer, *Node)
@@ -73,8 +190,25 @@ func (n *Node) InnerText() string {
 }
 
 // SelectElement finds the first of child elements with the
-// specified name.
+// specified name. The name "*" matches any child element, like the XPath
+// node test, so it finds the first member of an object or the first item
+// of an array; it is not a pattern, so "ri*" only matches a member named
+// "ri*".
 func (n *Node) SelectElement(name string) *Node {
+	if name == "*" {
+		for nn := n.FirstChild; nn != nil; nn = nn.NextSibling {
+			if nn.Type == ElementNode {
+				return nn
+			}
+		}
+		return nil
+	}
+	return n.selectMember(name)
+}
+
+// selectMember is like SelectElement but name is always a literal name,
+// even if it is "*".
+func (n *Node) selectMember(name string) *Node {
 	for nn := n.FirstChild; nn != nil; nn = nn.NextSibling {
 		if nn.Data == name {
 			return nn
@@ -83,6 +217,284 @@ func (n *Node) SelectElement(name string) *Node {
 	return nil
 }
 
+// HasChild reports whether n has a child element with the specified
+// name.
+func (n *Node) HasChild(name string) bool {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == ElementNode && c.Data == name {
+			return true
+		}
+	}
+	return false
+}
+
+// HasDescendant reports whether the subtree of n, excluding n itself,
+// has an element with the specified name.
+func (n *Node) HasDescendant(name string) bool {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == ElementNode && c.Data == name || c.HasDescendant(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// Find returns the first element of the subtree of n, excluding n
+// itself, in document order for which fn reports true, or nil. It is
+// like FindOne with a Go function instead of an XPath expression.
+func (n *Node) Find(fn func(n *Node) bool) *Node {
+	var found *Node
+	n.walkElements(func(c *Node) bool {
+		if fn(c) {
+			found = c
+		}
+		return found == nil
+	})
+	return found
+}
+
+// FindAll returns the elements of the subtree of n, excluding n itself,
+// in document order for which fn reports true.
+func (n *Node) FindAll(fn func(n *Node) bool) []*Node {
+	var found []*Node
+	n.walkElements(func(c *Node) bool {
+		if fn(c) {
+			found = append(found, c)
+		}
+		return true
+	})
+	return found
+}
+
+// walkElements calls fn for the elements of the subtree of n, excluding
+// n itself, in document order until it returns false, and reports
+// whether it did not.
+func (n *Node) walkElements(fn func(*Node) bool) bool {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type != ElementNode {
+			continue
+		}
+		if !fn(c) || !c.walkElements(fn) {
+			return false
+		}
+	}
+	return true
+}
+
+// IsEmpty reports whether n holds no value: null, an empty string, or an
+// array or object without items or members. A text node is empty if its
+// text is.
+func (n *Node) IsEmpty() bool {
+	if n.Type == TextNode {
+		return n.Data == ""
+	}
+	switch n.ElType {
+	case NullNode:
+		return true
+	case MapNode, ArrayNode:
+		return n.FirstChild == nil
+	case StringNode:
+		return n.InnerText() == ""
+	}
+	return false
+}
+
+// IsBlank is like IsEmpty but also reports true for a string of white
+// space only.
+func (n *Node) IsBlank() bool {
+	if n.Type == TextNode {
+		return strings.TrimSpace(n.Data) == ""
+	}
+	if n.ElType == StringNode {
+		return strings.TrimSpace(n.InnerText()) == ""
+	}
+	return n.IsEmpty()
+}
+
+// RenameKey renames every object member named oldName in the subtree of
+// root to newName, and returns the number of members renamed. A renamed
+// member is moved before the first member of its object whose name sorts
+// after newName, which keeps parsed objects sorted by key. A member is
+// not renamed if its object already has a member named newName.
+func RenameKey(root *Node, oldName, newName string) int {
+	count := 0
+	for _, c := range root.ChildNodes() {
+		if c.Type == ElementNode && c.Data == oldName && root.ElType == MapNode && root.SelectElement(newName) == nil {
+			removeNode(c)
+			c.Data = newName
+			ref := root.FirstChild
+			for ref != nil && ref.Data <= newName {
+				ref = ref.NextSibling
+			}
+			insertBefore(root, c, ref)
+			count++
+		}
+		count += RenameKey(c, oldName, newName)
+	}
+	return count
+}
+
+// appendChild adds n as the last child of parent.
+func appendChild(parent, n *Node) {
+	n.Parent = parent
+	n.level = parent.level + 1
+	if parent.FirstChild == nil {
+		parent.FirstChild = n
+	} else {
+		parent.LastChild.NextSibling = n
+		n.PrevSibling = parent.LastChild
+	}
+	parent.LastChild = n
+}
+
+// insertBefore adds n as a child of parent before ref, or as the last
+// child if ref is nil.
+func insertBefore(parent, n, ref *Node) {
+	if ref == nil {
+		appendChild(parent, n)
+	} else {
+		n.Parent = parent
+		n.PrevSibling = ref.PrevSibling
+		n.NextSibling = ref
+		if ref.PrevSibling == nil {
+			parent.FirstChild = n
+		} else {
+			ref.PrevSibling.NextSibling = n
+		}
+		ref.PrevSibling = n
+	}
+	setLevel(n, parent.level+1)
+}
+
+// removeNode detaches n from its parent and siblings.
+func removeNode(n *Node) {
+	if p := n.Parent; p != nil {
+		if p.FirstChild == n {
+			p.FirstChild = n.NextSibling
+		}
+		if p.LastChild == n {
+			p.LastChild = n.PrevSibling
+		}
+	}
+	if n.PrevSibling != nil {
+		n.PrevSibling.NextSibling = n.NextSibling
+	}
+	if n.NextSibling != nil {
+		n.NextSibling.PrevSibling = n.PrevSibling
+	}
+	n.Parent, n.PrevSibling, n.NextSibling = nil, nil, nil
+}
+
+// deleteMember removes n from its parent, recording its name if the
+// parent is an object.
+func deleteMember(n *Node) {
+	if p := n.Parent; p != nil && p.ElType == MapNode {
+		found := false
+		for _, name := range p.deletedMembers() {
+			found = found || name == n.Data
+		}
+		if !found {
+			p.extras().deleted = append(p.deletedMembers(), n.Data)
+		}
+	}
+	removeNode(n)
+}
+
+// setLevel sets the level of n to level and updates its descendants.
+func setLevel(n *Node, level int) {
+	n.level = level
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		setLevel(c, level+1)
+	}
+}
+
+// Clone returns a deep copy of n and all its child nodes. The copy has
+// no parent or siblings.
+func (n *Node) Clone() *Node {
+	c := &Node{Type: n.Type, ElType: n.ElType, Data: n.Data, level: n.level}
+	if deleted := n.deletedMembers(); len(deleted) > 0 {
+		c.extras().deleted = append([]string(nil), deleted...)
+	}
+	for nn := n.FirstChild; nn != nil; nn = nn.NextSibling {
+		appendChild(c, nn.Clone())
+	}
+	return c
+}
+
+// sortDocumentOrder sorts nodes in document order, the order in which
+// they are visited by a depth-first traversal of their tree. Nodes that
+// don't belong to the tree of the first node are kept at the end.
+func sortDocumentOrder(nodes []*Node) []*Node {
+	ordered := true
+	for i := 1; i < len(nodes); i++ {
+		if !precedes(nodes[i-1], nodes[i]) {
+			ordered = false
+			break
+		}
+	}
+	if ordered {
+		return nodes
+	}
+	root := nodes[0]
+	for root.Parent != nil {
+		root = root.Parent
+	}
+	order := make(map[*Node]int)
+	var walk func(*Node)
+	walk = func(n *Node) {
+		order[n] = len(order)
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(root)
+	index := func(n *Node) int {
+		if i, ok := order[n]; ok {
+			return i
+		}
+		return len(order)
+	}
+	sort.SliceStable(nodes, func(i, j int) bool {
+		return index(nodes[i]) < index(nodes[j])
+	})
+	return nodes
+}
+
+// precedes reports whether a comes before b in document order.
+func precedes(a, b *Node) bool {
+	if a == b {
+		return false
+	}
+	var pa, pb []*Node
+	for n := a; n != nil; n = n.Parent {
+		pa = append(pa, n)
+	}
+	for n := b; n != nil; n = n.Parent {
+		pb = append(pb, n)
+	}
+	i, j := len(pa)-1, len(pb)-1
+	if pa[i] != pb[j] {
+		return false
+	}
+	for i >= 0 && j >= 0 && pa[i] == pb[j] {
+		i--
+		j--
+	}
+	if i < 0 {
+		// a is an ancestor of b.
+		return true
+	}
+	if j < 0 {
+		return false
+	}
+	for n := pa[i]; n != nil; n = n.NextSibling {
+		if n == pb[j] {
+			return true
+		}
+	}
+	return false
+}
+
 // LoadURL loads the JSON document from the specified URL.
 func LoadURL(url string) (*Node, error) {
 	resp, err := http.Get(url)
@@ -93,7 +505,7 @@ func LoadURL(url string) (*Node, error) {
 	return Parse(resp.Body)
 }
 
-func parseValue(x interface{}, top *Node, level int) {
+func parseValue(x interface{}, top *Node, level int, a *Arena) {
 	addNode := func(n *Node) {
 		if n.level == top.level {
 			top.NextSibling = n
@@ -119,9 +531,9 @@ func parseValue(x interface{}, top *Node, level int) {
 	case []interface{}:
 		top.ElType = ArrayNode
 		for _, vv := range v {
-			n := &Node{Type: ElementNode, level: level}
+			n := a.newNode(ElementNode, "", level)
 			addNode(n)
-			parseValue(vv, n, level+1)
+			parseValue(vv, n, level+1, a)
 		}
 	case map[string]interface{}:
 		// The Go’s map iteration order is random.
@@ -133,38 +545,183 @@ func parseValue(x interface{}, top *Node, level int) {
 		}
 		sort.Strings(keys)
 		for _, key := range keys {
-			n := &Node{Data: key, Type: ElementNode, level: level}
+			n := a.newNode(ElementNode, key, level)
 			addNode(n)
-			parseValue(v[key], n, level+1)
+			parseValue(v[key], n, level+1, a)
 		}
 	case string:
 		top.ElType = StringNode
-		n := &Node{Data: v, Type: TextNode, level: level}
+		n := a.newNode(TextNode, v, level)
 		addNode(n)
 	case float64:
 		top.ElType = NumberNode
 		s := strconv.FormatFloat(v, 'f', -1, 64)
-		n := &Node{Data: s, Type: TextNode, level: level}
+		n := a.newNode(TextNode, s, level)
+		addNode(n)
+	case json.RawMessage:
+		// A pre-serialized fragment is parsed into a subtree, or kept as a
+		// string if it is not valid JSON.
+		var vv interface{}
+		if err := json.Unmarshal(v, &vv); err != nil {
+			vv = string(v)
+		}
+		parseValue(vv, top, level, a)
+	case map[string]json.RawMessage:
+		m := make(map[string]interface{}, len(v))
+		for key, vv := range v {
+			m[key] = vv
+		}
+		parseValue(m, top, level, a)
+	case int64:
+		top.ElType = NumberNode
+		s := strconv.FormatInt(v, 10)
+		n := a.newNode(TextNode, s, level)
 		addNode(n)
 	case bool:
 		top.ElType = BooleanNode
 		s := strconv.FormatBool(v)
-		n := &Node{Data: s, Type: TextNode, level: level}
+		n := a.newNode(TextNode, s, level)
 		addNode(n)
+	case nil:
+		top.ElType = NullNode
+	case hookedNumber:
+		top.ElType = v.typ
+		if v.typ != NullNode {
+			n := a.newNode(TextNode, v.text, level)
+			addNode(n)
+		}
+	}
+}
+
+// A ParseOption configures how Parse creates nodes.
+type ParseOption func(*parseOptions)
+
+type parseOptions struct {
+	numberHook   func(literal string) (interface{}, ElementType)
+	keyTransform func(string) string
+}
+
+// WithNumberHook makes Parse call hook with the literal of every number
+// of the document, such as "1.50" or "1e3". The value returned by hook
+// becomes the text of the node and vtype its ElementType, so a number
+// can be materialized as a string or rounded, for example. A string value
+// is used as is and other values are formatted with fmt.Sprint; the
+// value of a NullNode is ignored. Without a hook numbers are parsed as
+// float64 values.
+func WithNumberHook(hook func(literal string) (value interface{}, vtype ElementType)) ParseOption {
+	return func(o *parseOptions) {
+		o.numberHook = hook
+	}
+}
+
+// WithKeyTransform makes Parse replace every object key of the document
+// by the result of transform, such as strings.ToLower to normalize keys
+// with inconsistent casing. The transformed keys are the names of the
+// element nodes, so SelectElement and queries must use them instead of
+// the original keys. If several keys of an object transform to the same
+// key, the member with the greatest original key is kept.
+func WithKeyTransform(transform func(key string) string) ParseOption {
+	return func(o *parseOptions) {
+		o.keyTransform = transform
+	}
+}
+
+// applyKeyTransform replaces the keys of the objects in v by the keys
+// returned by transform.
+func applyKeyTransform(v interface{}, transform func(string) string) interface{} {
+	switch v := v.(type) {
+	case []interface{}:
+		for i, vv := range v {
+			v[i] = applyKeyTransform(vv, transform)
+		}
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		m := make(map[string]interface{}, len(v))
+		for _, key := range keys {
+			m[transform(key)] = applyKeyTransform(v[key], transform)
+		}
+		return m
 	}
+	return v
 }
 
-func parse(b []byte) (*Node, error) {
+// hookedNumber is a number materialized by a number hook.
+type hookedNumber struct {
+	text string
+	typ  ElementType
+}
+
+// applyNumberHook replaces the json.Number values in v by the values
+// returned by hook.
+func applyNumberHook(v interface{}, hook func(string) (interface{}, ElementType)) interface{} {
+	switch v := v.(type) {
+	case json.Number:
+		x, typ := hook(string(v))
+		if typ == MapNode || typ == ArrayNode {
+			return x
+		}
+		text, ok := x.(string)
+		if !ok {
+			text = fmt.Sprint(x)
+		}
+		return hookedNumber{text: text, typ: typ}
+	case []interface{}:
+		for i, vv := range v {
+			v[i] = applyNumberHook(vv, hook)
+		}
+	case map[string]interface{}:
+		for key, vv := range v {
+			v[key] = applyNumberHook(vv, hook)
+		}
+	}
+	return v
+}
+
+func parse(b []byte, opts ...ParseOption) (*Node, error) {
+	var o parseOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
 	var v interface{}
-	if err := json.Unmarshal(b, &v); err != nil {
+	if o.numberHook != nil {
+		d := json.NewDecoder(bytes.NewReader(b))
+		d.UseNumber()
+		if err := d.Decode(&v); err != nil {
+			return nil, err
+		}
+		if _, err := d.Token(); err != io.EOF {
+			return nil, errors.New("invalid character after top-level value")
+		}
+		v = applyNumberHook(v, o.numberHook)
+	} else if err := json.Unmarshal(b, &v); err != nil {
 		return nil, err
 	}
+	if o.keyTransform != nil {
+		v = applyKeyTransform(v, o.keyTransform)
+	}
 	doc := &Node{Type: DocumentNode}
-	parseValue(v, doc, 1)
+	parseValue(v, doc, 1, nil)
 	return doc, nil
 }
 
-func convertNode(n *Node) (dst interface{}) {
+// depthPlaceholders replace the objects and arrays beyond the maximum
+// depth of ConvertNodeToInterfaceDepth.
+var depthPlaceholders = map[ElementType]string{
+	MapNode:   "{…}",
+	ArrayNode: "[…]",
+}
+
+// convertNodeDepth converts n as ConvertNodeToInterface but replaces the objects and
+// arrays maxDepth levels or more below n by placeholders, unless
+// maxDepth < 0.
+func convertNodeDepth(n *Node, maxDepth int) (dst interface{}) {
+	if p, ok := depthPlaceholders[n.ElType]; ok && maxDepth == 0 {
+		return p
+	}
 
 	switch n.ElType {
 	case MapNode:
@@ -179,7 +736,7 @@ func convertNode(n *Node) (dst interface{}) {
 	}
 
 	for nn := n.FirstChild; nn != nil; nn = nn.NextSibling {
-		childNode := convertNode(nn)
+		childNode := convertNodeDepth(nn, maxDepth-1)
 
 		switch n.ElType {
 		case MapNode:
@@ -196,12 +753,173 @@ func convertNode(n *Node) (dst interface{}) {
 	return
 }
 
+// convertNodeTyped converts n as ConvertNodeToInterface but keeps the
+// JSON type of values.
+func convertNodeTyped(n *Node) interface{} {
+	return convertNodeOptions(n, MarshalOptions{}, -1)
+}
+
+// convertNodeOptions is like convertNodeTyped but configured by o, and
+// replaces the objects and arrays maxDepth levels or more below n by
+// placeholders, unless maxDepth < 0.
+func convertNodeOptions(n *Node, o MarshalOptions, maxDepth int) interface{} {
+	if n.Type == TextNode {
+		return n.Data
+	}
+	if p, ok := depthPlaceholders[n.ElType]; ok && maxDepth == 0 {
+		return p
+	}
+	switch n.ElType {
+	case ArrayNode:
+		a := []interface{}{}
+		for nn := n.FirstChild; nn != nil; nn = nn.NextSibling {
+			a = append(a, convertNodeOptions(nn, o, maxDepth-1))
+		}
+		return a
+	case StringNode:
+		return n.InnerText()
+	case NumberNode:
+		return json.Number(n.InnerText())
+	case BooleanNode:
+		return n.InnerText() == "true"
+	case NullNode:
+		return nil
+	}
+	m := map[string]interface{}{}
+	for nn := n.FirstChild; nn != nil; nn = nn.NextSibling {
+		m[nn.Data] = convertNodeOptions(nn, o, maxDepth-1)
+	}
+	if o.EmitNullForDeleted {
+		for _, name := range n.deletedMembers() {
+			if _, ok := m[name]; !ok {
+				m[name] = nil
+			}
+		}
+	}
+	return m
+}
+
+// ToJSON returns the compact JSON encoding of n and all its child nodes.
+func (n *Node) ToJSON() ([]byte, error) {
+	return json.Marshal(convertNodeTyped(n))
+}
+
+// MarshalOptions configures Node.Marshal.
+type MarshalOptions struct {
+	// EmitNullForDeleted encodes the members deleted from an object with
+	// Node.Delete, or removed by ApplyPatch and ApplyMergePatch, as null
+	// members instead of omitting them, for PATCH requests to APIs that
+	// tell null from absent members. A member added again after its
+	// deletion is encoded with its new value.
+	EmitNullForDeleted bool
+}
+
+// Marshal is like ToJSON but configured by opts.
+func (n *Node) Marshal(opts MarshalOptions) ([]byte, error) {
+	return json.Marshal(convertNodeOptions(n, opts, -1))
+}
+
+// String returns the compact JSON encoding of n, or "<json error>" if n
+// cannot be encoded.
+func (n *Node) String() string {
+	b, err := n.ToJSON()
+	if err != nil {
+		return "<json error>"
+	}
+	return string(b)
+}
+
+// GoString returns a Go expression that reconstructs n, as a call to
+// MustParse with the JSON encoding of n, for use with the %#v format.
+func (n *Node) GoString() string {
+	b, err := n.ToJSON()
+	if err != nil {
+		return "<json error>"
+	}
+	if strings.Contains(string(b), "`") {
+		return "jsonquery.MustParse(" + strconv.Quote(string(b)) + ")"
+	}
+	return "jsonquery.MustParse(`" + string(b) + "`)"
+}
+
+// ConvertNodeToInterface converts n to the value json.Unmarshal would
+// decode from its encoding, except that numbers and booleans are
+// converted to strings, such as "45" and "true". Use
+// ConvertNodeToInterfaceTyped to keep their types.
 func ConvertNodeToInterface(n *Node) (dst interface{}) {
-	dst = convertNode(n)
-	return
+	return ConvertNodeWithOptions(n, ConvertOptions{})
 }
 
-func prependParents(n *Node, ni interface{}) interface{} {
+// ConvertNodeToInterfaceTyped is like ConvertNodeToInterface but keeps
+// the JSON type of values, like json.Unmarshal: numbers are converted to
+// float64, booleans to bool and null to nil. A number that a float64
+// cannot hold exactly, such as a large integer parsed with
+// WithNumberHook, is converted to a json.Number holding its text.
+func ConvertNodeToInterfaceTyped(n *Node) interface{} {
+	return ConvertNodeWithOptions(n, ConvertOptions{Typed: true})
+}
+
+// floatNumbers replaces the json.Number values in v, as returned by
+// convertNodeTyped, with float64 values when they are exact.
+func floatNumbers(v interface{}) interface{} {
+	switch v := v.(type) {
+	case json.Number:
+		f, err := strconv.ParseFloat(string(v), 64)
+		if err == nil && strconv.FormatFloat(f, 'f', -1, 64) == string(v) {
+			return f
+		}
+	case []interface{}:
+		for i, vv := range v {
+			v[i] = floatNumbers(vv)
+		}
+	case map[string]interface{}:
+		for k, vv := range v {
+			v[k] = floatNumbers(vv)
+		}
+	}
+	return v
+}
+
+// ConvertNodeToInterfaceDepth is like ConvertNodeToInterface but
+// replaces the objects and arrays maxDepth levels or more below n with
+// the placeholders "{…}" and "[…]", to preview large documents. Scalars
+// are converted at any depth.
+func ConvertNodeToInterfaceDepth(n *Node, maxDepth int) interface{} {
+	if maxDepth < 0 {
+		maxDepth = 0
+	}
+	return convertNodeDepth(n, maxDepth)
+}
+
+// ConvertNodeToInterfaceCollapseSingletons is like ConvertNodeToInterface
+// but replaces every array with exactly one item by that item, as some
+// XML to JSON conventions do. Since it is lossy, a single item array and
+// its item cannot be told apart.
+func ConvertNodeToInterfaceCollapseSingletons(n *Node) interface{} {
+	return ConvertNodeWithOptions(n, ConvertOptions{CollapseSingletons: true})
+}
+
+func collapseSingletons(v interface{}) interface{} {
+	switch v := v.(type) {
+	case []interface{}:
+		if len(v) == 1 {
+			return collapseSingletons(v[0])
+		}
+		for i, vv := range v {
+			v[i] = collapseSingletons(vv)
+		}
+	case map[string]interface{}:
+		for key, vv := range v {
+			v[key] = collapseSingletons(vv)
+		}
+	}
+	return v
+}
+
+// prependParents wraps ni, the value of n, in the values of the ancestors
+// of n holding only it. Arrays hold it at its index, after nulls, if
+// keys is not nil.
+func prependParents(n *Node, ni interface{}, keys keyer) interface{} {
 	parent := n.Parent
 	if parent != nil {
 		var dst interface{}
@@ -213,9 +931,14 @@ func prependParents(n *Node, ni interface{}) interface{} {
 			dst = pi
 		case ArrayNode:
 			ai := []interface{}{ni}
+			if keys != nil {
+				i, _ := strconv.Atoi(keys.key(n))
+				ai = make([]interface{}, i+1)
+				ai[i] = ni
+			}
 			dst = ai
 		}
-		p := prependParents(n.Parent, dst)
+		p := prependParents(n.Parent, dst, keys)
 		return p
 	} else {
 		return ni
@@ -223,32 +946,168 @@ func prependParents(n *Node, ni interface{}) interface{} {
 }
 
 func ConvertNodesToInterface(ndes []*Node, prefixParents bool) (dst interface{}) {
-	d := []interface{}{}
-	for _, n := range ndes {
-		child := ConvertNodeToInterface(n)
-		if prefixParents {
-			child = prependParents(n, child)
-		}
-		d = append(d, child)
+	return ConvertNodesWithOptions(ndes, ConvertOptions{FullPath: prefixParents})
+}
+
+// ConvertOptions configures ConvertNodeWithOptions and
+// ConvertNodesWithOptions.
+type ConvertOptions struct {
+	// Typed keeps the JSON type of values, as ConvertNodeToInterfaceTyped
+	// does, instead of converting numbers and booleans to strings.
+	Typed bool
+	// FullPath wraps the value of a node in the objects and arrays of its
+	// ancestors, each holding only the value of its child on the path to
+	// the node, such as {"top":{"people":[{"name":"joe"}]}} for the name
+	// of the first person.
+	FullPath bool
+	// IncludeArrayIndex keeps the index of a node in the arrays of the
+	// path of FullPath, by preceding it with nulls, such as
+	// {"top":{"people":[null,{"name":"mark"}]}} for the name of the
+	// second person.
+	IncludeArrayIndex bool
+	// MaxDepth replaces the objects and arrays MaxDepth levels or more
+	// below the node by placeholders, as ConvertNodeToInterfaceDepth
+	// does, if positive.
+	MaxDepth int
+	// CollapseSingletons replaces every array with exactly one item by
+	// that item, as ConvertNodeToInterfaceCollapseSingletons does. The
+	// arrays of the path of FullPath are not collapsed.
+	CollapseSingletons bool
+}
+
+// ConvertNodeWithOptions converts n to a value such as json.Unmarshal
+// decodes, configured by opts. The zero ConvertOptions converts as
+// ConvertNodeToInterface.
+func ConvertNodeWithOptions(n *Node, opts ConvertOptions) interface{} {
+	var keys keyer
+	if opts.IncludeArrayIndex {
+		keys = make(keyer)
 	}
+	return convertNodeWithOptions(n, opts, keys)
+}
 
-	dst = d
-	return
+// convertNodeWithOptions is ConvertNodeWithOptions, taking the indexes of
+// array items from keys if IncludeArrayIndex is set.
+func convertNodeWithOptions(n *Node, opts ConvertOptions, keys keyer) interface{} {
+	maxDepth := -1
+	if opts.MaxDepth > 0 {
+		maxDepth = opts.MaxDepth
+	}
+	var v interface{}
+	if opts.Typed {
+		v = floatNumbers(convertNodeOptions(n, MarshalOptions{}, maxDepth))
+	} else {
+		v = convertNodeDepth(n, maxDepth)
+	}
+	if opts.CollapseSingletons {
+		v = collapseSingletons(v)
+	}
+	if opts.FullPath {
+		v = prependParents(n, v, keys)
+	}
+	return v
 }
 
+// ConvertNodesWithOptions converts each of nodes as
+// ConvertNodeWithOptions.
+func ConvertNodesWithOptions(nodes []*Node, opts ConvertOptions) []interface{} {
+	var keys keyer
+	if opts.IncludeArrayIndex {
+		keys = make(keyer)
+	}
+	a := []interface{}{}
+	for _, n := range nodes {
+		a = append(a, convertNodeWithOptions(n, opts, keys))
+	}
+	return a
+}
+
+// ParseTree creates a Node tree from v, a value such as produced by
+// json.Unmarshal into an interface{}. json.RawMessage values are parsed
+// into subtrees.
 func ParseTree(v interface{}) *Node {
 
 	doc := &Node{Type: DocumentNode}
-	parseValue(v, doc, 1)
+	parseValue(v, doc, 1, nil)
+
+	return doc
+}
+
+// ParseFromValue creates a Node tree from any Go value that can be
+// marshaled by json.Marshal, such as a struct with JSON tags, a map with
+// integer keys or a slice. The tree is the same as the one parsed from
+// the JSON encoding of v.
+func ParseFromValue(v interface{}) (*Node, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return parse(b)
+}
 
+// CombineDocuments returns a document whose root is an array holding a
+// copy of each of docs in turn, so they can be queried together, such as
+// with `//name` or `/*[2]//name`. Matches come in the order of docs. docs
+// are not changed.
+func CombineDocuments(docs ...*Node) *Node {
+	root := &Node{Type: DocumentNode, ElType: ArrayNode}
+	for _, doc := range docs {
+		item := &Node{Type: ElementNode}
+		appendChild(root, item)
+		replaceValue(item, doc.Clone())
+	}
+	return root
+}
+
+// MustParse is like Parse but parses the JSON document s and panics if
+// it cannot be parsed. It simplifies safe initialization of global
+// variables and tests holding JSON literals.
+func MustParse(s string) *Node {
+	doc, err := Parse(strings.NewReader(s))
+	if err != nil {
+		panic(`jsonquery: MustParse(` + strconv.Quote(s) + `): ` + err.Error())
+	}
 	return doc
 }
 
 // Parse JSON document.
-func Parse(r io.Reader) (*Node, error) {
+func Parse(r io.Reader, opts ...ParseOption) (*Node, error) {
 	b, err := ioutil.ReadAll(r)
 	if err != nil {
 		return nil, err
 	}
-	return parse(b)
+	return parse(b, opts...)
+}
+
+// ParseDocuments parses a JSON array whose items are documents of their
+// own, such as a batch of records, and returns a document for each item.
+// The items are decoded one after the other, without keeping the
+// encoding of the whole array in memory.
+// Return an error if the JSON value is not an array or is invalid.
+func ParseDocuments(r io.Reader) ([]*Node, error) {
+	d := json.NewDecoder(r)
+	t, err := d.Token()
+	if err != nil {
+		return nil, err
+	}
+	if t != json.Delim('[') {
+		return nil, fmt.Errorf("expected an array of documents but %v", t)
+	}
+	docs := []*Node{}
+	for d.More() {
+		var v interface{}
+		if err := d.Decode(&v); err != nil {
+			return nil, err
+		}
+		doc := &Node{Type: DocumentNode}
+		parseValue(v, doc, 1, nil)
+		docs = append(docs, doc)
+	}
+	if _, err := d.Token(); err != nil {
+		return nil, err
+	}
+	if _, err := d.Token(); err != io.EOF {
+		return nil, errors.New("invalid character after top-level value")
+	}
+	return docs, nil
 }
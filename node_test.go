@@ -2,7 +2,11 @@ package jsonquery
 
 import (
 	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
 	"sort"
+	"strconv"
 	"strings"
 	"testing"
 
@@ -246,8 +250,112 @@ func TestConvert(t *testing.T) {
 	assert.Equal(t, string(outbytes), exp)
 }
 
-func TestQueryConvert(t *testing.T) {
-	config := `
+func TestConvertNull(t *testing.T) {
+	// JSON null converts to nil, not to an empty object.
+	doc, err := parseString(`{"a":null,"b":[null,1]}`)
+	assert.Nil(t, err)
+	assert.Equal(t, NullNode, doc.SelectElement("a").ElType)
+	outbytes, err := json.Marshal(ConvertNodeToInterface(doc))
+	assert.Nil(t, err)
+	assert.Equal(t, `{"a":null,"b":[null,"1"]}`, string(outbytes))
+}
+
+func TestConvertNodeToInterfaceTyped(t *testing.T) {
+	for _, src := range []string{
+		testConfig,
+		`{"s":"45","n":45,"f":-1.5e-7,"big":12345678901234567890,"t":true,"false":false,"null":null,"a":[[],{},"",0]}`,
+		`[1,"1",true,null]`,
+		`"text"`,
+	} {
+		var v interface{}
+		if err := json.Unmarshal([]byte(src), &v); err != nil {
+			t.Fatal(err)
+		}
+		e, _ := json.MarshalIndent(v, "", "  ")
+		doc, err := parseString(src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		g, err := json.MarshalIndent(ConvertNodeToInterfaceTyped(doc), "", "  ")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(e) != string(g) {
+			t.Fatalf("expected %s but %s", e, g)
+		}
+	}
+	m := ConvertNodeToInterfaceTyped(MustParse(`{"n":45,"t":true,"z":null}`)).(map[string]interface{})
+	if m["n"] != float64(45) || m["t"] != true || m["z"] != nil {
+		t.Fatalf("unexpected types %#v", m)
+	}
+	big, _ := Parse(strings.NewReader(`[12345678901234567890, 1]`), WithNumberHook(func(literal string) (interface{}, ElementType) {
+		return literal, NumberNode
+	}))
+	if e, g := []interface{}{json.Number("12345678901234567890"), float64(1)}, ConvertNodeToInterfaceTyped(big); !reflect.DeepEqual(e, g) {
+		t.Fatalf("expected %#v but %#v", e, g)
+	}
+	// The legacy conversion is unchanged.
+	if e, g := "45", ConvertNodeToInterface(MustParse(`45`)); e != g {
+		t.Fatalf("expected %v but %v", e, g)
+	}
+}
+
+func TestConvertNodeWithOptions(t *testing.T) {
+	doc, _ := parseString(testConfig)
+	marshal := func(v interface{}) string {
+		b, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(b)
+	}
+	mark := FindOne(doc, "//people/*[2]")
+	for _, test := range []struct {
+		opts ConvertOptions
+		want string
+	}{
+		{ConvertOptions{}, `{"age":"2","name":"mark"}`},
+		{ConvertOptions{Typed: true}, `{"age":2,"name":"mark"}`},
+		{ConvertOptions{FullPath: true}, `{"top":{"people":[{"age":"2","name":"mark"}]}}`},
+		{ConvertOptions{FullPath: true, IncludeArrayIndex: true}, `{"top":{"people":[null,{"age":"2","name":"mark"}]}}`},
+		{ConvertOptions{Typed: true, FullPath: true, IncludeArrayIndex: true}, `{"top":{"people":[null,{"age":2,"name":"mark"}]}}`},
+		{ConvertOptions{IncludeArrayIndex: true}, `{"age":"2","name":"mark"}`},
+	} {
+		if g := marshal(ConvertNodeWithOptions(mark, test.opts)); g != test.want {
+			t.Fatalf("%+v: expected %s but %s", test.opts, test.want, g)
+		}
+	}
+
+	sites := FindOne(doc, "//sites")
+	for _, test := range []struct {
+		opts ConvertOptions
+		want string
+	}{
+		{ConvertOptions{MaxDepth: 2}, `[{"ri1":"{…}","ri2":"{…}","ri3":"{…}"}]`},
+		{ConvertOptions{MaxDepth: 5, Typed: true}, `[{"ri1":{"ospf":{"areas":["{…}"]}},"ri2":{"ospf":{"areas":["{…}"]}},"ri3":{"ospf":{"areas":["{…}"]}}}]`},
+		{ConvertOptions{MaxDepth: 4, CollapseSingletons: true, FullPath: true}, `{"top":{"sites":{"ri1":{"ospf":{"areas":"[…]"}},"ri2":{"ospf":{"areas":"[…]"}},"ri3":{"ospf":{"areas":"[…]"}}}}}`},
+		{ConvertOptions{Typed: true, CollapseSingletons: true}, `{"ri1":{"ospf":{"areas":{"area_id":"0.0.0.0","metric":0}}},"ri2":{"ospf":{"areas":{"area_id":"0.0.0.1","metric":1}}},"ri3":{"ospf":{"areas":{"area_id":"0.0.0.2","metric":2}}}}`},
+	} {
+		if g := marshal(ConvertNodeWithOptions(sites, test.opts)); g != test.want {
+			t.Fatalf("%+v: expected %s but %s", test.opts, test.want, g)
+		}
+	}
+
+	names := Find(doc, "//name")
+	e := `[{"top":{"people":[{"name":"joe"}]}},{"top":{"people":[null,{"name":"mark"}]}}]`
+	if g := marshal(ConvertNodesWithOptions(names, ConvertOptions{FullPath: true, IncludeArrayIndex: true})); g != e {
+		t.Fatalf("expected %s but %s", e, g)
+	}
+	if e, g := marshal(ConvertNodesToInterface(names, true)), marshal(ConvertNodesWithOptions(names, ConvertOptions{FullPath: true})); e != g {
+		t.Fatalf("expected %s but %s", e, g)
+	}
+	if g := ConvertNodesWithOptions(nil, ConvertOptions{}); g == nil || len(g) != 0 {
+		t.Fatalf("expected an empty slice but %#v", g)
+	}
+}
+
+// testConfig is the document used by the query tests.
+const testConfig = `
 {
     "top" : {
 	"inner" : [ 0,1,2,3 ],
@@ -305,6 +413,9 @@ func TestQueryConvert(t *testing.T) {
     }
 }
 `
+
+func TestQueryConvert(t *testing.T) {
+	config := testConfig
 	queryInOutExp := func(t *testing.T, config, query, exp string, fullPath bool) {
 		t.Helper()
 
@@ -446,3 +557,566 @@ func TestQueryConvert(t *testing.T) {
 	queryInOutExp(t, config, `//sites/*//*[area_id != "0.0.0.1"]`, exp, true)
 
 }
+
+func TestQueryUnionConvert(t *testing.T) {
+	doc, err := parseString(testConfig)
+	assert.Nil(t, err)
+
+	// Both operand orders give the same document-ordered node set.
+	for _, expr := range []string{
+		"//route-instance/*/metric | //sites//areas/*/metric",
+		"//sites//areas/*/metric | //route-instance/*/metric | //ri2/metric",
+	} {
+		nodes, err := QueryAll(doc, expr)
+		assert.Nil(t, err)
+		var a []string
+		for _, n := range nodes {
+			a = append(a, n.InnerText())
+		}
+		assert.Equal(t, "24,89,0,1,2", strings.Join(a, ","), expr)
+
+		b, err := json.Marshal(ConvertNodesToInterface(nodes, false))
+		assert.Nil(t, err)
+		assert.Equal(t, `["24","89","0","1","2"]`, string(b))
+
+		b, err = json.Marshal(ConvertNodesToInterface(nodes, true))
+		assert.Nil(t, err)
+		assert.Equal(t, `[{"top":{"route-instance":{"ri1":{"metric":"24"}}}},`+
+			`{"top":{"route-instance":{"ri2":{"metric":"89"}}}},`+
+			`{"top":{"sites":[{"ri1":{"ospf":{"areas":[{"metric":"0"}]}}}]}},`+
+			`{"top":{"sites":[{"ri2":{"ospf":{"areas":[{"metric":"1"}]}}}]}},`+
+			`{"top":{"sites":[{"ri3":{"ospf":{"areas":[{"metric":"2"}]}}}]}}]`, string(b))
+	}
+}
+
+func TestNodeString(t *testing.T) {
+	s := `{
+		"name": "John",
+		"age": 31,
+		"married": false,
+		"cars": [ { "name": "Ford", "models": [ "Fiesta", "Focus" ] } ]
+	}`
+	doc, err := parseString(s)
+	assert.Nil(t, err)
+	assert.Equal(t, `{"age":31,"cars":[{"models":["Fiesta","Focus"],"name":"Ford"}],"married":false,"name":"John"}`, doc.String())
+	assert.Equal(t, `["Fiesta","Focus"]`, fmt.Sprintf("%s", FindOne(doc, "//models")))
+	assert.Equal(t, `"John"`, fmt.Sprint(doc.SelectElement("name")))
+	assert.Equal(t, `31`, doc.SelectElement("age").String())
+
+	n := &Node{Type: ElementNode, ElType: NumberNode}
+	appendChild(n, &Node{Type: TextNode, Data: "abc"})
+	assert.Equal(t, "<json error>", n.String())
+}
+
+func TestParseFromValue(t *testing.T) {
+	type address struct {
+		City string `json:"city"`
+		Zip  string `json:"zip,omitempty"`
+	}
+	type person struct {
+		Name    string          `json:"name"`
+		Age     int             `json:"age"`
+		Admin   bool            `json:"admin"`
+		Address *address        `json:"address"`
+		Scores  map[int]float64 `json:"scores"`
+		Tags    []string        `json:"tags"`
+		secret  string
+	}
+	doc, err := ParseFromValue([]person{
+		{Name: "joe", Age: 45, Address: &address{City: "Oslo"}, Scores: map[int]float64{1: 2.5}, Tags: []string{"a"}},
+		{Name: "mark", Age: 2, Admin: true, secret: "x"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := `[{"address":{"city":"Oslo"},"admin":false,"age":45,"name":"joe","scores":{"1":2.5},"tags":["a"]},` +
+		`{"address":null,"admin":true,"age":2,"name":"mark","scores":null,"tags":null}]`
+	if g := doc.String(); g != e {
+		t.Fatalf("expected %v but %v", e, g)
+	}
+	if v, err := ValueOf(doc, "//*[age > 10]/address/city"); err != nil || v != "Oslo" {
+		t.Fatalf("expected Oslo but %q, %v", v, err)
+	}
+
+	doc, err = ParseFromValue(42)
+	if err != nil || doc.ElType != NumberNode || doc.InnerText() != "42" {
+		t.Fatalf("expected number 42 but %v, %v", doc, err)
+	}
+	if _, err := ParseFromValue(make(chan int)); err == nil {
+		t.Fatal("expected error for a channel")
+	}
+}
+
+func TestCombineDocuments(t *testing.T) {
+	a := MustParse(`{"name":"joe","friends":[{"name":"ann"}]}`)
+	b := MustParse(`[{"name":"mark"},{"id":1}]`)
+	c := MustParse(`"text"`)
+	doc := CombineDocuments(a, b, c)
+	if e, g := `[{"friends":[{"name":"ann"}],"name":"joe"},[{"name":"mark"},{"id":1}],"text"]`, doc.String(); e != g {
+		t.Fatalf("expected %v but %v", e, g)
+	}
+	var names []string
+	for _, n := range Find(doc, "//name") {
+		names = append(names, n.InnerText())
+	}
+	if e, g := "ann joe mark", strings.Join(names, " "); e != g {
+		t.Fatalf("expected %v but %v", e, g)
+	}
+	if e, g := "mark", FindOne(doc, "/*[2]//name").InnerText(); e != g {
+		t.Fatalf("expected %v but %v", e, g)
+	}
+	if e, g := `{"friends":[{"name":"ann"}],"name":"joe"}`, a.String(); e != g {
+		t.Fatalf("expected %v but %v", e, g)
+	}
+	if a.SelectElement("name").Parent != a {
+		t.Fatal("expected the documents unchanged")
+	}
+}
+
+func TestParseDocuments(t *testing.T) {
+	docs, err := ParseDocuments(strings.NewReader(`[{"name":"joe","age":45}, {"name":"mark"}, {"name":"ann","tags":["a"]}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(docs) != 3 {
+		t.Fatalf("expected 3 documents but %d", len(docs))
+	}
+	for i, e := range []string{`{"age":45,"name":"joe"}`, `{"name":"mark"}`, `{"name":"ann","tags":["a"]}`} {
+		if docs[i].Type != DocumentNode || docs[i].Parent != nil || docs[i].NextSibling != nil {
+			t.Fatalf("expected document %d to be a root", i)
+		}
+		if g := docs[i].String(); e != g {
+			t.Fatalf("expected %v but %v", e, g)
+		}
+	}
+	if e, g := "ann", FindOne(docs[2], "/name").InnerText(); e != g {
+		t.Fatalf("expected %v but %v", e, g)
+	}
+	if docs, err := ParseDocuments(strings.NewReader(` [] `)); err != nil || len(docs) != 0 {
+		t.Fatalf("expected no documents but %v, %v", docs, err)
+	}
+	for _, s := range []string{`{"a":1}`, `[{"a":1},`, `[1] [2]`, ``} {
+		if _, err := ParseDocuments(strings.NewReader(s)); err == nil {
+			t.Fatalf("%s: expected error", s)
+		}
+	}
+}
+
+func TestParseTreeRawMessage(t *testing.T) {
+	tree := map[string]interface{}{
+		"name": "joe",
+		"car":  json.RawMessage(`{"name": "Ford", "models": ["Fiesta", "Focus"], "year": 2010}`),
+		"bad":  json.RawMessage(`{`),
+	}
+	doc := ParseTree(tree)
+	car := doc.SelectElement("car")
+	assert.Equal(t, MapNode, car.ElType)
+	assert.Equal(t, "Ford", FindOne(doc, "car/name").InnerText())
+	assert.Equal(t, 2, len(Find(doc, "car/models/*")))
+	assert.Equal(t, NumberNode, FindOne(doc, "car/year").ElType)
+	assert.Equal(t, StringNode, doc.SelectElement("bad").ElType)
+	assert.Equal(t, `{"bad":"{","car":{"models":["Fiesta","Focus"],"name":"Ford","year":2010},"name":"joe"}`, doc.String())
+
+	var raw map[string]json.RawMessage
+	assert.Nil(t, json.Unmarshal([]byte(`{"a": [1, 2], "b": {"c": true}}`), &raw))
+	doc = ParseTree(raw)
+	assert.Equal(t, `{"a":[1,2],"b":{"c":true}}`, doc.String())
+}
+
+func TestNodeGoString(t *testing.T) {
+	doc := MustParse(`{"name": "John", "tags": ["a", "b"]}`)
+	s := fmt.Sprintf("%#v", doc)
+	assert.Equal(t, "jsonquery.MustParse(`{\"name\":\"John\",\"tags\":[\"a\",\"b\"]}`)", s)
+	assert.Equal(t, "jsonquery.MustParse(`[\"a\",\"b\"]`)", fmt.Sprintf("%#v", doc.SelectElement("tags")))
+
+	doc = MustParse("{\"quote\": \"`\"}")
+	assert.Equal(t, "jsonquery.MustParse(\"{\\\"quote\\\":\\\"`\\\"}\")", doc.GoString())
+
+}
+
+func TestMustParse(t *testing.T) {
+	doc := MustParse(`{"a": 1}`)
+	assert.Equal(t, "1", doc.SelectElement("a").InnerText())
+
+	assert.PanicsWithValue(t, `jsonquery: MustParse("{\"a\": }"): invalid character '}' looking for beginning of value`, func() {
+		MustParse(`{"a": }`)
+	})
+}
+
+func TestAncestors(t *testing.T) {
+	doc := MustParse(testConfig)
+	n := FindOne(doc, "//ri3//area_id")
+	var names []string
+	for _, a := range n.Ancestors() {
+		names = append(names, a.Data)
+	}
+	// The array items have no name.
+	assert.Equal(t, ",areas,ospf,ri3,,sites,top,", strings.Join(names, ","))
+	ancestors := n.Ancestors()
+	assert.Equal(t, n.Parent, ancestors[0])
+	assert.Equal(t, doc, ancestors[len(ancestors)-1])
+	assert.Equal(t, 0, len(doc.Ancestors()))
+}
+
+func TestRenameKey(t *testing.T) {
+	doc, _ := parseString(testConfig)
+	if n := RenameKey(doc, "metric", "cost"); n != 5 {
+		t.Fatalf("expected 5 keys renamed but %d", n)
+	}
+	if nodes := Find(doc, "//metric"); len(nodes) != 0 {
+		t.Fatalf("expected no metric but %v", nodes)
+	}
+	if sum, err := QueryAggregate(doc, "sum(//cost)"); err != nil || sum != 116 {
+		t.Fatalf("expected sum 116 but %v, %v", sum, err)
+	}
+	if g := FindOne(doc, "top/route-instance/ri2/cost"); g == nil || g.InnerText() != "89" {
+		t.Fatalf("expected ri2/cost 89 but %v", g)
+	}
+	if n := RenameKey(doc, "metric", "cost"); n != 0 {
+		t.Fatalf("expected no keys renamed but %d", n)
+	}
+
+	// Renamed members keep objects sorted, and members that would
+	// duplicate a key are left alone.
+	doc, _ = parseString(`{"a":{"b":1,"c":2,"x":3},"d":{"b":4,"y":5},"e":[{"b":6}]}`)
+	if n := RenameKey(doc, "b", "y"); n != 2 {
+		t.Fatalf("expected 2 keys renamed but %d", n)
+	}
+	if e, g := `{"a":{"c":2,"x":3,"y":1},"d":{"b":4,"y":5},"e":[{"y":6}]}`, doc.String(); e != g {
+		t.Fatalf("expected %v but %v", e, g)
+	}
+	var keys []string
+	for _, c := range doc.SelectElement("a").ChildNodes() {
+		keys = append(keys, c.Data)
+	}
+	if e, g := "c,x,y", strings.Join(keys, ","); e != g {
+		t.Fatalf("expected %v but %v", e, g)
+	}
+	if e, g := "3", FindOne(doc, "a/y/preceding-sibling::*[1]").InnerText(); e != g {
+		t.Fatalf("expected %v but %v", e, g)
+	}
+}
+
+func TestForEach(t *testing.T) {
+	doc, _ := parseString(`{"b":[10,"x",{"c":1}],"a":true}`)
+	var keys []string
+	doc.ForEach(func(key string, child *Node) {
+		keys = append(keys, key+"="+child.InnerText())
+	})
+	if g, e := strings.Join(keys, " "), "a=true b=10x1"; g != e {
+		t.Fatalf("expected %q but %q", e, g)
+	}
+	keys = nil
+	doc.SelectElement("b").ForEach(func(key string, child *Node) {
+		keys = append(keys, key+"="+child.InnerText())
+	})
+	if g, e := strings.Join(keys, " "), "0=10 1=x 2=1"; g != e {
+		t.Fatalf("expected %q but %q", e, g)
+	}
+	doc.SelectElement("a").ForEach(func(key string, child *Node) {
+		t.Fatalf("unexpected call for scalar child %q", key)
+	})
+}
+
+func TestEachChild(t *testing.T) {
+	doc, _ := parseString(`{"a":1,"b":[1,2],"c":"x","d":null}`)
+	var names []string
+	doc.EachChild(func(c *Node) bool {
+		names = append(names, c.Data)
+		return true
+	})
+	if e, g := strings.Join(names, " "), "a b c d"; g != e {
+		t.Fatalf("expected %q but %q", e, g)
+	}
+	names = nil
+	doc.EachChild(func(c *Node) bool {
+		names = append(names, c.Data)
+		return c.Data != "b"
+	})
+	if e, g := strings.Join(names, " "), "a b"; g != e {
+		t.Fatalf("expected %q but %q", e, g)
+	}
+	doc.EachChild(func(c *Node) bool {
+		if c.Data != "c" {
+			c.Delete()
+		}
+		return true
+	})
+	if e, g := `{"c":"x"}`, doc.String(); e != g {
+		t.Fatalf("expected %v but %v", e, g)
+	}
+	count := 0
+	if allocs := testing.AllocsPerRun(10, func() {
+		doc.EachChild(func(c *Node) bool {
+			count++
+			return true
+		})
+	}); allocs != 0 {
+		t.Fatalf("expected no allocation but %v", allocs)
+	}
+}
+
+func TestNodeFind(t *testing.T) {
+	doc, _ := parseString(testConfig)
+	even := func(n *Node) bool {
+		if n.ElType != NumberNode {
+			return false
+		}
+		i, err := strconv.Atoi(n.InnerText())
+		return err == nil && i%2 == 0
+	}
+	var values []string
+	for _, n := range doc.FindAll(even) {
+		values = append(values, nodePointer(n)+"="+n.InnerText())
+	}
+	e := "/top/inner/0=0 /top/inner/2=2 /top/people/1/age=2 /top/route-instance/ri1/metric=24 /top/sites/0/ri1/ospf/areas/0/metric=0 /top/sites/0/ri3/ospf/areas/0/metric=2"
+	if g := strings.Join(values, " "); e != g {
+		t.Fatalf("expected %v but %v", e, g)
+	}
+	if n := doc.Find(even); n == nil || nodePointer(n) != "/top/inner/0" {
+		t.Fatalf("expected /top/inner/0 but %v", n)
+	}
+	people := doc.Find(func(n *Node) bool { return n.Data == "people" })
+	if n := people.Find(even); n == nil || n.Parent.SelectElement("name").InnerText() != "mark" {
+		t.Fatalf("expected the age of mark but %v", n)
+	}
+	if n := doc.Find(func(n *Node) bool { return false }); n != nil {
+		t.Fatalf("expected nil but %v", n)
+	}
+	if g := people.FindAll(func(n *Node) bool { return n == people }); len(g) != 0 {
+		t.Fatalf("expected n itself excluded but %v", g)
+	}
+}
+
+func TestDepth(t *testing.T) {
+	doc, _ := parseString(testConfig)
+	for expr, want := range map[string]int{
+		"/":                    0,
+		"/top":                 1,
+		"//people":             2,
+		"//people/*[1]":        3,
+		"//ri1/metric":         4,
+		"//ri1/metric/text()":  5,
+		"//areas/*/area_id":    8,
+		"//route-instance/ri2": 3,
+	} {
+		if g := FindOne(doc, expr).Depth(); g != want {
+			t.Fatalf("%s: expected depth %d but %d", expr, want, g)
+		}
+	}
+	doc, err := parse(deepJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := doc
+	for n.FirstChild != nil {
+		n = n.FirstChild
+	}
+	// The text of the innermost level member.
+	if g := n.Depth(); g != 1001 {
+		t.Fatalf("expected depth 1001 but %d", g)
+	}
+	if g := (&Node{}).Depth(); g != 0 {
+		t.Fatalf("expected depth 0 for a detached node but %d", g)
+	}
+}
+
+func TestNextPrevElement(t *testing.T) {
+	doc, _ := parseString(`{"a":1,"b":2,"c":3}`)
+	a, b, c := doc.SelectElement("a"), doc.SelectElement("b"), doc.SelectElement("c")
+	insertBefore(doc, &Node{Type: TextNode, Data: "x"}, b)
+	insertBefore(doc, &Node{Type: TextNode, Data: "y"}, b)
+	appendChild(doc, &Node{Type: TextNode, Data: "z"})
+	if a.NextSibling.Type != TextNode {
+		t.Fatal("expected a text node after a")
+	}
+	if g := a.NextElement(); g != b {
+		t.Fatalf("expected b after a but %v", g)
+	}
+	if g := b.PrevElement(); g != a {
+		t.Fatalf("expected a before b but %v", g)
+	}
+	if g := b.NextElement(); g != c {
+		t.Fatalf("expected c after b but %v", g)
+	}
+	if g := c.NextElement(); g != nil {
+		t.Fatalf("expected nothing after c but %v", g)
+	}
+	if g := a.PrevElement(); g != nil {
+		t.Fatalf("expected nothing before a but %v", g)
+	}
+}
+
+func TestSelectElementWildcard(t *testing.T) {
+	doc, _ := parseString(testConfig)
+	top := doc.SelectElement("*")
+	if top == nil || top.Data != "top" {
+		t.Fatalf("expected top but %v", top)
+	}
+	if n := top.SelectElement("*"); n == nil || n.Data != "inner" {
+		t.Fatalf("expected inner but %v", n)
+	}
+	if n := FindOne(doc, "//people").SelectElement("*"); n == nil || n.SelectElement("name").InnerText() != "joe" {
+		t.Fatalf("expected the first person but %v", n)
+	}
+	if n := top.SelectElement("ri*"); n != nil {
+		t.Fatalf("expected no pattern matching but %v", n)
+	}
+	if n := FindOne(doc, "//ri1/metric").SelectElement("*"); n != nil {
+		t.Fatalf("expected no element in a scalar but %v", n)
+	}
+
+	doc, _ = parseString(`{"a":1,"*":2}`)
+	if n := doc.SelectElement("*"); n == nil || n.Data != "*" {
+		t.Fatalf("expected the first member but %v", n)
+	}
+	if n, err := ResolvePointer(doc, "/*"); err != nil || n.InnerText() != "2" {
+		t.Fatalf("expected the member named * but %v, %v", n, err)
+	}
+}
+
+func TestHasChild(t *testing.T) {
+	doc, _ := parseString(testConfig)
+	top := FindOne(doc, "top")
+	for _, test := range []struct {
+		name             string
+		child, descender bool
+	}{
+		{"sites", true, true},
+		{"route-instance", true, true},
+		{"area_id", false, true},
+		{"ri3", false, true},
+		{"top", false, false},
+		{"missing", false, false},
+		{"24", false, false},
+	} {
+		if g := top.HasChild(test.name); g != test.child {
+			t.Fatalf("HasChild(%q) expected %v but %v", test.name, test.child, g)
+		}
+		if g := top.HasDescendant(test.name); g != test.descender {
+			t.Fatalf("HasDescendant(%q) expected %v but %v", test.name, test.descender, g)
+		}
+	}
+	if FindOne(doc, "//ri1/metric").HasChild("24") {
+		t.Fatal("expected text nodes not to be children")
+	}
+}
+
+func TestIsEmpty(t *testing.T) {
+	doc := MustParse(`{"s":"","ws":" \t\n","a":[],"o":{},"n":null,"zero":0,"f":false,"x":"x","items":[0],"m":{"a":null}}`)
+	for _, test := range []struct {
+		name         string
+		empty, blank bool
+	}{
+		{"s", true, true},
+		{"ws", false, true},
+		{"a", true, true},
+		{"o", true, true},
+		{"n", true, true},
+		{"zero", false, false},
+		{"f", false, false},
+		{"x", false, false},
+		{"items", false, false},
+		{"m", false, false},
+	} {
+		n := doc.SelectElement(test.name)
+		if g := n.IsEmpty(); g != test.empty {
+			t.Fatalf("%s: expected IsEmpty %v but %v", test.name, test.empty, g)
+		}
+		if g := n.IsBlank(); g != test.blank {
+			t.Fatalf("%s: expected IsBlank %v but %v", test.name, test.blank, g)
+		}
+	}
+	if doc.IsEmpty() || !MustParse(`{}`).IsEmpty() || !MustParse(`[]`).IsBlank() {
+		t.Fatal("expected documents to be empty as their root value")
+	}
+	if ws := doc.SelectElement("ws").FirstChild; ws.IsEmpty() || !ws.IsBlank() {
+		t.Fatal("expected a text node to be empty as its text")
+	}
+}
+
+func TestWithNumberHook(t *testing.T) {
+	round := WithNumberHook(func(literal string) (interface{}, ElementType) {
+		f, _ := strconv.ParseFloat(literal, 64)
+		return int64(math.Round(f)), NumberNode
+	})
+	doc, err := Parse(strings.NewReader(`{"a":1.6,"b":[2.4,-0.5,1e3],"c":"1.5"}`), round)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e, g := `{"a":2,"b":[2,-1,1000],"c":"1.5"}`, doc.String(); e != g {
+		t.Fatalf("expected %v but %v", e, g)
+	}
+	if sum, err := QueryAggregate(doc, "sum(//b/*)"); err != nil || sum != 1001 {
+		t.Fatalf("expected sum 1001 but %v, %v", sum, err)
+	}
+
+	literal := WithNumberHook(func(literal string) (interface{}, ElementType) {
+		return literal, StringNode
+	})
+	doc, err = Parse(strings.NewReader(`[1.50, 12345678901234567890]`), literal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e, g := `["1.50","12345678901234567890"]`, doc.String(); e != g {
+		t.Fatalf("expected %v but %v", e, g)
+	}
+
+	if _, err := Parse(strings.NewReader(`[1] x`), round); err == nil {
+		t.Fatal("expected error for trailing data")
+	}
+}
+
+func TestWithKeyTransform(t *testing.T) {
+	lower := WithKeyTransform(func(key string) string {
+		return strings.ToLower(strings.TrimSpace(key))
+	})
+	doc, err := Parse(strings.NewReader(`{"Name":"joe"," AGE ":42,"Tags":[{"Key":"a"}]}`), lower)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e, g := `{"age":42,"name":"joe","tags":[{"key":"a"}]}`, doc.String(); e != g {
+		t.Fatalf("expected %v but %v", e, g)
+	}
+	if n := doc.SelectElement("name"); n == nil || n.InnerText() != "joe" {
+		t.Fatalf("expected name joe but %v", n)
+	}
+	if doc.SelectElement("Name") != nil {
+		t.Fatal("expected original key not to match")
+	}
+	if v, err := ValueOf(doc, "//tags/*/key"); err != nil || v != "a" {
+		t.Fatalf("expected a but %q, %v", v, err)
+	}
+
+	doc, err = Parse(strings.NewReader(`{"A":1,"a":2}`), lower)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e, g := `{"a":2}`, doc.String(); e != g {
+		t.Fatalf("expected %v but %v", e, g)
+	}
+}
+
+func TestConvertNodeToInterfaceDepth(t *testing.T) {
+	doc, err := parseString(testConfig)
+	assert.Nil(t, err)
+	b, err := json.Marshal(ConvertNodeToInterfaceDepth(FindOne(doc, "top"), 2))
+	assert.Nil(t, err)
+	assert.Equal(t, `{"inner":["0","1","2","3"],"people":["{…}","{…}"],"route-instance":{"ri1":"{…}","ri2":"{…}"},"sites":["{…}"]}`, string(b))
+
+	b, err = json.Marshal(ConvertNodeToInterfaceDepth(doc, 1))
+	assert.Nil(t, err)
+	assert.Equal(t, `{"top":"{…}"}`, string(b))
+	assert.Equal(t, "[…]", ConvertNodeToInterfaceDepth(FindOne(doc, "//inner"), 0))
+	assert.Equal(t, "24", ConvertNodeToInterfaceDepth(FindOne(doc, "//ri1/metric"), 0))
+	assert.Equal(t, ConvertNodeToInterface(doc), ConvertNodeToInterfaceDepth(doc, 100))
+}
+
+func TestConvertNodeToInterfaceCollapseSingletons(t *testing.T) {
+	doc, err := parseString(`{"one":[{"a":["x"]}],"two":["x","y"],"nested":[[["z"]]],"empty":[],"mixed":[["p"],["q","r"]]}`)
+	assert.Nil(t, err)
+	b, err := json.Marshal(ConvertNodeToInterfaceCollapseSingletons(doc))
+	assert.Nil(t, err)
+	assert.Equal(t, `{"empty":[],"mixed":["p",["q","r"]],"nested":"z","one":{"a":"x"},"two":["x","y"]}`, string(b))
+	assert.Equal(t, "x", ConvertNodeToInterfaceCollapseSingletons(FindOne(doc, "//two/*[1]")))
+}
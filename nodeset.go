@@ -0,0 +1,37 @@
+package jsonquery
+
+// NodeSetIntersect returns the nodes that are both in a and in b, compared
+// by identity, in document order and without duplicates.
+func NodeSetIntersect(a, b []*Node) []*Node {
+	in := nodeSet(b)
+	return filterNodeSet(a, func(n *Node) bool { return in[n] })
+}
+
+// NodeSetExcept returns the nodes of a that are not in b, compared by
+// identity, in document order and without duplicates.
+func NodeSetExcept(a, b []*Node) []*Node {
+	in := nodeSet(b)
+	return filterNodeSet(a, func(n *Node) bool { return !in[n] })
+}
+
+func nodeSet(nodes []*Node) map[*Node]bool {
+	set := make(map[*Node]bool, len(nodes))
+	for _, n := range nodes {
+		set[n] = true
+	}
+	return set
+}
+
+// filterNodeSet returns the nodes of a for which keep reports true, in
+// document order and without duplicates.
+func filterNodeSet(a []*Node, keep func(*Node) bool) []*Node {
+	seen := make(map[*Node]bool, len(a))
+	var nodes []*Node
+	for _, n := range a {
+		if !seen[n] && keep(n) {
+			nodes = append(nodes, n)
+		}
+		seen[n] = true
+	}
+	return sortDocumentOrder(nodes)
+}
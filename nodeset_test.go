@@ -0,0 +1,43 @@
+package jsonquery
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNodeSetIntersectExcept(t *testing.T) {
+	doc, _ := parseString(testConfig)
+	all := Find(doc, "//*/metric")
+	ri := Find(doc, "//route-instance//metric")
+	pointers := func(nodes []*Node) string {
+		var a []string
+		for _, n := range nodes {
+			a = append(a, nodePointer(n))
+		}
+		return strings.Join(a, " ")
+	}
+
+	e := "/top/sites/0/ri1/ospf/areas/0/metric /top/sites/0/ri2/ospf/areas/0/metric /top/sites/0/ri3/ospf/areas/0/metric"
+	if g := pointers(NodeSetExcept(all, ri)); e != g {
+		t.Fatalf("expected %v but %v", e, g)
+	}
+	// Duplicates and order of the inputs do not matter.
+	reversed := make([]*Node, 0, 2*len(all))
+	for i := len(all) - 1; i >= 0; i-- {
+		reversed = append(reversed, all[i], all[i])
+	}
+	if g := pointers(NodeSetExcept(reversed, append(ri, ri...))); e != g {
+		t.Fatalf("expected %v but %v", e, g)
+	}
+
+	e = "/top/route-instance/ri1/metric /top/route-instance/ri2/metric"
+	if g := pointers(NodeSetIntersect(reversed, ri)); e != g {
+		t.Fatalf("expected %v but %v", e, g)
+	}
+	if g := NodeSetIntersect(all, nil); len(g) != 0 {
+		t.Fatalf("expected no nodes but %v", g)
+	}
+	if g := pointers(NodeSetExcept(ri, nil)); e != g {
+		t.Fatalf("expected %v but %v", e, g)
+	}
+}
@@ -0,0 +1,166 @@
+package jsonquery
+
+import (
+	"encoding/json"
+	"errors"
+	"sync/atomic"
+)
+
+// observer is a callback registered with OnChange.
+type observer struct {
+	id   int
+	expr *Expr
+	fn   func(old, new *Node)
+}
+
+var lastObserverID int64
+
+// OnChange registers fn to be called after a mutation of n or one of its
+// descendants, such as SetValue, ReplaceWith, ApplyPatch or
+// ApplyMergePatch, changes the value of the node selected by the XPath
+// expression path from n. fn is called with a copy of the node before
+// the mutation and the node after it; either is nil if the node did not
+// exist. It returns an ID that can be passed to RemoveCallback. OnChange
+// panics if path cannot be parsed.
+//
+// Callbacks belong to n and are not copied by Clone, so they should be
+// registered on a node that is not replaced by the mutations, such as
+// the DocumentNode.
+func (n *Node) OnChange(path string, fn func(old, new *Node)) int {
+	expr, err := getQuery(path)
+	if err != nil {
+		panic(err)
+	}
+	id := int(atomic.AddInt64(&lastObserverID, 1))
+	x := n.extras()
+	x.observers = append(x.observers, &observer{id: id, expr: expr, fn: fn})
+	return id
+}
+
+// RemoveCallback removes the callback with the specified ID registered
+// on n with OnChange.
+func (n *Node) RemoveCallback(id int) {
+	if n.extra == nil {
+		return
+	}
+	x := n.extra
+	for i, o := range x.observers {
+		if o.id == id {
+			x.observers = append(x.observers[:i], x.observers[i+1:]...)
+			return
+		}
+	}
+}
+
+// SetValue replaces the value of n with v, which is encoded as JSON and
+// parsed into child nodes, and changes the ElementType of n accordingly.
+// Return an error if n is a TextNode or v cannot be encoded.
+func (n *Node) SetValue(v interface{}) error {
+	if n.Type == TextNode {
+		return errors.New("cannot set the value of a text node")
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	var x interface{}
+	if err := json.Unmarshal(b, &x); err != nil {
+		return err
+	}
+	mutate(n, func() { replaceValue(n, valueNode(x)) })
+	return nil
+}
+
+// ReplaceWith replaces n in the child list of its parent by replacement,
+// which is moved from its own tree, and leaves n detached. Unlike
+// SetValue, it substitutes the node itself, so it can change the
+// structure entirely. replacement takes the name of n, and is removed
+// from its parent first if it has one.
+// Return an error if n has no parent, or replacement is a TextNode, n
+// itself or an ancestor of n.
+func (n *Node) ReplaceWith(replacement *Node) error {
+	parent := n.Parent
+	if parent == nil {
+		return errors.New("cannot replace a node without parent")
+	}
+	if replacement.Type == TextNode {
+		return errors.New("cannot replace a node with a text node")
+	}
+	for a := n; a != nil; a = a.Parent {
+		if a == replacement {
+			return errors.New("cannot replace a node with itself or an ancestor")
+		}
+	}
+	mutate(parent, func() {
+		removeNode(replacement)
+		replacement.Type, replacement.Data = ElementNode, n.Data
+		next := n.NextSibling
+		removeNode(n)
+		insertBefore(parent, replacement, next)
+	})
+	return nil
+}
+
+// Delete removes n from its parent. The name of a deleted object member
+// is remembered by the object for MarshalOptions.EmitNullForDeleted.
+// Return an error if n has no parent.
+func (n *Node) Delete() error {
+	parent := n.Parent
+	if parent == nil {
+		return errors.New("cannot delete a node without parent")
+	}
+	mutate(parent, func() { deleteMember(n) })
+	return nil
+}
+
+// mutate calls fn to modify the subtree of n and then the callbacks of n
+// and its ancestors whose node was changed.
+func mutate(n *Node, fn func()) {
+	type change struct {
+		o   *observer
+		at  *Node
+		old *Node
+	}
+	var changes []change
+	for a := n; a != nil; a = a.Parent {
+		if a.extra == nil {
+			continue
+		}
+		for _, o := range a.extra.observers {
+			old, _ := o.expr.Query(a)
+			if old != nil {
+				if !related(old, n) {
+					continue
+				}
+				old = old.Clone()
+			}
+			changes = append(changes, change{o, a, old})
+		}
+	}
+	fn()
+	for _, c := range changes {
+		cur, _ := c.o.expr.Query(c.at)
+		if c.old == nil && (cur == nil || !related(cur, n)) {
+			continue
+		}
+		if c.old == nil || cur == nil || c.old.String() != cur.String() {
+			c.o.fn(c.old, cur)
+		}
+	}
+}
+
+// related reports whether a and b are the same node or one is an
+// ancestor of the other.
+func related(a, b *Node) bool {
+	for n := a; n != nil; n = n.Parent {
+		if n == b {
+			return true
+		}
+	}
+	for n := b; n != nil; n = n.Parent {
+		if n == a {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,207 @@
+package jsonquery
+
+import (
+	"testing"
+)
+
+func TestOnChange(t *testing.T) {
+	doc := MustParse(`{"a":{"b":1,"c":[1,2]},"d":"x"}`)
+	var changes []string
+	str := func(n *Node) string {
+		if n == nil {
+			return "<nil>"
+		}
+		return n.String()
+	}
+	record := func(name string) func(old, new *Node) {
+		return func(old, new *Node) {
+			changes = append(changes, name+":"+str(old)+"->"+str(new))
+		}
+	}
+	doc.OnChange("a/b", record("b"))
+	idC := doc.OnChange("a/c", record("c"))
+	doc.OnChange("e", record("e"))
+	a := FindOne(doc, "a")
+	a.OnChange("c/*[1]", record("c1"))
+
+	if err := FindOne(doc, "a/b").SetValue(2); err != nil {
+		t.Fatal(err)
+	}
+	if err := FindOne(doc, "a/c/*[2]").SetValue(map[string]int{"z": 3}); err != nil {
+		t.Fatal(err)
+	}
+	// Unchanged and unrelated values don't fire callbacks.
+	if err := FindOne(doc, "a/c/*[1]").SetValue(1); err != nil {
+		t.Fatal(err)
+	}
+	if err := FindOne(doc, "d").SetValue("y"); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		`b:1->2`,
+		`c:[1,2]->[1,{"z":3}]`,
+	}
+	if len(changes) != len(want) {
+		t.Fatalf("expected %v but %v", want, changes)
+	}
+	for i := range want {
+		if changes[i] != want[i] {
+			t.Fatalf("expected %v but %v", want, changes)
+		}
+	}
+
+	changes = nil
+	doc.RemoveCallback(idC)
+	if err := ApplyMergePatch(doc, []byte(`{"a":{"c":[5]},"e":true}`)); err != nil {
+		t.Fatal(err)
+	}
+	// The callback registered on a is lost when the patch replaces a.
+	if len(changes) != 1 || changes[0] != `e:<nil>->true` {
+		t.Fatalf("unexpected changes %v", changes)
+	}
+
+	changes = nil
+	if err := ApplyPatch(doc, []byte(`[{"op":"remove","path":"/a/b"}]`)); err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 1 || changes[0] != `b:2-><nil>` {
+		t.Fatalf("unexpected changes %v", changes)
+	}
+}
+
+func TestReplaceWith(t *testing.T) {
+	doc, _ := parseString(testConfig)
+	var changed *Node
+	doc.OnChange("top/route-instance/ri2", func(old, new *Node) {
+		changed = new
+	})
+	metric := FindOne(doc, "top/route-instance/ri2/metric")
+	replacement := MustParse(`{"cost":89,"unit":"ms"}`)
+	if err := metric.ReplaceWith(replacement); err != nil {
+		t.Fatal(err)
+	}
+	if metric.Parent != nil {
+		t.Fatal("expected the replaced node to be detached")
+	}
+	ri2 := FindOne(doc, "top/route-instance/ri2")
+	if e, g := `{"metric":{"cost":89,"unit":"ms"}}`, ri2.String(); e != g {
+		t.Fatalf("expected %v but %v", e, g)
+	}
+	if changed != ri2 {
+		t.Fatalf("expected OnChange callback with ri2 but %v", changed)
+	}
+	if n := FindOne(doc, "//ri2/metric/unit/parent::*/parent::ri2"); n != ri2 {
+		t.Fatalf("expected parent pointers to be fixed but %v", n)
+	}
+	if n := FindOne(doc, "//ri1/metric/following-sibling::*"); n != nil {
+		t.Fatalf("expected no sibling but %v", n)
+	}
+
+	// Replace an array item between its siblings.
+	inner := FindOne(doc, "top/inner/*[2]")
+	if err := inner.ReplaceWith(ParseTree([]interface{}{"x"})); err != nil {
+		t.Fatal(err)
+	}
+	if e, g := `[0,["x"],2,3]`, FindOne(doc, "top/inner").String(); e != g {
+		t.Fatalf("expected %v but %v", e, g)
+	}
+	if err := doc.ReplaceWith(replacement); err == nil {
+		t.Fatal("expected error replacing the root")
+	}
+}
+
+func TestReplaceWithTreeNodes(t *testing.T) {
+	doc := MustParse(`{"a":{"b":{"c":1}},"d":[1,2,3],"e":"x"}`)
+	b := FindOne(doc, "a/b")
+	for _, replacement := range []*Node{b, FindOne(doc, "a"), doc} {
+		if err := b.ReplaceWith(replacement); err == nil {
+			t.Fatalf("expected error replacing b with %v", replacement)
+		}
+	}
+	if e, g := `{"a":{"b":{"c":1}},"d":[1,2,3],"e":"x"}`, doc.String(); e != g {
+		t.Fatalf("expected %v but %v", e, g)
+	}
+
+	// A replacement from the same tree is moved.
+	d1 := FindOne(doc, "d/*[1]")
+	if err := FindOne(doc, "e").ReplaceWith(FindOne(doc, "d/*[3]")); err != nil {
+		t.Fatal(err)
+	}
+	if e, g := `{"a":{"b":{"c":1}},"d":[1,2],"e":3}`, doc.String(); e != g {
+		t.Fatalf("expected %v but %v", e, g)
+	}
+	if err := d1.ReplaceWith(FindOne(doc, "a/b/c")); err != nil {
+		t.Fatal(err)
+	}
+	if e, g := `{"a":{"b":{}},"d":[1,2],"e":3}`, doc.String(); e != g {
+		t.Fatalf("expected %v but %v", e, g)
+	}
+	if d1.Parent != nil {
+		t.Fatal("expected the replaced node to be detached")
+	}
+	// A descendant of n replaces it.
+	if err := FindOne(doc, "d").ReplaceWith(FindOne(doc, "d/*[2]")); err != nil {
+		t.Fatal(err)
+	}
+	if e, g := `{"a":{"b":{}},"d":2,"e":3}`, doc.String(); e != g {
+		t.Fatalf("expected %v but %v", e, g)
+	}
+	if n := len(Find(doc, "//*")); n != 4 {
+		t.Fatalf("expected 4 elements but %d", n)
+	}
+}
+
+func TestDelete(t *testing.T) {
+	doc := MustParse(`{"a":1,"b":{"c":2,"d":[1,2]},"e":3}`)
+	changes := 0
+	doc.OnChange("b", func(old, new *Node) { changes++ })
+	if err := FindOne(doc, "b/c").Delete(); err != nil {
+		t.Fatal(err)
+	}
+	if err := FindOne(doc, "b/d/*[1]").Delete(); err != nil {
+		t.Fatal(err)
+	}
+	if err := FindOne(doc, "e").Delete(); err != nil {
+		t.Fatal(err)
+	}
+	if changes != 2 {
+		t.Fatalf("expected 2 changes but %d", changes)
+	}
+	for _, test := range []struct {
+		opts MarshalOptions
+		want string
+	}{
+		{MarshalOptions{}, `{"a":1,"b":{"d":[2]}}`},
+		{MarshalOptions{EmitNullForDeleted: true}, `{"a":1,"b":{"c":null,"d":[2]},"e":null}`},
+	} {
+		b, err := doc.Marshal(test.opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if g := string(b); g != test.want {
+			t.Fatalf("%+v: expected %v but %v", test.opts, test.want, g)
+		}
+	}
+	if e, g := `{"a":1,"b":{"d":[2]}}`, doc.String(); e != g {
+		t.Fatalf("expected %v but %v", e, g)
+	}
+
+	// A member added again is encoded with its value.
+	if err := ApplyPatch(doc, []byte(`[{"op":"add","path":"/e","value":4},{"op":"remove","path":"/a"}]`)); err != nil {
+		t.Fatal(err)
+	}
+	if err := ApplyMergePatch(doc, []byte(`{"b":{"d":null}}`)); err != nil {
+		t.Fatal(err)
+	}
+	b, err := doc.Marshal(MarshalOptions{EmitNullForDeleted: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e, g := `{"a":null,"b":{"c":null,"d":null},"e":4}`, string(b); e != g {
+		t.Fatalf("expected %v but %v", e, g)
+	}
+
+	if err := doc.Delete(); err == nil {
+		t.Fatal("expected error for the root")
+	}
+}
@@ -0,0 +1,251 @@
+package jsonquery
+
+import (
+	"strings"
+
+	"github.com/antchfx/xpath"
+)
+
+// WithParallel returns a copy of e whose QueryAll and QueryAllVars search
+// the children of a large array with up to n goroutines, for expressions
+// of the form `path/*[predicate]...` such as `//items/*[price > 10]/name`,
+// where path has no predicate. The children of the nodes found by path
+// are split among the goroutines, and the nodes they find are merged in
+// document order, so the result is the same as without WithParallel.
+//
+// The search is not split, and runs as without WithParallel, for other
+// expressions, for unions, and if a predicate of the children depends on
+// their position, such as `[2]` or `[position() < 3]`. A n <= 1 means
+// no parallel search.
+func (e *Expr) WithParallel(n int) *Expr {
+	c := *e
+	c.parallel = nil
+	if n > 1 {
+		c.parallel = newParallelPlan(e.xs, n)
+	}
+	return &c
+}
+
+// A parallelPlan splits the search of an expression `prefix/*[preds]rest`
+// into the search of prefix, and of `self::*[preds]rest` from each child
+// of the nodes found, which are independent of each other if no predicate
+// depends on the position of the child.
+type parallelPlan struct {
+	workers int
+	// prefix is nil if the expression starts with `/*`.
+	prefix *xpath.Expr
+	item   *xpath.Expr
+	preds  []string
+}
+
+// newParallelPlan returns the plan of the compiled expression s, or nil
+// if s is not of the required form.
+func newParallelPlan(s string, workers int) *parallelPlan {
+	p := &parallelPlan{workers: workers}
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+			continue
+		case c == '"' || c == '\'':
+			quote = c
+			continue
+		case c == '[' || c == '(' || c == '|':
+			// The path before the children has a predicate, a function
+			// call or a union.
+			return nil
+		case c != '/' || !strings.HasPrefix(s[i:], "/*") || i > 0 && s[i-1] == '/':
+			continue
+		}
+		j := i + 2
+		for j < len(s) && strings.IndexByte(" \t\r\n", s[j]) >= 0 {
+			j++
+		}
+		if j == len(s) || s[j] != '[' {
+			continue
+		}
+		rest := j
+		for rest < len(s) && s[rest] == '[' {
+			end := matchingBracket(s, rest)
+			if end < 0 {
+				return nil
+			}
+			pred := s[rest+1 : end]
+			if strings.Contains(pred, "position(") || strings.Contains(pred, "last(") {
+				return nil
+			}
+			p.preds = append(p.preds, pred)
+			rest = end + 1
+		}
+		if strings.ContainsRune(stripLiterals(s[rest:]), '|') {
+			return nil
+		}
+		var err error
+		if i > 0 {
+			if p.prefix, err = xpath.Compile(s[:i]); err != nil {
+				return nil
+			}
+		}
+		if p.item, err = xpath.Compile("self::*" + s[j:]); err != nil {
+			return nil
+		}
+		return p
+	}
+	return nil
+}
+
+// matchingBracket returns the index of the bracket closing the one at
+// s[i], or -1.
+func matchingBracket(s string, i int) int {
+	depth := 0
+	var quote byte
+	for ; i < len(s); i++ {
+		switch c := s[i]; {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '[':
+			depth++
+		case c == ']':
+			if depth--; depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// stripLiterals returns s without the contents of its string literals.
+func stripLiterals(s string) string {
+	var b strings.Builder
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// queryAllParallel runs the plan of e from top. It returns false if the
+// predicates depend on the position of the children, and the search must
+// not be split.
+func (e *Expr) queryAllParallel(top *Node) (nodes []*Node, ok bool, err error) {
+	p := e.parallel
+	parents := []*Node{top}
+	if p.prefix != nil {
+		parents = nil
+		t := p.prefix.Select(e.navigator(top))
+		seen := make(map[*Node]bool)
+		for {
+			n, err := e.next(t, seen)
+			if err != nil {
+				return nil, true, err
+			}
+			if n == nil {
+				break
+			}
+			parents = append(parents, n)
+		}
+	}
+	var items []*Node
+	for _, n := range parents {
+		items = append(items, elementChildren(n)...)
+	}
+	if len(items) == 0 {
+		return nil, true, nil
+	}
+	if positional, err := e.positionalPredicate(top, items[0]); err != nil || positional {
+		return nil, !positional, err
+	}
+
+	workers := p.workers
+	if workers > len(items) {
+		workers = len(items)
+	}
+	results := make([][]*Node, workers)
+	errs := make([]error, workers)
+	done := make(chan struct{})
+	for w := 0; w < workers; w++ {
+		chunk := items[w*len(items)/workers : (w+1)*len(items)/workers]
+		go func(w int) {
+			defer func() { done <- struct{}{} }()
+			nav := e.navigator(top)
+			seen := make(map[*Node]bool)
+			for _, item := range chunk {
+				cur := *nav
+				cur.cur = item
+				t := p.item.Select(&cur)
+				for {
+					n, err := e.next(t, seen)
+					if err != nil {
+						errs[w] = err
+						return
+					}
+					if n == nil {
+						break
+					}
+					results[w] = append(results[w], n)
+				}
+			}
+		}(w)
+	}
+	for w := 0; w < workers; w++ {
+		<-done
+	}
+	seen := make(map[*Node]bool)
+	for w, found := range results {
+		if errs[w] != nil {
+			return nil, true, errs[w]
+		}
+		for _, n := range found {
+			if !seen[n] {
+				seen[n] = true
+				nodes = append(nodes, n)
+			}
+		}
+	}
+	nodes = sortDocumentOrder(nodes)
+	if e.offset > 0 {
+		if e.offset >= len(nodes) {
+			return nil, true, nil
+		}
+		nodes = nodes[e.offset:]
+	}
+	if e.limit > 0 && len(nodes) > e.limit {
+		nodes = nodes[:e.limit]
+	}
+	return nodes, true, nil
+}
+
+// positionalPredicate reports whether a predicate of the plan of e is a
+// number, which selects a child by position, evaluated on item.
+func (e *Expr) positionalPredicate(top, item *Node) (positional bool, err error) {
+	defer recoverFuncError(&err)
+	for _, pred := range e.parallel.preds {
+		x, err := xpath.Compile(pred)
+		if err != nil {
+			return true, nil
+		}
+		nav := e.navigator(top)
+		nav.cur = item
+		if _, ok := x.Evaluate(nav).(float64); ok {
+			return true, nil
+		}
+	}
+	return false, nil
+}
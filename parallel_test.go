@@ -0,0 +1,70 @@
+package jsonquery
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestExprWithParallel(t *testing.T) {
+	doc, err := Parse(bytes.NewReader(arrayJSON))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		expr  string
+		split bool
+	}{
+		{"//items/*[price > 50 and active = 'true']", true},
+		{"/items/*[category = 'a'][rating > 3]/owner/name", true},
+		{"//items/*[tags/* = 't7']/tags/*[1]", true},
+		{"//items/*[owner/id = /items/*[1]/owner/id]/id", true},
+		{"/items/*[date(created) >= date('2020-01-20')]/..", true},
+		{"/*[*/id = 5]", true},
+		{"//items/*[$n]", true},
+		{"//items/*[3]", true},
+		{"//items/*[position() < 3]", false},
+		{"//items/*[last()]", false},
+		{"//items/*[price > 90] | //items/*[1]", false},
+		{"//items/*[1]/owner", true},
+		{"//*[name = 'item5']", false},
+		{"//items/*/owner[id > 45]", false},
+		{"//items[1]/*[price > 90]", false},
+	} {
+		exp, err := Compile(test.expr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		vars := map[string]interface{}{"n": 7}
+		e, err := exp.QueryAllVars(doc, vars)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(e) == 0 {
+			t.Fatalf("%s: expected matches", test.expr)
+		}
+		for _, workers := range []int{2, 3, 16} {
+			par := exp.WithParallel(workers)
+			if split := par.parallel != nil; split != test.split {
+				t.Fatalf("%s: expected split %v but %v", test.expr, test.split, split)
+			}
+			g, err := par.QueryAllVars(doc, vars)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(e, g) {
+				t.Fatalf("%s with %d workers: expected %d nodes but %d", test.expr, workers, len(e), len(g))
+			}
+		}
+	}
+
+	exp, _ := Compile("//items/*[price > 50]/id")
+	e, _ := exp.WithOffset(5).WithLimit(10).QueryAll(doc)
+	g, _ := exp.WithParallel(4).WithOffset(5).WithLimit(10).QueryAll(doc)
+	if len(e) != 10 || !reflect.DeepEqual(e, g) {
+		t.Fatalf("expected %v but %v", e, g)
+	}
+	if exp.WithParallel(1).parallel != nil {
+		t.Fatal("expected no parallel search for 1 worker")
+	}
+}
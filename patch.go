@@ -0,0 +1,263 @@
+package jsonquery
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// patchOperation is an operation of a JSON Patch document.
+type patchOperation struct {
+	Op    string          `json:"op"`
+	Path  *string         `json:"path"`
+	From  *string         `json:"from"`
+	Value json.RawMessage `json:"value"`
+}
+
+// ApplyPatch applies the JSON Patch document patch, as defined by RFC 6902,
+// to doc. The patch is applied atomically: if an operation fails, including
+// a failed "test" operation, doc is left unchanged and the error is
+// returned.
+//
+// The nodes of doc are replaced by patched copies, so nodes obtained from
+// doc before the patch are no longer part of it.
+func ApplyPatch(doc *Node, patch []byte) error {
+	var ops []patchOperation
+	if err := json.Unmarshal(patch, &ops); err != nil {
+		return err
+	}
+	work := doc.Clone()
+	for i, op := range ops {
+		if err := applyPatchOperation(work, op); err != nil {
+			return fmt.Errorf("patch operation %d (%s): %v", i, op.Op, err)
+		}
+	}
+	mutate(doc, func() { replaceValue(doc, work) })
+	return nil
+}
+
+func applyPatchOperation(doc *Node, op patchOperation) error {
+	if op.Path == nil {
+		return errors.New("missing path")
+	}
+	path := *op.Path
+	switch op.Op {
+	case "add", "replace", "test":
+		if op.Value == nil {
+			return errors.New("missing value")
+		}
+	case "move", "copy":
+		if op.From == nil {
+			return errors.New("missing from")
+		}
+	}
+	switch op.Op {
+	case "add":
+		v, err := patchValue(op.Value)
+		if err != nil {
+			return err
+		}
+		return patchAdd(doc, path, v)
+	case "remove":
+		n, err := ResolvePointer(doc, path)
+		if err != nil {
+			return err
+		}
+		if n == doc {
+			return errors.New("cannot remove the root")
+		}
+		deleteMember(n)
+	case "replace":
+		n, err := ResolvePointer(doc, path)
+		if err != nil {
+			return err
+		}
+		v, err := patchValue(op.Value)
+		if err != nil {
+			return err
+		}
+		replaceValue(n, v)
+	case "move":
+		from := *op.From
+		if from == path {
+			return nil
+		}
+		if strings.HasPrefix(path, from+"/") {
+			return fmt.Errorf("cannot move %s into itself", from)
+		}
+		n, err := ResolvePointer(doc, from)
+		if err != nil {
+			return err
+		}
+		if n == doc {
+			return errors.New("cannot move the root")
+		}
+		deleteMember(n)
+		return patchAdd(doc, path, n)
+	case "copy":
+		n, err := ResolvePointer(doc, *op.From)
+		if err != nil {
+			return err
+		}
+		return patchAdd(doc, path, n.Clone())
+	case "test":
+		n, err := ResolvePointer(doc, path)
+		if err != nil {
+			return err
+		}
+		got, err := decodeValue(n)
+		if err != nil {
+			return err
+		}
+		var want interface{}
+		if err := json.Unmarshal(op.Value, &want); err != nil {
+			return err
+		}
+		if !reflect.DeepEqual(got, want) {
+			return fmt.Errorf("%s is %s, not %s", path, n, op.Value)
+		}
+	default:
+		return fmt.Errorf("unknown operation %q", op.Op)
+	}
+	return nil
+}
+
+// patchAdd adds v at the location referenced by path: it replaces the
+// value of an existing object member and is inserted before an existing
+// array element.
+func patchAdd(doc *Node, path string, v *Node) error {
+	if path == "" {
+		replaceValue(doc, v)
+		return nil
+	}
+	i := strings.LastIndexByte(path, '/')
+	if i < 0 {
+		return fmt.Errorf("pointer %s: must be empty or start with /", path)
+	}
+	parent, err := ResolvePointer(doc, path[:i])
+	if err != nil {
+		return err
+	}
+	token := unescapePointerToken(path[i+1:])
+	switch parent.ElType {
+	case MapNode:
+		if n := parent.selectMember(token); n != nil {
+			replaceValue(n, v)
+			return nil
+		}
+		v.Data = token
+		insertBefore(parent, v, nil)
+	case ArrayNode:
+		var ref *Node
+		if token != "-" {
+			j, ok := pointerIndex(token)
+			if !ok {
+				return fmt.Errorf("pointer %s: invalid array index %q", path, token)
+			}
+			ref = parent.FirstChild
+			for ; j > 0 && ref != nil; j-- {
+				ref = ref.NextSibling
+			}
+			if j > 0 {
+				return &PointerNotFoundError{Pointer: path, Token: token}
+			}
+		}
+		v.Data = ""
+		insertBefore(parent, v, ref)
+	default:
+		return fmt.Errorf("pointer %s: %s is not an object or array", path, path[:i])
+	}
+	return nil
+}
+
+// patchValue parses the JSON value of a patch operation into an element
+// node.
+func patchValue(b json.RawMessage) (*Node, error) {
+	var v interface{}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return nil, err
+	}
+	return valueNode(v), nil
+}
+
+// decodeValue returns the value of n as decoded by json.Unmarshal into
+// an interface{}, with float64 numbers.
+func decodeValue(n *Node) (interface{}, error) {
+	b, err := n.ToJSON()
+	if err != nil {
+		return nil, err
+	}
+	var v interface{}
+	err = json.Unmarshal(b, &v)
+	return v, err
+}
+
+// valueNode creates a detached element node holding the value v.
+func valueNode(v interface{}) *Node {
+	n := &Node{Type: ElementNode}
+	parseValue(v, n, 1, nil)
+	return n
+}
+
+// replaceValue replaces the value of n with the value of v, moving the
+// child nodes of v to n.
+func replaceValue(n, v *Node) {
+	n.ElType = v.ElType
+	if deleted := v.deletedMembers(); deleted != nil || n.extra != nil {
+		n.extras().deleted = deleted
+	}
+	n.FirstChild, n.LastChild = v.FirstChild, v.LastChild
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		c.Parent = n
+		setLevel(c, n.level+1)
+	}
+	v.FirstChild, v.LastChild = nil, nil
+}
+
+// ApplyMergePatch applies the JSON Merge Patch document patch, as defined
+// by RFC 7396, to doc. Members of patch objects are merged recursively
+// into the matching objects of doc and null members remove them; any
+// other value replaces the target value. Members added to an object are
+// appended after its existing members.
+func ApplyMergePatch(doc *Node, patch []byte) error {
+	var v interface{}
+	if err := json.Unmarshal(patch, &v); err != nil {
+		return err
+	}
+	mutate(doc, func() { mergePatch(doc, v) })
+	return nil
+}
+
+func mergePatch(n *Node, v interface{}) {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		replaceValue(n, valueNode(v))
+		return
+	}
+	if n.ElType != MapNode {
+		n.ElType = MapNode
+		n.FirstChild, n.LastChild = nil, nil
+	}
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		c := n.selectMember(key)
+		if m[key] == nil {
+			if c != nil {
+				deleteMember(c)
+			}
+			continue
+		}
+		if c == nil {
+			c = &Node{Type: ElementNode, ElType: NullNode, Data: key}
+			appendChild(n, c)
+		}
+		mergePatch(c, m[key])
+	}
+}
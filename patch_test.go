@@ -0,0 +1,92 @@
+package jsonquery
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestApplyPatch(t *testing.T) {
+	tests := []struct {
+		doc, patch, want string
+	}{
+		{`{"foo":"bar"}`, `[{"op":"add","path":"/baz","value":"qux"}]`, `{"baz":"qux","foo":"bar"}`},
+		{`{"foo":["bar","baz"]}`, `[{"op":"add","path":"/foo/1","value":"qux"}]`, `{"foo":["bar","qux","baz"]}`},
+		{`{"foo":["bar"]}`, `[{"op":"add","path":"/foo/-","value":{"a":null}}]`, `{"foo":["bar",{"a":null}]}`},
+		{`{"baz":"qux","foo":"bar"}`, `[{"op":"remove","path":"/baz"}]`, `{"foo":"bar"}`},
+		{`{"foo":["bar","qux","baz"]}`, `[{"op":"remove","path":"/foo/1"}]`, `{"foo":["bar","baz"]}`},
+		{`{"baz":"qux","foo":"bar"}`, `[{"op":"replace","path":"/baz","value":[1,true]}]`, `{"baz":[1,true],"foo":"bar"}`},
+		{`{"foo":{"bar":"baz","waldo":"fred"},"qux":{"corge":"grault"}}`, `[{"op":"move","from":"/foo/waldo","path":"/qux/thud"}]`, `{"foo":{"bar":"baz"},"qux":{"corge":"grault","thud":"fred"}}`},
+		{`{"foo":["all","grass","cows","eat"]}`, `[{"op":"move","from":"/foo/1","path":"/foo/3"}]`, `{"foo":["all","cows","eat","grass"]}`},
+		{`{"a":{"b":1}}`, `[{"op":"copy","from":"/a","path":"/c"},{"op":"replace","path":"/c/b","value":2}]`, `{"a":{"b":1},"c":{"b":2}}`},
+		{`{"a":[1,{"b":"c"}]}`, `[{"op":"test","path":"/a","value":[1.0,{"b":"c"}]}]`, `{"a":[1,{"b":"c"}]}`},
+		{`{"a":1}`, `[{"op":"replace","path":"","value":[1]}]`, `[1]`},
+	}
+	for _, test := range tests {
+		doc := MustParse(test.doc)
+		if err := ApplyPatch(doc, []byte(test.patch)); err != nil {
+			t.Fatalf("ApplyPatch(%s, %s) failed: %v", test.doc, test.patch, err)
+		}
+		if got := doc.String(); got != test.want {
+			t.Fatalf("ApplyPatch(%s, %s) expected %s but %s", test.doc, test.patch, test.want, got)
+		}
+	}
+}
+
+func TestApplyPatchError(t *testing.T) {
+	tests := []struct {
+		patch, err string
+	}{
+		{`[{"op":"add","path":"/c/d","value":1}]`, `"c" not found`},
+		{`[{"op":"add","path":"/a/5","value":1}]`, `not found`},
+		{`[{"op":"remove","path":"/x"}]`, `"x" not found`},
+		{`[{"op":"test","path":"/b","value":"c"}]`, `/b is "x", not "c"`},
+		{`[{"op":"move","from":"/a","path":"/a/0"}]`, `cannot move /a into itself`},
+		{`[{"op":"add","path":"/b"}]`, `missing value`},
+		{`[{"op":"frob","path":"/b"}]`, `unknown operation "frob"`},
+	}
+	for _, test := range tests {
+		doc := MustParse(`{"a":[1,2],"b":"x"}`)
+		// The first operation succeeds and must be rolled back.
+		patch := `[{"op":"remove","path":"/a/0"},` + test.patch[1:]
+		err := ApplyPatch(doc, []byte(patch))
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Fatalf("ApplyPatch(%s) expected error %q but %v", patch, test.err, err)
+		}
+		if got, want := doc.String(), `{"a":[1,2],"b":"x"}`; got != want {
+			t.Fatalf("ApplyPatch(%s) modified the document to %s", patch, got)
+		}
+	}
+}
+
+func TestApplyMergePatch(t *testing.T) {
+	doc := MustParse(`{"title":"Goodbye!","author":{"givenName":"John","familyName":"Doe"},"tags":["example","sample"],"content":"This will be unchanged"}`)
+	patch := `{"title":"Hello!","phoneNumber":"+01-123-456-7890","author":{"familyName":null},"tags":["example"]}`
+	if err := ApplyMergePatch(doc, []byte(patch)); err != nil {
+		t.Fatal(err)
+	}
+	want := `{"author":{"givenName":"John"},"content":"This will be unchanged","phoneNumber":"+01-123-456-7890","tags":["example"],"title":"Hello!"}`
+	if got := doc.String(); got != want {
+		t.Fatalf("expected %s but %s", want, got)
+	}
+	if n := FindOne(doc, "phoneNumber"); n == nil || n.InnerText() != "+01-123-456-7890" {
+		t.Fatalf("expected phoneNumber to be queryable but %v", n)
+	}
+	if err := ApplyMergePatch(doc, []byte(`{"author":"anonymous","tags":{"a":1}}`)); err != nil {
+		t.Fatal(err)
+	}
+	if n := FindOne(doc, "tags/a"); n == nil || n.InnerText() != "1" {
+		t.Fatalf("expected tags/a to be 1 but %v", n)
+	}
+}
+
+func TestClone(t *testing.T) {
+	doc := MustParse(testConfig)
+	c := doc.Clone()
+	if got, want := c.String(), doc.String(); got != want {
+		t.Fatalf("expected %s but %s", want, got)
+	}
+	FindOne(c, "top").FirstChild = nil
+	if FindOne(doc, "top/sites") == nil {
+		t.Fatal("modifying the clone modified the original")
+	}
+}
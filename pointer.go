@@ -0,0 +1,205 @@
+package jsonquery
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// A PointerNotFoundError is returned by ResolvePointer if a reference
+// token of the pointer does not match any node, including the "-" token
+// which refers to the (nonexistent) element after the last array element.
+type PointerNotFoundError struct {
+	Pointer string
+	// Token is the unescaped reference token that was not found.
+	Token string
+}
+
+func (e *PointerNotFoundError) Error() string {
+	return fmt.Sprintf("pointer %s: %q not found", e.Pointer, e.Token)
+}
+
+// ResolvePointer returns the node of doc referenced by the JSON Pointer
+// ptr as defined by RFC 6901, such as `/foo/0` or `/a~1b`. The empty
+// pointer references doc itself. Return a *PointerNotFoundError if ptr
+// references a node that does not exist.
+func ResolvePointer(doc *Node, ptr string) (*Node, error) {
+	if ptr == "" {
+		return doc, nil
+	}
+	if ptr[0] != '/' {
+		return nil, fmt.Errorf("pointer %s: must be empty or start with /", ptr)
+	}
+	n := doc
+	for _, token := range strings.Split(ptr[1:], "/") {
+		token = unescapePointerToken(token)
+		var next *Node
+		switch n.ElType {
+		case MapNode:
+			next = n.selectMember(token)
+		case ArrayNode:
+			if token == "-" {
+				break
+			}
+			i, ok := pointerIndex(token)
+			if !ok {
+				return nil, fmt.Errorf("pointer %s: invalid array index %q", ptr, token)
+			}
+			for c := n.FirstChild; c != nil; c = c.NextSibling {
+				if i == 0 {
+					next = c
+					break
+				}
+				i--
+			}
+		}
+		if next == nil || next.Type != ElementNode {
+			return nil, &PointerNotFoundError{Pointer: ptr, Token: token}
+		}
+		n = next
+	}
+	return n, nil
+}
+
+// nodeKey returns the name of an object member or the index of an array
+// item, which is the key of a text node's parent for a text node.
+func nodeKey(n *Node) string {
+	if n.Type == TextNode && n.Parent != nil {
+		n = n.Parent
+	}
+	if n.Parent == nil || n.Parent.ElType != ArrayNode {
+		return n.Data
+	}
+	i := 0
+	for c := n.Parent.FirstChild; c != n; c = c.NextSibling {
+		if c.Type == ElementNode {
+			i++
+		}
+	}
+	return strconv.Itoa(i)
+}
+
+// nodePointer returns the JSON Pointer of n from the root of its tree,
+// which is the pointer of a text node's parent for a text node.
+func nodePointer(n *Node) string {
+	if n.Type == TextNode && n.Parent != nil {
+		n = n.Parent
+	}
+	if n.Parent == nil {
+		return ""
+	}
+	return nodePointer(n.Parent) + "/" + escapePointerToken(nodeKey(n))
+}
+
+// A keyer computes the keys of nodes as nodeKey does, numbering all the
+// items of an array the first time the key of one of them is asked for,
+// so that the keys of many items take a single walk of the array.
+type keyer map[*Node]int
+
+func (k keyer) key(n *Node) string {
+	if n.Type == TextNode && n.Parent != nil {
+		n = n.Parent
+	}
+	if n.Parent == nil || n.Parent.ElType != ArrayNode {
+		return n.Data
+	}
+	i, ok := k[n]
+	if !ok {
+		j := 0
+		for c := n.Parent.FirstChild; c != nil; c = c.NextSibling {
+			if c.Type == ElementNode {
+				k[c] = j
+				j++
+			}
+		}
+		i = k[n]
+	}
+	return strconv.Itoa(i)
+}
+
+// A locator computes the locations of nodes, remembering those of their
+// ancestors so that nodes sharing them are located without walking up to
+// the root again.
+type locator struct {
+	locs map[*Node]location
+	keys keyer
+}
+
+type location struct {
+	path, pointer string
+}
+
+func newLocator() *locator {
+	return &locator{locs: make(map[*Node]location), keys: make(keyer)}
+}
+
+// locate returns the XPath location path of n from the root of its tree,
+// such as "/top/people/*[2]/name", and its JSON Pointer. A text node has
+// the location of its parent.
+func (l *locator) locate(n *Node) location {
+	if n.Type == TextNode && n.Parent != nil {
+		n = n.Parent
+	}
+	if n.Parent == nil {
+		return location{}
+	}
+	if loc, ok := l.locs[n]; ok {
+		return loc
+	}
+	loc := l.locate(n.Parent)
+	key := l.keys.key(n)
+	if n.Parent.ElType == ArrayNode {
+		i, _ := strconv.Atoi(key)
+		loc.path += "/*[" + strconv.Itoa(i+1) + "]"
+	} else {
+		loc.path += "/" + nameTest(key)
+	}
+	loc.pointer += "/" + escapePointerToken(key)
+	l.locs[n] = loc
+	return loc
+}
+
+func unescapePointerToken(token string) string {
+	return strings.Replace(strings.Replace(token, "~1", "/", -1), "~0", "~", -1)
+}
+
+func escapePointerToken(token string) string {
+	return strings.Replace(strings.Replace(token, "~", "~0", -1), "/", "~1", -1)
+}
+
+// pointerIndex parses an array index reference token, which has no
+// leading zeros.
+func pointerIndex(token string) (int, bool) {
+	if len(token) > 1 && token[0] == '0' {
+		return 0, false
+	}
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 || token[0] == '+' {
+		return 0, false
+	}
+	return i, true
+}
+
+// pointerFunc is pointer(string), the node referenced by a JSON Pointer
+// from the root of the node tree, or an empty node-set if the node does
+// not exist or the argument is an empty node-set. The argument may be a
+// node holding the pointer, to follow references as in
+// `//items/*[pointer(ref)/v = 1]`.
+func pointerFunc(root *Node, args ...interface{}) (interface{}, error) {
+	if len(args) != 1 {
+		return nil, errors.New("expected 1 argument")
+	}
+	if nodes, ok := args[0].([]*Node); ok && len(nodes) == 0 {
+		return []*Node{}, nil
+	}
+	n, err := ResolvePointer(root, stringArg(args[0]))
+	if err != nil {
+		var notFound *PointerNotFoundError
+		if errors.As(err, &notFound) {
+			return []*Node{}, nil
+		}
+		return nil, err
+	}
+	return []*Node{n}, nil
+}
@@ -0,0 +1,136 @@
+package jsonquery
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestResolvePointer(t *testing.T) {
+	// The example document of RFC 6901, section 5.
+	doc := MustParse(`{
+		"foo": ["bar", "baz"],
+		"": 0,
+		"a/b": 1,
+		"c%d": 2,
+		"e^f": 3,
+		"g|h": 4,
+		"i\\j": 5,
+		"k\"l": 6,
+		" ": 7,
+		"m~n": 8
+	}`)
+	for _, v := range []struct {
+		ptr, json string
+	}{
+		{"", `{"":0," ":7,"a/b":1,"c%d":2,"e^f":3,"foo":["bar","baz"],"g|h":4,"i\\j":5,"k\"l":6,"m~n":8}`},
+		{"/foo", `["bar","baz"]`},
+		{"/foo/0", `"bar"`},
+		{"/", `0`},
+		{"/a~1b", `1`},
+		{"/c%d", `2`},
+		{"/e^f", `3`},
+		{"/g|h", `4`},
+		{"/i\\j", `5`},
+		{"/k\"l", `6`},
+		{"/ ", `7`},
+		{"/m~0n", `8`},
+	} {
+		n, err := ResolvePointer(doc, v.ptr)
+		if err != nil {
+			t.Fatalf("%s: %v", v.ptr, err)
+		}
+		if e, g := v.json, n.String(); e != g {
+			t.Fatalf("%s: expected %v but %v", v.ptr, e, g)
+		}
+	}
+
+	escaped := MustParse(`{"~01": {"/": "x"}, "~1": "y"}`)
+	if n, err := ResolvePointer(escaped, "/~001/~1"); err != nil || n.InnerText() != "x" {
+		t.Fatalf("expected x but %v, %v", n, err)
+	}
+	if n, err := ResolvePointer(escaped, "/~01"); err != nil || n.InnerText() != "y" {
+		t.Fatalf("expected y but %v, %v", n, err)
+	}
+
+	for _, ptr := range []string{"/foo/-", "/foo/2", "/missing", "/foo/0/x"} {
+		_, err := ResolvePointer(doc, ptr)
+		var notFound *PointerNotFoundError
+		if !errors.As(err, &notFound) {
+			t.Fatalf("%s: expected PointerNotFoundError but %v", ptr, err)
+		}
+	}
+	if _, err := ResolvePointer(doc, "/foo/-"); err.(*PointerNotFoundError).Token != "-" {
+		t.Fatalf("expected token - but %v", err)
+	}
+	for _, ptr := range []string{"foo", "/foo/01", "/foo/x"} {
+		if _, err := ResolvePointer(doc, ptr); err == nil {
+			t.Fatalf("%s: expected error", ptr)
+		}
+	}
+}
+
+func TestPointerFunc(t *testing.T) {
+	doc, err := parseString(testConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nodes, err := QueryAll(doc, "//route-instance/*[metric < pointer('/top/route-instance/ri2/metric')]")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nodes) != 1 || nodes[0].Data != "ri1" {
+		t.Fatalf("expected ri1 but %v", nodes)
+	}
+	nodes, err = QueryAll(doc, "//people/*[name = pointer('/top/people/1/name')]")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nodes) != 1 || nodes[0].SelectElement("age").InnerText() != "2" {
+		t.Fatalf("expected mark but %v", nodes)
+	}
+	v, err := Evaluate(doc, "pointer('/top/sites/0/ri3/ospf/areas/0/area_id')")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nodes, ok := v.([]*Node); !ok || len(nodes) != 1 || nodes[0].InnerText() != "0.0.0.2" {
+		t.Fatalf("expected 0.0.0.2 but %v", v)
+	}
+	if nodes, _ := QueryAll(doc, "//people/*[name = pointer('/top/missing')]"); len(nodes) != 0 {
+		t.Fatalf("expected no nodes but %v", nodes)
+	}
+	if _, err := QueryAll(doc, "//people/*[name = pointer('top')]"); err == nil {
+		t.Fatal("expected error for invalid pointer")
+	}
+
+	// The argument may be a node holding a reference, and the result can
+	// be navigated.
+	refs := MustParse(`{
+		"defs": {"x": {"v": 1}, "y": {"v": 2}},
+		"items": [
+			{"id": "a", "ref": "/defs/x"},
+			{"id": "b", "ref": "/defs/y"},
+			{"id": "c", "ref": "/defs/missing"},
+			{"id": "d"}
+		]
+	}`)
+	for _, test := range []struct {
+		expr string
+		want string
+	}{
+		{"//items/*[pointer(ref)/v = 1]/id", "a"},
+		{"//items/*[pointer(ref)]/id", "a,b"},
+		{"//items/*[not(pointer(ref))]/id", "c,d"},
+		{"pointer('/defs/x')/v", "1"},
+		{"pointer(//items/*[2]/ref)/../x/v", "1"},
+		{"pointer('/defs')/*[v > 1]/v", "2"},
+	} {
+		assertQuery(t, refs, test.expr, test.want)
+	}
+	x, _ := ResolvePointer(refs, "/defs/x/v")
+	if n, err := Query(refs, "pointer('/defs/x')/v"); err != nil || n != x {
+		t.Fatalf("expected the node of the document but %v, %v", n, err)
+	}
+	if v, err := Evaluate(refs, "name(pointer('/defs/y'))"); err != nil || v != "y" {
+		t.Fatalf("expected y but %v, %v", v, err)
+	}
+}
@@ -2,13 +2,19 @@ package jsonquery
 
 import (
 	"fmt"
+	"strings"
+	"unicode"
 
 	"github.com/antchfx/xpath"
 )
 
 var _ xpath.NodeNavigator = &NodeNavigator{}
 
-// CreateXPathNavigator creates a new xpath.NodeNavigator for the specified html.Node.
+// CreateXPathNavigator creates a new xpath.NodeNavigator positioned on
+// top, for evaluating expressions compiled with github.com/antchfx/xpath
+// directly, such as with xpath.Expr.Select or xpath.Expr.Evaluate. top is
+// the root of the navigator: the node `/` selects, and the one MoveToRoot
+// moves to. See NodeNavigator for how the tree is presented.
 func CreateXPathNavigator(top *Node) *NodeNavigator {
 	return &NodeNavigator{cur: top, root: top}
 }
@@ -32,13 +38,26 @@ func FindOne(top *Node, expr string) *Node {
 }
 
 // QueryAll searches the Node that matches by the specified XPath expr.
+// Nodes are returned in document order without duplicates, even if
+// the expression selects them through several paths, such as a union.
 // Return an error if the expression `expr` cannot be parsed.
 func QueryAll(top *Node, expr string) ([]*Node, error) {
+	return QueryAllVars(top, expr, nil)
+}
+
+// QueryAllVars is like QueryAll but binds the variables referenced as
+// `$name` in expr to the values in vars. A value must be a string, a
+// bool or a number, and keeps its XPath type, so `[$s]` is false for an
+// empty string. Values are never spliced into the expression, so a string
+// containing quotes is matched literally.
+// Return an error if the expression `expr` cannot be parsed or references
+// a variable missing from vars.
+func QueryAllVars(top *Node, expr string, vars map[string]interface{}) ([]*Node, error) {
 	exp, err := getQuery(expr)
 	if err != nil {
 		return nil, err
 	}
-	return QuerySelectorAll(top, exp), nil
+	return exp.QueryAllVars(top, vars)
 }
 
 // Query searches the Node that matches by the specified XPath expr,
@@ -48,7 +67,240 @@ func Query(top *Node, expr string) (*Node, error) {
 	if err != nil {
 		return nil, err
 	}
-	return QuerySelector(top, exp), nil
+	return exp.Query(top)
+}
+
+// QueryAt searches the Node that matches by the specified XPath expr,
+// and returns the index-th (0-based) element of matched across the whole
+// document. Return an error if the expression `expr` cannot be parsed or
+// fewer than index+1 nodes matched.
+func QueryAt(top *Node, expr string, index int) (node *Node, err error) {
+	exp, err := getQuery(expr)
+	if err != nil {
+		return nil, err
+	}
+	if index < 0 {
+		return nil, fmt.Errorf("index %d out of range", index)
+	}
+	t, err := exp.selectVars(top, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer recoverFuncError(&err)
+	for i := 0; t.MoveNext(); i++ {
+		if i == index {
+			return t.Current().(*NodeNavigator).node(), nil
+		}
+	}
+	return nil, fmt.Errorf("index %d out of range", index)
+}
+
+// Evaluate evaluates the XPath expr against top and returns the result,
+// which is one of float64, string, bool or []*Node, or []interface{} for
+// a for expression, as described by Expr.Evaluate.
+// Return an error if the expression `expr` cannot be parsed.
+func Evaluate(top *Node, expr string) (interface{}, error) {
+	exp, err := getQuery(expr)
+	if err != nil {
+		return nil, err
+	}
+	return exp.Evaluate(top)
+}
+
+// QueryAggregate evaluates the XPath expr against top and returns its
+// numeric result, such as the result of sum(), avg(), min(), max() or
+// count(). Unlike in other queries, sum() reports a value that is not
+// numeric instead of returning NaN.
+// Return an error if the expression `expr` cannot be parsed, its result
+// is not a number or a value it aggregates is not numeric.
+func QueryAggregate(top *Node, expr string) (float64, error) {
+	exp, err := CompileFuncs(expr, aggregateFuncs)
+	if err != nil {
+		return 0, err
+	}
+	v, err := exp.Evaluate(top)
+	if err != nil {
+		return 0, err
+	}
+	f, ok := v.(float64)
+	if !ok {
+		return 0, fmt.Errorf("%s is not a numeric expression", expr)
+	}
+	return f, nil
+}
+
+// QueryDistinct is like QueryAll but only returns the first node of the
+// nodes that have the same InnerText.
+func QueryDistinct(top *Node, expr string) ([]*Node, error) {
+	nodes, err := QueryAll(top, expr)
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	distinct := nodes[:0]
+	for _, n := range nodes {
+		if s := n.InnerText(); !seen[s] {
+			seen[s] = true
+			distinct = append(distinct, n)
+		}
+	}
+	return distinct, nil
+}
+
+// Exists reports whether any node matches the specified XPath expr. It
+// stops at the first match.
+// Return an error if the expression `expr` cannot be parsed.
+func Exists(top *Node, expr string) (ok bool, err error) {
+	exp, err := getQuery(expr)
+	if err != nil {
+		return false, err
+	}
+	t, err := exp.selectVars(top, nil)
+	if err != nil {
+		return false, err
+	}
+	defer recoverFuncError(&err)
+	return t.MoveNext(), nil
+}
+
+// Count returns the number of distinct nodes that match the specified
+// XPath expr, without collecting them.
+// Return an error if the expression `expr` cannot be parsed.
+func Count(top *Node, expr string) (count int, err error) {
+	exp, err := getQuery(expr)
+	if err != nil {
+		return 0, err
+	}
+	t, err := exp.selectVars(top, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer recoverFuncError(&err)
+	seen := make(map[*Node]bool)
+	for t.MoveNext() {
+		n := t.Current().(*NodeNavigator).node()
+		if !seen[n] {
+			seen[n] = true
+			count++
+		}
+	}
+	return count, nil
+}
+
+// ValueOf returns the text of the first node that matches the specified
+// XPath expr, or an empty string if no node matches.
+// Return an error if the expression `expr` cannot be parsed.
+func ValueOf(top *Node, expr string) (string, error) {
+	n, err := Query(top, expr)
+	if err != nil || n == nil {
+		return "", err
+	}
+	return n.InnerText(), nil
+}
+
+// A Match is a node matched by QueryAllWithPaths with its location.
+type Match struct {
+	Node *Node
+	// Key is the name of the member or the index of the array item
+	// matched, such as "ri1" or "0". For a text node, it is the key of
+	// its parent.
+	Key string
+	// Path is the XPath location path of the node from the root, which
+	// selects only this node, such as "/top/people/*[1]/name". For a text
+	// node, it is the path of its parent.
+	Path string
+	// Pointer is the JSON Pointer of the node from the root, such as
+	// "/top/route-instance/ri1".
+	Pointer string
+}
+
+// QueryAllWithPaths is like QueryAll but returns the location of every
+// node matched along with it. The locations of the ancestors shared by
+// the nodes are only computed once.
+// Return an error if the expression `expr` cannot be parsed.
+func QueryAllWithPaths(top *Node, expr string) ([]Match, error) {
+	nodes, err := QueryAll(top, expr)
+	if err != nil {
+		return nil, err
+	}
+	return newMatches(nodes, newLocator()), nil
+}
+
+func newMatches(nodes []*Node, l *locator) []Match {
+	matches := make([]Match, len(nodes))
+	for i, n := range nodes {
+		loc := l.locate(n)
+		matches[i] = Match{Node: n, Key: l.keys.key(n), Path: loc.path, Pointer: loc.pointer}
+	}
+	return matches
+}
+
+// QueryOptions configures QueryAllWithOptions.
+type QueryOptions struct {
+	// CaseInsensitive makes the names in the expression match the keys
+	// of objects regardless of case, so `//name` matches "Name" and
+	// "NAME". Comparisons of values are not affected, but name() and
+	// local-name() return lower case names.
+	CaseInsensitive bool
+}
+
+// QueryAllWithOptions is like QueryAll but configured by opts.
+// Return an error if the expression `expr` cannot be parsed.
+func QueryAllWithOptions(top *Node, expr string, opts QueryOptions) ([]*Node, error) {
+	if !opts.CaseInsensitive {
+		return QueryAll(top, expr)
+	}
+	exp, err := getQuery(foldNameTests(expr))
+	if err != nil {
+		return nil, err
+	}
+	folded := *exp
+	folded.foldCase = true
+	return folded.QueryAll(top)
+}
+
+// foldNameTests returns expr with the names of its name tests in lower
+// case, leaving string literals, variables, functions, node type tests
+// and axes unchanged.
+func foldNameTests(expr string) string {
+	var (
+		buf strings.Builder
+		rs  = []rune(expr)
+	)
+	for i := 0; i < len(rs); {
+		r := rs[i]
+		j := i + 1
+		switch {
+		case r == '\'' || r == '"':
+			for j < len(rs) && rs[j] != r {
+				j++
+			}
+			if j < len(rs) {
+				j++
+			}
+		case r == '$' || unicode.IsDigit(r):
+			for j < len(rs) && isNameChar(rs[j]) {
+				j++
+			}
+		case isNameStart(r):
+			for j < len(rs) && isNameChar(rs[j]) {
+				j++
+			}
+			k := j
+			for k < len(rs) && unicode.IsSpace(rs[k]) {
+				k++
+			}
+			rest := string(rs[k:])
+			if !strings.HasPrefix(rest, "(") && !strings.HasPrefix(rest, "::") {
+				buf.WriteString(strings.ToLower(string(rs[i:j])))
+				i = j
+				continue
+			}
+		}
+		buf.WriteString(string(rs[i:j]))
+		i = j
+	}
+	return buf.String()
 }
 
 // QuerySelectorAll searches all of the Node that matches the specified XPath selectors.
@@ -56,7 +308,7 @@ func QuerySelectorAll(top *Node, selector *xpath.Expr) []*Node {
 	t := selector.Select(CreateXPathNavigator(top))
 	var elems []*Node
 	for t.MoveNext() {
-		elems = append(elems, (t.Current().(*NodeNavigator)).cur)
+		elems = append(elems, t.Current().(*NodeNavigator).node())
 	}
 	return elems
 }
@@ -65,21 +317,63 @@ func QuerySelectorAll(top *Node, selector *xpath.Expr) []*Node {
 func QuerySelector(top *Node, selector *xpath.Expr) *Node {
 	t := selector.Select(CreateXPathNavigator(top))
 	if t.MoveNext() {
-		return (t.Current().(*NodeNavigator)).cur
+		return t.Current().(*NodeNavigator).node()
 	}
 	return nil
 }
 
-// NodeNavigator is for navigating JSON document.
+// NodeNavigator is an xpath.NodeNavigator over a Node tree, which presents
+// a JSON document as follows:
+//
+//   - A DocumentNode is the root node, an ElementNode an element and a
+//     TextNode a text node.
+//   - The members of an object are elements named after their key, in
+//     the order of the tree, which is key order for a parsed document.
+//     The items of an array are elements with an empty name,
+//     in array order, so they are selected by `*` and not by a name test,
+//     and name() returns "" for them.
+//   - A string, number or boolean is an element holding a text node with
+//     its text, such as "45" or "true". A null or empty container has no
+//     child.
+//   - The value of an element, and of an expression such as string(.) on
+//     it, is the concatenation of the text of its descendants, like
+//     InnerText. The value of the root node is "".
+//   - Nodes have no attributes. The results of the extension functions
+//     of an expression compiled by Compile are exposed as attributes to
+//     that expression only, not to its attribute steps, and the navigator
+//     of CreateXPathNavigator does not evaluate them.
+//
+// MoveToParent is not limited to the subtree of the root: from the root
+// of a navigator created on a node that has a parent, it moves to that
+// parent. MoveToNext and MoveToPrevious move between the members of an
+// object or the items of an array. These semantics are stable.
 type NodeNavigator struct {
 	root, cur *Node
+
+	// ext holds the extension function calls of the expression being
+	// evaluated, exposed as attributes of every node.
+	ext *Expr
+	// vars holds the values of the variables referenced by ext.
+	vars map[string]interface{}
+	// attr is the 1-based index of the current attribute, 0 if the
+	// navigator is on cur itself.
+	attr int
+	// deadline is checked as the navigator moves if the expression has
+	// a timeout.
+	deadline *deadline
+	// foldCase makes the names of elements lower case.
+	foldCase bool
 }
 
+// Current returns the node the navigator is on.
 func (a *NodeNavigator) Current() *Node {
 	return a.cur
 }
 
 func (a *NodeNavigator) NodeType() xpath.NodeType {
+	if a.attr > 0 {
+		return xpath.AttributeNode
+	}
 	switch a.cur.Type {
 	case TextNode:
 		return xpath.TextNode
@@ -93,6 +387,12 @@ func (a *NodeNavigator) NodeType() xpath.NodeType {
 }
 
 func (a *NodeNavigator) LocalName() string {
+	if a.attr > 0 {
+		return funcAttrName(a.attr - 1)
+	}
+	if a.foldCase {
+		return strings.ToLower(a.cur.Data)
+	}
 	return a.cur.Data
 
 }
@@ -102,6 +402,10 @@ func (a *NodeNavigator) Prefix() string {
 }
 
 func (a *NodeNavigator) Value() string {
+	if a.attr > 0 {
+		v, _ := funcValue(a.ext.calls[a.attr-1].evaluate(a))
+		return v
+	}
 	switch a.cur.Type {
 	case ElementNode:
 		return a.cur.InnerText()
@@ -121,6 +425,17 @@ func (a *NodeNavigator) MoveToRoot() {
 }
 
 func (a *NodeNavigator) MoveToParent() bool {
+	a.deadline.check()
+	if a.attr > 0 {
+		// The parent of the attribute of a call or variable whose
+		// value is a node-set is the first node, so that the value can
+		// be navigated.
+		if nodes, ok := a.ext.calls[a.attr-1].evaluate(a).([]*Node); ok && len(nodes) > 0 {
+			a.cur = nodes[0]
+		}
+		a.attr = 0
+		return true
+	}
 	if n := a.cur.Parent; n != nil {
 		a.cur = n
 		return true
@@ -128,11 +443,24 @@ func (a *NodeNavigator) MoveToParent() bool {
 	return false
 }
 
-func (x *NodeNavigator) MoveToNextAttribute() bool {
+func (a *NodeNavigator) MoveToNextAttribute() bool {
+	if a.ext == nil {
+		return false
+	}
+	for i := a.attr; i < len(a.ext.calls); i++ {
+		if _, ok := funcValue(a.ext.calls[i].evaluate(a)); ok {
+			a.attr = i + 1
+			return true
+		}
+	}
 	return false
 }
 
 func (a *NodeNavigator) MoveToChild() bool {
+	a.deadline.check()
+	if a.attr > 0 {
+		return false
+	}
 	if n := a.cur.FirstChild; n != nil {
 		a.cur = n
 		return true
@@ -141,6 +469,9 @@ func (a *NodeNavigator) MoveToChild() bool {
 }
 
 func (a *NodeNavigator) MoveToFirst() bool {
+	if a.attr > 0 {
+		return false
+	}
 	for n := a.cur.PrevSibling; n != nil; n = n.PrevSibling {
 		a.cur = n
 	}
@@ -152,6 +483,10 @@ func (a *NodeNavigator) String() string {
 }
 
 func (a *NodeNavigator) MoveToNext() bool {
+	a.deadline.check()
+	if a.attr > 0 {
+		return false
+	}
 	if n := a.cur.NextSibling; n != nil {
 		a.cur = n
 		return true
@@ -160,6 +495,10 @@ func (a *NodeNavigator) MoveToNext() bool {
 }
 
 func (a *NodeNavigator) MoveToPrevious() bool {
+	a.deadline.check()
+	if a.attr > 0 {
+		return false
+	}
 	if n := a.cur.PrevSibling; n != nil {
 		a.cur = n
 		return true
@@ -173,5 +512,21 @@ func (a *NodeNavigator) MoveTo(other xpath.NodeNavigator) bool {
 		return false
 	}
 	a.cur = node.cur
+	a.attr = node.attr
 	return true
 }
+
+// at returns a navigator at cur for the expression ext, sharing the root,
+// variables and deadline of a.
+func (a *NodeNavigator) at(ext *Expr, cur *Node) *NodeNavigator {
+	return &NodeNavigator{root: a.root, cur: cur, ext: ext, vars: a.vars, deadline: a.deadline, foldCase: a.foldCase}
+}
+
+// node returns the current node, or a detached text node holding the
+// value of the current attribute.
+func (a *NodeNavigator) node() *Node {
+	if a.attr > 0 {
+		return &Node{Type: TextNode, Data: a.Value()}
+	}
+	return a.cur
+}
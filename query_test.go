@@ -1,8 +1,14 @@
 package jsonquery
 
 import (
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/antchfx/xpath"
 )
@@ -131,3 +137,1029 @@ func TestNavigator(t *testing.T) {
 		t.Fatalf("node type is not DocumentNode")
 	}
 }
+
+func TestQueryAt(t *testing.T) {
+	s := `{
+		"name":"John",
+		"age":30,
+		"cars": [
+			{ "name":"Ford", "models":[ "Fiesta", "Focus", "Mustang" ] },
+			{ "name":"BMW", "models":[ "320", "X3", "X5" ] },
+			{ "name":"Fiat", "models":[ "500", "Panda" ] }
+		]
+	 }`
+	doc, _ := parseString(s)
+	n, err := QueryAt(doc, "//name", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e, g := "BMW", n.InnerText(); e != g {
+		t.Fatalf("expected %v but %v", e, g)
+	}
+	if _, err := QueryAt(doc, "//name", 4); err == nil {
+		t.Fatal("expected out of range error")
+	}
+	if _, err := QueryAt(doc, "//name", -1); err == nil {
+		t.Fatal("expected out of range error")
+	}
+}
+
+func TestQueryAllVars(t *testing.T) {
+	s := `{
+		"people": [
+			{ "name": "joe", "age": 45 },
+			{ "name": "mark", "age": 2 },
+			{ "name": "O'Brien \"Bob\"", "age": 30 }
+		]
+	}`
+	doc, _ := parseString(s)
+	names := func(nodes []*Node) string {
+		var a []string
+		for _, n := range nodes {
+			a = append(a, n.SelectElement("name").InnerText())
+		}
+		return strings.Join(a, ",")
+	}
+
+	nodes, err := QueryAllVars(doc, "//people/*[age < $maxAge][name = $who]", map[string]interface{}{
+		"maxAge": 44,
+		"who":    "mark",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e, g := "mark", names(nodes); e != g {
+		t.Fatalf("expected %v but %v", e, g)
+	}
+
+	who := `O'Brien "Bob"`
+	nodes, err = QueryAllVars(doc, "//people/*[name = $who]", map[string]interface{}{"who": who})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e, g := who, names(nodes); e != g {
+		t.Fatalf("expected %v but %v", e, g)
+	}
+
+	nodes, err = QueryAllVars(doc, "//people/*[$all or age > 40]", map[string]interface{}{"all": false})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e, g := "joe", names(nodes); e != g {
+		t.Fatalf("expected %v but %v", e, g)
+	}
+
+	if _, err := QueryAllVars(doc, "//people/*[name = $who]", nil); err == nil {
+		t.Fatal("expected error for undeclared variable")
+	}
+	if _, err := QueryAll(doc, "//people/*[name = $who]"); err == nil {
+		t.Fatal("expected error for undeclared variable")
+	}
+	if _, err := QueryAllVars(doc, "//people/*[name = $who]", map[string]interface{}{"who": []string{}}); err == nil {
+		t.Fatal("expected error for unsupported variable type")
+	}
+
+	// Variables keep their XPath types.
+	for _, test := range []struct {
+		expr string
+		vars map[string]interface{}
+		want string
+	}{
+		{"//people/*[$s]", map[string]interface{}{"s": ""}, ""},
+		{"//people/*[$s]", map[string]interface{}{"s": "x"}, "joe,mark,O'Brien \"Bob\""},
+		{"//people/*[$n]", map[string]interface{}{"n": 0}, ""},
+		{"//people/*[$n]", map[string]interface{}{"n": 2}, "mark"},
+		{"//people/*[boolean($b)]", map[string]interface{}{"b": false}, ""},
+		{"//people/*[name = $s]", map[string]interface{}{"s": ""}, ""},
+		{"//people/*[age - $n = 0]", map[string]interface{}{"n": 2}, "mark"},
+		{"//people/*[0-$n = age]", map[string]interface{}{"n": -45}, "joe"},
+		{"//people/*[age > $n]", map[string]interface{}{"n": math.Inf(-1)}, "joe,mark,O'Brien \"Bob\""},
+		// The attributes holding the variables are not attributes of
+		// the nodes.
+		{"//people/*[count(@*) = 0 and $n = 1]", map[string]interface{}{"n": 1}, "joe,mark,O'Brien \"Bob\""},
+		{"//people/*[@* or attribute::name or $n = 0]", map[string]interface{}{"n": 1}, ""},
+	} {
+		nodes, err := QueryAllVars(doc, test.expr, test.vars)
+		if err != nil {
+			t.Fatalf("%s: %v", test.expr, err)
+		}
+		if g := names(nodes); g != test.want {
+			t.Fatalf("%s with %v: expected %v but %v", test.expr, test.vars, test.want, g)
+		}
+	}
+}
+
+func TestQueryAllDocumentOrder(t *testing.T) {
+	doc, _ := parseString(testConfig)
+	for _, expr := range []string{
+		"//*[metric] | //route-instance//*",
+		"//route-instance//* | //*[metric]",
+		"//metric | //ri1 | //top | //metric",
+		"//sites//metric | //route-instance/*/metric",
+	} {
+		nodes, err := QueryAll(doc, expr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		seen := make(map[*Node]bool)
+		for i, n := range nodes {
+			if seen[n] {
+				t.Fatalf("%s: duplicate node %v", expr, n)
+			}
+			seen[n] = true
+			if i > 0 && !precedes(nodes[i-1], n) {
+				t.Fatalf("%s: %v is not before %v", expr, nodes[i-1], n)
+			}
+		}
+	}
+
+	nodes, _ := QueryAll(doc, "//*[metric] | //route-instance//*")
+	var a []string
+	for _, n := range nodes {
+		a = append(a, n.Data+"="+n.InnerText())
+	}
+	if e, g := "ri1=24,metric=24,ri2=89,metric=89,=0.0.0.00,=0.0.0.11,=0.0.0.22", strings.Join(a, ","); e != g {
+		t.Fatalf("expected %v but %v", e, g)
+	}
+}
+
+// assertQuery reports an error unless the nodes expr selects from doc
+// have the values want, joined by commas. The value of an object or
+// array is its name, and that of any other node its text.
+func assertQuery(t *testing.T, doc *Node, expr, want string) {
+	t.Helper()
+	assertQueryVars(t, doc, expr, nil, want)
+}
+
+// assertQueryVars is like assertQuery, with the variables of expr bound
+// to vars.
+func assertQueryVars(t *testing.T, doc *Node, expr string, vars map[string]interface{}, want string) {
+	t.Helper()
+	nodes, err := QueryAllVars(doc, expr, vars)
+	if err != nil {
+		t.Errorf("%s: %v", expr, err)
+		return
+	}
+	a := make([]string, len(nodes))
+	for i, n := range nodes {
+		if n.ElType == MapNode || n.ElType == ArrayNode {
+			a[i] = n.Data
+		} else {
+			a[i] = n.InnerText()
+		}
+	}
+	if g := strings.Join(a, ","); g != want {
+		t.Errorf("%s: expected %v but %v", expr, want, g)
+	}
+}
+
+func TestQueryAncestorAxes(t *testing.T) {
+	doc, _ := parseString(testConfig)
+	tests := []struct {
+		expr, want string
+	}{
+		// The parent of an array item is the array, whose parent is the
+		// object holding it.
+		{"//areas/*[metric > 1]/parent::*", "areas"},
+		{"//areas/*[metric > 1]/parent::*/parent::ospf/..", "ri3"},
+		{"//areas/*[metric = 1]/../..", "ospf"},
+		{"//sites//metric/ancestor::*[ospf]", "ri1,ri2,ri3"},
+		{"//route-instance/*/metric/ancestor::route-instance", "route-instance"},
+		{"//metric[. = 0]/ancestor::*", "top,sites,,ri1,ospf,areas,"},
+		{"//route-instance/*/metric/ancestor-or-self::*[metric]", "ri1,ri2"},
+		{"//sites//metric/parent::*/parent::areas/parent::ospf", "ospf,ospf,ospf"},
+	}
+	for _, test := range tests {
+		assertQuery(t, doc, test.expr, test.want)
+	}
+}
+
+func TestQuerySiblingAxes(t *testing.T) {
+	doc := MustParse(`{"models":["Fiesta","Focus","Mustang","Puma"],"car":{"year":2020,"make":"Ford","model":"Focus"}}`)
+	tests := []struct {
+		expr, want string
+	}{
+		// Array items have no name, so they are matched by *.
+		{"//models/*[. = 'Focus']/following-sibling::*", "Mustang,Puma"},
+		{"//models/*[. = 'Mustang']/preceding-sibling::*", "Fiesta,Focus"},
+		{"//models/*[. = 'Focus']/following-sibling::*[1]", "Mustang"},
+		{"//models/*[. = 'Mustang']/preceding-sibling::*[1]", "Focus"},
+		{"//models/*[last()]/following-sibling::*", ""},
+		// Object members are ordered by key.
+		{"car/make/following-sibling::*", "Focus,2020"},
+		{"car/model/preceding-sibling::make", "Ford"},
+		{"car/year/preceding-sibling::*", "Ford,Focus"},
+	}
+	for _, test := range tests {
+		assertQuery(t, doc, test.expr, test.want)
+	}
+
+	// Members added by a merge patch follow the existing members.
+	if err := ApplyMergePatch(doc, []byte(`{"car":{"color":"red"}}`)); err != nil {
+		t.Fatal(err)
+	}
+	if n := FindOne(doc, "car/year/following-sibling::*"); n == nil || n.Data != "color" {
+		t.Fatalf("expected color after year but %v", n)
+	}
+}
+
+func TestQueryNestedPredicates(t *testing.T) {
+	doc, _ := parseString(testConfig)
+	tests := []struct {
+		expr, want string
+	}{
+		// The unnamed site object holds ri1, ri2 and ri3.
+		{"//sites/*[.//areas/*[metric > 1]]/*", "ri1,ri2,ri3"},
+		{"//sites/*[.//areas/*[metric > 5]]/*", ""},
+		{"//sites/*/*[.//areas/*[metric > 0]]", "ri2,ri3"},
+		{"//sites/*/*[ospf/areas/*[metric >= 1][area_id = '0.0.0.1']]", "ri2"},
+		{"//sites/*/*[not(.//areas/*[metric > 0])]", "ri1"},
+		{"//sites/*/*[.//areas/*[metric > $min]]", "ri3"},
+		{"//sites/*/*[.//areas/*[metric = max(//sites//metric)]]", "ri3"},
+		{"//top[sites/*[ri1/ospf//*[metric = 0]]]/people/*[1]/name", "joe"},
+	}
+	for _, test := range tests {
+		assertQueryVars(t, doc, test.expr, map[string]interface{}{"min": 1}, test.want)
+	}
+}
+
+func TestExprWithTimeout(t *testing.T) {
+	var b strings.Builder
+	b.WriteString(`{"items":[`)
+	for i := 0; i < 3000; i++ {
+		if i > 0 {
+			b.WriteString(",")
+		}
+		fmt.Fprintf(&b, `{"id":%d,"tags":{"a":{"b":"%d"}}}`, i, i%7)
+	}
+	b.WriteString(`]}`)
+	doc := MustParse(b.String())
+
+	// Every node compares itself with every leaf of the document.
+	expr, err := Compile("//*[. = //b][count(//*[. = //id]) > 0]")
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	_, err = expr.WithTimeout(50 * time.Millisecond).QueryAll(doc)
+	if err != ErrQueryTimeout {
+		t.Fatalf("expected ErrQueryTimeout but %v", err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Fatalf("expected the query to stop after its timeout but it ran %v", d)
+	}
+	if _, err := expr.WithTimeout(time.Millisecond).Evaluate(doc); err != ErrQueryTimeout {
+		t.Fatalf("expected ErrQueryTimeout but %v", err)
+	}
+
+	nodes, err := expr.WithTimeout(time.Minute).QueryAll(MustParse(`{"a":{"b":"1","id":1}}`))
+	if err != nil || len(nodes) != 2 {
+		t.Fatalf("expected b and id but %v, %v", nodes, err)
+	}
+}
+
+func TestExistsCountValueOf(t *testing.T) {
+	doc, _ := parseString(testConfig)
+	visits := 0
+	RegisterFunction("test-visit", func(args ...interface{}) (interface{}, error) {
+		visits++
+		return true, nil
+	})
+
+	ok, err := Exists(doc, "//people/*[test-visit()]")
+	if err != nil || !ok {
+		t.Fatalf("expected a match but %v, %v", ok, err)
+	}
+	if visits != 1 {
+		t.Fatalf("expected Exists to stop at the first match but %d nodes were visited", visits)
+	}
+	if ok, _ := Exists(doc, "//people/*[age > 100]"); ok {
+		t.Fatal("expected no match")
+	}
+
+	visits = 0
+	n, err := Count(doc, "//*[metric][test-visit()]")
+	if err != nil || n != 5 {
+		t.Fatalf("expected 5 but %v, %v", n, err)
+	}
+	if visits != 5 {
+		t.Fatalf("expected 5 nodes visited but %d", visits)
+	}
+	if n, _ := Count(doc, "//metric | //ri1/metric"); n != 5 {
+		t.Fatalf("expected 5 distinct nodes but %v", n)
+	}
+	if n, _ := Count(doc, "//missing"); n != 0 {
+		t.Fatalf("expected 0 but %v", n)
+	}
+
+	if v, err := ValueOf(doc, "//people/*[age < 10]/name"); err != nil || v != "mark" {
+		t.Fatalf("expected mark but %v, %v", v, err)
+	}
+	if v, err := ValueOf(doc, "//missing"); err != nil || v != "" {
+		t.Fatalf("expected empty string but %v, %v", v, err)
+	}
+	for _, f := range []func() error{
+		func() error { _, err := Exists(doc, "//["); return err },
+		func() error { _, err := Count(doc, "//["); return err },
+		func() error { _, err := ValueOf(doc, "//["); return err },
+	} {
+		if f() == nil {
+			t.Fatal("expected error for invalid expression")
+		}
+	}
+}
+
+func TestQueryNot(t *testing.T) {
+	doc, _ := parseString(testConfig)
+	tests := []struct {
+		expr, want string
+	}{
+		{`//people/*[not(contains(name, "joe"))]/name`, "mark"},
+		{`//people/*[not(starts-with(name, 'm'))]/name`, "joe"},
+		{`//people/*[not(age > 10 and name = 'joe')]/name`, "mark"},
+		{`//people/*[not(not(age > 10))]/name`, "joe"},
+		{`//route-instance/*[not(metric)]`, ""},
+		{`//people/*[not(missing)]/name`, "joe,mark"},
+	}
+	for _, test := range tests {
+		assertQuery(t, doc, test.expr, test.want)
+	}
+}
+
+func TestQueryAllVarsInjection(t *testing.T) {
+	doc, _ := parseString(testConfig)
+	for _, test := range []struct {
+		target string
+		want   int
+	}{
+		{"joe", 1},
+		// Input that would rewrite a spliced expression matches nothing.
+		{"joe' or '1'='1", 0},
+		{`"] | //* | //name["`, 0},
+		{"$target", 0},
+	} {
+		nodes, err := QueryAllVars(doc, "//name[. = $target]", map[string]interface{}{"target": test.target})
+		if err != nil {
+			t.Fatalf("%q: %v", test.target, err)
+		}
+		if len(nodes) != test.want {
+			t.Fatalf("%q: expected %d nodes but %v", test.target, test.want, nodes)
+		}
+	}
+
+	// The values are looked up while evaluating, so the expression is
+	// only compiled again when the type of a value changes.
+	exp, err := Compile("//people/*[name = $target or age = $target]")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, target := range []interface{}{"joe", "mark", "nobody", 45, 2.0, "joe"} {
+		if _, err := exp.QueryAllVars(doc, map[string]interface{}{"target": target}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if e, g := 2, len(exp.binds.exprs); e != g {
+		t.Fatalf("expected %v compiled copies but %v", e, g)
+	}
+}
+
+func TestQueryError(t *testing.T) {
+	doc, _ := parseString(testConfig)
+	tests := []struct {
+		expr   string
+		offset int
+		hint   string
+	}{
+		{"//people/*[age > 40", 10, "unclosed ["},
+		{"//people/*[count(age > 40]", 25, "unexpected ]"},
+		{"//people/*[frob(age)]", 11, "unknown function frob"},
+		{"//people/*[name = 'joe]", 18, "unterminated string literal"},
+		{`//people/*[name = "joe]`, 18, "unterminated string literal"},
+		{"//people/*[max(age", 14, "unclosed ("},
+		{"///", -1, "expression must evaluate to a node-set"},
+	}
+	for _, test := range tests {
+		_, err := QueryAll(doc, test.expr)
+		var qe *QueryError
+		if !errors.As(err, &qe) {
+			t.Fatalf("%s: expected *QueryError but %v", test.expr, err)
+		}
+		if qe.Expr != test.expr || qe.Offset != test.offset || qe.Hint != test.hint || qe.Err == nil {
+			t.Fatalf("%s: expected offset %d and hint %q but %d and %q", test.expr, test.offset, test.hint, qe.Offset, qe.Hint)
+		}
+		if !errors.Is(err, qe.Err) {
+			t.Fatalf("%s: expected error to wrap %v", test.expr, qe.Err)
+		}
+	}
+	_, err := Compile("//a[b")
+	if e, g := `jsonquery: invalid expression "//a[b": unclosed [ at offset 3`, err.Error(); e != g {
+		t.Fatalf("expected %v but %v", e, g)
+	}
+}
+
+func TestQueryDistinct(t *testing.T) {
+	doc := MustParse(`{"routes":[{"id":"a","metric":10},{"id":"b","metric":20},{"id":"c","metric":10},{"id":"d","metric":"20"},{"id":"e","metric":5}]}`)
+	nodes, err := QueryDistinct(doc, "//metric")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var a []string
+	for _, n := range nodes {
+		a = append(a, n.Parent.SelectElement("id").InnerText()+"="+n.InnerText())
+	}
+	if e, g := "a=10,b=20,e=5", strings.Join(a, ","); e != g {
+		t.Fatalf("expected %v but %v", e, g)
+	}
+	if nodes, err := QueryDistinct(doc, "//missing"); err != nil || len(nodes) != 0 {
+		t.Fatalf("expected no nodes but %v, %v", nodes, err)
+	}
+}
+
+func TestQueryKeys(t *testing.T) {
+	doc, _ := parseString(testConfig)
+	for _, expr := range []string{
+		"//route-instance/*[starts-with(name(), 'ri')]",
+		"//route-instance/*[starts-with(local-name(), 'ri')]",
+		"//route-instance/*[starts-with(key(), 'ri')]",
+	} {
+		nodes, err := QueryAll(doc, expr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(nodes) != 2 || nodes[0].Data != "ri1" || nodes[1].Data != "ri2" {
+			t.Fatalf("%s: expected ri1 and ri2 but %v", expr, nodes)
+		}
+	}
+	if v, err := Evaluate(doc, "string(key(//people))"); err != nil || v != "people" {
+		t.Fatalf("expected people but %v, %v", v, err)
+	}
+
+	matches, err := QueryAllWithPaths(doc, "//route-instance/*[metric]")
+	if err != nil {
+		t.Fatal(err)
+	}
+	metrics := make(map[string]string)
+	for _, m := range matches {
+		metrics[m.Key] = m.Node.SelectElement("metric").InnerText()
+	}
+	if e, g := "map[ri1:24 ri2:89]", fmt.Sprint(metrics); e != g {
+		t.Fatalf("expected %v but %v", e, g)
+	}
+
+	matches, err = QueryAllWithPaths(doc, "//route-instance/*[key() = 'ri2'] | //people/*[2]/name/text() | //people/*[2]")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, m := range matches {
+		got = append(got, m.Key+" "+m.Pointer)
+	}
+	if e, g := "[1 /top/people/1 name /top/people/1/name ri2 /top/route-instance/ri2]", fmt.Sprint(got); e != g {
+		t.Fatalf("expected %v but %v", e, g)
+	}
+}
+
+func TestQueryAllWithPaths(t *testing.T) {
+	doc, _ := parseString(testConfig)
+	for _, test := range []struct {
+		expr  string
+		paths []string
+	}{
+		{"//name", []string{
+			"/top/people/*[1]/name /top/people/0/name",
+			"/top/people/*[2]/name /top/people/1/name",
+		}},
+		{`//sites/*//*[area_id != "0.0.0.1"]`, []string{
+			"/top/sites/*[1]/ri1/ospf/areas/*[1] /top/sites/0/ri1/ospf/areas/0",
+			"/top/sites/*[1]/ri3/ospf/areas/*[1] /top/sites/0/ri3/ospf/areas/0",
+		}},
+		{"//route-instance/*[metric > 50]/metric/text()", []string{
+			"/top/route-instance/ri2/metric /top/route-instance/ri2/metric",
+		}},
+	} {
+		matches, err := QueryAllWithPaths(doc, test.expr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, m := range matches {
+			got = append(got, m.Path+" "+m.Pointer)
+			if n := FindOne(doc, m.Path); n != m.Node && n != m.Node.Parent {
+				t.Fatalf("%s: expected %s to select the node matched", test.expr, m.Path)
+			}
+		}
+		if e, g := strings.Join(test.paths, "\n"), strings.Join(got, "\n"); e != g {
+			t.Fatalf("%s: expected\n%v\nbut\n%v", test.expr, e, g)
+		}
+	}
+
+	// The items of an array are numbered once, not once per item.
+	items := make([]string, 5000)
+	for i := range items {
+		items[i] = fmt.Sprintf(`{"id":%d}`, i)
+	}
+	big := MustParse(`{"items":[` + strings.Join(items, ",") + `]}`)
+	matches, err := QueryAllWithPaths(big, "//items/*/id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, m := range matches {
+		if e := fmt.Sprintf("/items/%d/id", i); m.Pointer != e || m.Node.InnerText() != strconv.Itoa(i) {
+			t.Fatalf("expected %s but %s", e, m.Pointer)
+		}
+	}
+	matches, err = QueryAllWithPaths(big, "//items/*[id > 4997]")
+	if err != nil || len(matches) != 2 || matches[0].Key != "4998" || matches[1].Key != "4999" {
+		t.Fatalf("expected the keys 4998 and 4999 but %v, %v", matches, err)
+	}
+}
+
+func TestQueryFieldComparison(t *testing.T) {
+	doc, _ := parseString(`{"links":[
+		{"name":"a","actual_speed":9,"configured_speed":10},
+		{"name":"b","actual_speed":100,"configured_speed":20},
+		{"name":"c","configured_speed":5},
+		{"name":"d","actual_speed":1e2,"configured_speed":100.0}
+	]}`)
+	for _, test := range []struct {
+		expr string
+		want string
+	}{
+		// Compared as numbers, not strings, where "100" < "20".
+		{"//links/*[actual_speed < configured_speed]/name", "a"},
+		{"//links/*[actual_speed > configured_speed]/name", "b"},
+		{"//links/*[configured_speed > actual_speed]/name", "a"},
+		{"//links/*[actual_speed >= configured_speed]/name", "b,d"},
+		{"//links/*[actual_speed = configured_speed]/name", "d"},
+		{"//links/*[actual_speed != configured_speed]/name", "a,b"},
+		// A missing field matches no comparison.
+		{"//links/*[not(actual_speed <= configured_speed)]/name", "b,c"},
+	} {
+		assertQuery(t, doc, test.expr, test.want)
+	}
+}
+
+func TestQueryArithmetic(t *testing.T) {
+	doc, _ := parseString(testConfig)
+	for _, test := range []struct {
+		expr string
+		want string
+	}{
+		{"//areas/*[metric * 10 >= 20]/area_id", "0.0.0.2"},
+		{"//areas/*[metric * 10 = 20]/area_id", "0.0.0.2"},
+		{"//areas/*[metric - 0.5 > 0]/area_id", "0.0.0.1,0.0.0.2"},
+		{"//areas/*[-metric < -1]/area_id", "0.0.0.2"},
+		{"//people/*[age + 1 < 45]/name", "mark"},
+		{"//people/*[age div 2 > 20]/name", "joe"},
+		{"//people/*[age mod 2 = 1]/name", "joe"},
+		{"//people/*[age * 100000000000 > 4000000000000]/name", "joe"},
+		{"//inner/*[. * 1.5 > 3]", "3"},
+	} {
+		assertQuery(t, doc, test.expr, test.want)
+	}
+	for expr, want := range map[string]float64{
+		"//people/*[1]/age * 2":      90,
+		"//ri2/metric div 2":         44.5,
+		"//ri2/metric mod 10":        9,
+		"max(//metric) + 1":          90,
+		"sum(//areas/*/metric) * 10": 30,
+	} {
+		if v, err := QueryAggregate(doc, expr); err != nil || v != want {
+			t.Fatalf("%s: expected %v but %v, %v", expr, want, v, err)
+		}
+	}
+}
+
+func TestQueryTranslate(t *testing.T) {
+	doc, _ := parseString(testConfig)
+	for _, test := range []struct {
+		expr string
+		want string
+	}{
+		{`//areas/*[translate(area_id, ".", "") = "0001"]/area_id`, "0.0.0.1"},
+		{`//areas/*[translate(area_id, ".", "") > 0]/area_id`, "0.0.0.1,0.0.0.2"},
+		{`//areas/*[translate(area_id, ".0", ",") = ",,,2"]/area_id`, "0.0.0.2"},
+		{`//people/*[translate(name, "JOE", "joe") = translate("JOE", "JOE", "joe")]/name`, "joe"},
+	} {
+		assertQuery(t, doc, test.expr, test.want)
+	}
+	if v, err := Evaluate(doc, `translate(//ri1/ospf/areas/*[1]/area_id, ".", "-")`); err != nil || v != "0-0-0-0" {
+		t.Fatalf("expected 0-0-0-0 but %v, %v", v, err)
+	}
+}
+
+func TestQueryFor(t *testing.T) {
+	doc, _ := parseString(testConfig)
+	for _, test := range []struct {
+		expr string
+		want string
+	}{
+		{`for $p in //people/* return $p/name`, "joe,mark"},
+		// Relative paths are evaluated from the context of the for
+		// expression, not from $p.
+		{`for $p in //people/* return top/inner/*[1]`, "0"},
+		{`for $p in //people/*[age > 40] return $p/name`, "joe"},
+		{`for $s in //sites/* return $s/*/ospf/areas/*[metric > 0]/area_id`, "0.0.0.1,0.0.0.2"},
+		{`for $a in //areas/* return for $m in $a/metric return $m/../area_id`, "0.0.0.0,0.0.0.1,0.0.0.2"},
+		{`for $p in //people/* return //people/*[1]/name`, "joe"},
+		{`for $p in //nothing return $p/name`, ""},
+	} {
+		assertQuery(t, doc, test.expr, test.want)
+	}
+
+	if n, err := Query(doc, `for $p in //people/* return $p/age`); err != nil || n.InnerText() != "45" {
+		t.Fatalf("expected 45 but %v, %v", n, err)
+	}
+	nodes, err := QueryAllVars(doc, `for $p in //people/*[age < $max] return $p/name`, map[string]interface{}{"max": 44})
+	if err != nil || len(nodes) != 1 || nodes[0].InnerText() != "mark" {
+		t.Fatalf("expected mark but %v, %v", nodes, err)
+	}
+
+	v, err := Evaluate(doc, `for $p in //people/* return $p/age * 2`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g := fmt.Sprint(v); g != "[90 4]" {
+		t.Fatalf("expected [90 4] but %v", g)
+	}
+	v, err = Evaluate(doc, `for $p in //people/* return ($p/name | //inner/*[1])`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nodes, ok := v.([]*Node); !ok || fmt.Sprint(nodes) != `["joe" 0 "mark" 0]` {
+		t.Fatalf("expected the nodes of each result but %v", v)
+	}
+
+	for _, expr := range []string{
+		`for $p in $p/people return $p/name`,
+		`for $p in //people/* return $p/name[`,
+	} {
+		if _, err := QueryAll(doc, expr); err == nil {
+			t.Fatalf("%s: expected error", expr)
+		}
+	}
+}
+
+func TestQueryForJoin(t *testing.T) {
+	doc := MustParse(`{
+		"items": [
+			{"id": 1, "ref": "p2"},
+			{"id": 2, "ref": "p1"},
+			{"id": 3, "ref": "p3"}
+		],
+		"prices": [
+			{"id": "p1", "item": 2, "p": 10},
+			{"id": "p2", "item": 1, "p": 20},
+			{"id": "p3", "item": 7, "p": 30}
+		]
+	}`)
+	for _, test := range []struct {
+		expr string
+		vars map[string]interface{}
+		want string
+	}{
+		// $x keeps its node in the predicates of the return clause.
+		{`for $x in //items/* return //prices/*[id = $x/ref]/p`, nil, "10,20,30"},
+		{`for $x in //items/* return //prices/*[item = $x/id]/p`, nil, "10,20"},
+		{`for $x in //items/* return //prices/*[id = $x/ref][item = $x/id]/p`, nil, "10,20"},
+		{`for $x in //items/*[id > 1] return $x/../*[1]/ref`, nil, "p2"},
+		// The return clause of a nested for expression sees both
+		// variables.
+		{`for $a in //items/* return for $p in //prices/*[id = $a/ref] return $a/id[$p/item = .]`, nil, "1,2"},
+		// The in clause sees the variables of QueryAllVars, and the
+		// return clause the variable of the for expression.
+		{`for $x in //items/*[id > $x] return $x/ref`, map[string]interface{}{"x": 1}, "p1,p3"},
+	} {
+		assertQueryVars(t, doc, test.expr, test.vars, test.want)
+	}
+
+	items := Find(doc, "//items/*")
+	nodes, err := QueryAll(doc, `for $x in //items/* return $x`)
+	if err != nil || !reflect.DeepEqual(nodes, items) {
+		t.Fatalf("expected the items but %v, %v", nodes, err)
+	}
+	v, err := Evaluate(doc, `for $x in //items/* return sum(//prices/*[id = $x/ref]/p) * 2`)
+	if err != nil || fmt.Sprint(v) != "[40 20 60]" {
+		t.Fatalf("expected [40 20 60] but %v, %v", v, err)
+	}
+	v, err = Evaluate(doc, `for $x in //items/* return name($x/..)`)
+	if err != nil || fmt.Sprint(v) != "[items items items]" {
+		t.Fatalf("expected the name of the array but %v, %v", v, err)
+	}
+}
+
+func TestExprWithLimit(t *testing.T) {
+	items := make([]string, 10000)
+	for i := range items {
+		items[i] = fmt.Sprintf(`{"id":%d}`, i)
+	}
+	doc := MustParse(`{"items":[` + strings.Join(items, ",") + `]}`)
+	visits := 0
+	exp, err := CompileFuncs("//items/*[visit()]", map[string]Func{
+		"visit": func(args ...interface{}) (interface{}, error) {
+			visits++
+			return true, nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := func(nodes []*Node) string {
+		var a []string
+		for _, n := range nodes {
+			a = append(a, n.SelectElement("id").InnerText())
+		}
+		return strings.Join(a, ",")
+	}
+
+	nodes, err := exp.WithLimit(3).QueryAll(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e, g := "0,1,2", ids(nodes); e != g {
+		t.Fatalf("expected %v but %v", e, g)
+	}
+	if visits != 3 {
+		t.Fatalf("expected 3 visits but %d", visits)
+	}
+
+	visits = 0
+	nodes, err = exp.WithOffset(20).WithLimit(5).QueryAll(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e, g := "20,21,22,23,24", ids(nodes); e != g {
+		t.Fatalf("expected %v but %v", e, g)
+	}
+	if visits != 25 {
+		t.Fatalf("expected 25 visits but %d", visits)
+	}
+
+	nodes, err = exp.WithOffset(9998).QueryAll(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e, g := "9998,9999", ids(nodes); e != g {
+		t.Fatalf("expected %v but %v", e, g)
+	}
+	nodes, err = exp.WithOffset(10000).WithLimit(10).QueryAll(doc)
+	if err != nil || len(nodes) != 0 {
+		t.Fatalf("expected no nodes but %d, %v", len(nodes), err)
+	}
+	if nodes, _ := exp.QueryAll(doc); len(nodes) != 10000 {
+		t.Fatalf("expected the original expression to have no limit but %d nodes", len(nodes))
+	}
+
+	// The operands of a union are searched one after the other.
+	union, err := Compile("//items/*[id > 9997] | //items/*[id < 2]")
+	if err != nil {
+		t.Fatal(err)
+	}
+	nodes, err = union.WithLimit(2).QueryAll(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e, g := "9998,9999", ids(nodes); e != g {
+		t.Fatalf("expected %v but %v", e, g)
+	}
+}
+
+func TestQueryAllWithOptions(t *testing.T) {
+	doc := MustParse(`{"Users":[
+		{"Name":"Joe","AGE":45,"Info":{"city":"Oslo"}},
+		{"name":"mark","age":2,"INFO":{"City":"Paris"}}
+	]}`)
+	values := func(nodes []*Node) string {
+		var a []string
+		for _, n := range nodes {
+			a = append(a, n.InnerText())
+		}
+		return strings.Join(a, ",")
+	}
+	insensitive := QueryOptions{CaseInsensitive: true}
+	for _, test := range []struct {
+		expr string
+		opts QueryOptions
+		want string
+	}{
+		{"//users/*/name", insensitive, "Joe,mark"},
+		{"//USERS/*/NAME", insensitive, "Joe,mark"},
+		{"//users/*/name", QueryOptions{}, ""},
+		{"//Users/*/Name", QueryOptions{}, "Joe"},
+		{"//users/*[Age > 10]/info/CITY", insensitive, "Oslo"},
+		{"//users/*[count(child::info) = 1]/age", insensitive, "45,2"},
+		// Values are still compared with case.
+		{"//users/*[name = 'joe']/age", insensitive, ""},
+		{"//users/*[name = 'Joe']/age", insensitive, "45"},
+		{"//users/*[name() = 'NAME' or contains(name, 'J')]/age", insensitive, "45"},
+		{"//*[local-name() = 'city']", insensitive, "Oslo,Paris"},
+		{"//users/*[max(AGE) > 10]/Name", insensitive, "Joe"},
+	} {
+		nodes, err := QueryAllWithOptions(doc, test.expr, test.opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if g := values(nodes); g != test.want {
+			t.Fatalf("%s: expected %q but %q", test.expr, test.want, g)
+		}
+	}
+	if _, err := QueryAllWithOptions(doc, "//users[", insensitive); err == nil {
+		t.Fatal("expected error for an invalid expression")
+	}
+}
+
+func TestQueryByName(t *testing.T) {
+	doc, _ := parseString(testConfig)
+	for _, test := range []struct {
+		expr string
+		want string
+	}{
+		{`//*[name() = "ri1"]`, "/top/route-instance/ri1 /top/sites/0/ri1"},
+		{`//route-instance/*[name() = "ri1"]`, "/top/route-instance/ri1"},
+		{`//route-instance/*[name() != "ri2"]`, "/top/route-instance/ri1"},
+		{`//route-instance/*[local-name() != "ri1"]`, "/top/route-instance/ri2"},
+		{`//route-instance/*[name() = "ri1" or name() = "ri2"]/metric`, "/top/route-instance/ri1/metric /top/route-instance/ri2/metric"},
+		// Array items have no name.
+		{`//people/*[name() = ""][1]`, "/top/people/0"},
+		{`//*[name() = "missing"]`, ""},
+	} {
+		matches, err := QueryAllWithPaths(doc, test.expr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var pointers []string
+		for _, m := range matches {
+			pointers = append(pointers, m.Pointer)
+		}
+		if g := strings.Join(pointers, " "); g != test.want {
+			t.Fatalf("%s: expected %q but %q", test.expr, test.want, g)
+		}
+	}
+}
+
+func TestQueryWildcardSteps(t *testing.T) {
+	doc, _ := parseString(testConfig)
+	for _, test := range []struct {
+		expr string
+		want string
+	}{
+		{"//route-instance/*/metric", "/top/route-instance/ri1/metric /top/route-instance/ri2/metric"},
+		{"/top/*/ri2/metric", "/top/route-instance/ri2/metric"},
+		// The items of an array are a level of their own.
+		{"//top/*/name", ""},
+		{"//top/*/*/name", "/top/people/0/name /top/people/1/name"},
+		{"//*/*/name", "/top/people/0/name /top/people/1/name"},
+		{"*/*/*/name", "/top/people/0/name /top/people/1/name"},
+		{"//sites/*/*/ospf/areas/*/area_id", "/top/sites/0/ri1/ospf/areas/0/area_id /top/sites/0/ri2/ospf/areas/0/area_id /top/sites/0/ri3/ospf/areas/0/area_id"},
+		{"/*", "/top"},
+		{"/top/*", "/top/inner /top/people /top/route-instance /top/sites"},
+	} {
+		matches, err := QueryAllWithPaths(doc, test.expr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var pointers []string
+		for _, m := range matches {
+			pointers = append(pointers, m.Pointer)
+		}
+		if g := strings.Join(pointers, " "); g != test.want {
+			t.Fatalf("%s: expected %q but %q", test.expr, test.want, g)
+		}
+	}
+}
+
+func TestBuildQuery(t *testing.T) {
+	doc := MustParse(`{"people":[
+		{"name":"O'Brien","age":45,"admin":true},
+		{"name":"say \"hi\"","age":2.5,"admin":false},
+		{"name":"it's \"both\"","age":-1,"admin":false},
+		{"name":"''","age":0,"admin":true}
+	]}`)
+	for _, test := range []struct {
+		template string
+		args     []interface{}
+		want     string
+		match    string
+	}{
+		{"//people/*[name = {}]/age", []interface{}{"O'Brien"}, `//people/*[name = "O'Brien"]/age`, "45"},
+		{"//people/*[name = {}]/age", []interface{}{`say "hi"`}, `//people/*[name = 'say "hi"']/age`, "2.5"},
+		{"//people/*[name = {}]/age", []interface{}{`it's "both"`}, `//people/*[name = concat('it', "'", 's "both"')]/age`, "-1"},
+		{"//people/*[name = {}]/age", []interface{}{`''`}, `//people/*[name = "''"]/age`, "0"},
+		{"//people/*[age = {} or age = {}]/name", []interface{}{2.5, int64(-1)}, "//people/*[age = 2.5 or age = -1]/name", `say "hi",it's "both"`},
+		{"//people/*[admin = {} and age > {}]/name", []interface{}{true, uint8(10)}, "//people/*[admin = 'true' and age > 10]/name", "O'Brien"},
+		{"//people/*[admin = {}]/age", []interface{}{false}, "//people/*[admin = 'false']/age", "2.5,-1"},
+		{"//people/*[name = {}]", []interface{}{"x] | //*[1"}, "//people/*[name = 'x] | //*[1']", ""},
+	} {
+		expr, err := BuildQuery(test.template, test.args...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expr != test.want {
+			t.Fatalf("expected %s but %s", test.want, expr)
+		}
+		nodes, err := QueryAll(doc, expr)
+		if err != nil {
+			t.Fatalf("%s: %v", expr, err)
+		}
+		var values []string
+		for _, n := range nodes {
+			values = append(values, n.InnerText())
+		}
+		if g := strings.Join(values, ","); g != test.match {
+			t.Fatalf("%s: expected %q but %q", expr, test.match, g)
+		}
+	}
+	for _, args := range [][]interface{}{
+		{},
+		{"a", "b"},
+		{[]string{"a"}},
+		{math.NaN()},
+	} {
+		if _, err := BuildQuery("//*[. = {}]", args...); err == nil {
+			t.Fatalf("expected error for %v", args)
+		}
+	}
+}
+
+func TestCreateXPathNavigator(t *testing.T) {
+	doc, _ := parseString(testConfig)
+
+	expr := xpath.MustCompile("//people/*[age < 44]/name")
+	iter := expr.Select(CreateXPathNavigator(doc))
+	var names []string
+	for iter.MoveNext() {
+		nav := iter.Current().(*NodeNavigator)
+		if nav.NodeType() != xpath.ElementNode || nav.LocalName() != "name" {
+			t.Fatalf("expected a name element but %v %s", nav.NodeType(), nav.LocalName())
+		}
+		names = append(names, nav.Value())
+	}
+	if e, g := "[mark]", fmt.Sprint(names); e != g {
+		t.Fatalf("expected %v but %v", e, g)
+	}
+
+	for _, test := range []struct {
+		expr string
+		want interface{}
+	}{
+		{"sum(//inner/*)", float64(6)},
+		{"count(//people/*)", float64(2)},
+		{"string(//people/*[1])", "45joe"},
+		{"string(/)", ""},
+		{"name(//people/*[1])", ""},
+		{"count(//people/*[1]/@*)", float64(0)},
+		{"//ri2/metric > 50", true},
+	} {
+		if g := xpath.MustCompile(test.expr).Evaluate(CreateXPathNavigator(doc)); g != test.want {
+			t.Fatalf("%s: expected %v but %v", test.expr, test.want, g)
+		}
+	}
+
+	// The items of an array are unnamed siblings.
+	nav := CreateXPathNavigator(doc.SelectElement("top").SelectElement("inner"))
+	if nav.NodeType() != xpath.ElementNode || nav.LocalName() != "inner" {
+		t.Fatalf("expected the inner element but %s", nav.LocalName())
+	}
+	if !nav.MoveToChild() || nav.LocalName() != "" || nav.Value() != "0" {
+		t.Fatalf("expected the first item but %q %q", nav.LocalName(), nav.Value())
+	}
+	var items []string
+	for ok := true; ok; ok = nav.MoveToNext() {
+		items = append(items, nav.Value())
+	}
+	if e, g := "[0 1 2 3]", fmt.Sprint(items); e != g {
+		t.Fatalf("expected %v but %v", e, g)
+	}
+	if !nav.MoveToPrevious() || nav.Value() != "2" {
+		t.Fatalf("expected the third item but %q", nav.Value())
+	}
+	if !nav.MoveToFirst() || nav.Value() != "0" {
+		t.Fatalf("expected the first item but %q", nav.Value())
+	}
+	if !nav.MoveToChild() || nav.NodeType() != xpath.TextNode || nav.Value() != "0" {
+		t.Fatalf("expected the text of the first item but %v", nav.NodeType())
+	}
+	if nav.MoveToChild() || nav.MoveToNext() || nav.MoveToNextAttribute() {
+		t.Fatal("expected a text node without children, siblings or attributes")
+	}
+	if !nav.MoveToParent() || !nav.MoveToParent() || nav.LocalName() != "inner" {
+		t.Fatalf("expected the inner element but %q", nav.LocalName())
+	}
+	if !nav.MoveToParent() || nav.LocalName() != "top" {
+		t.Fatalf("expected to move above the root of the navigator but %q", nav.LocalName())
+	}
+	nav.MoveToRoot()
+	if nav.Current() != doc.SelectElement("top").SelectElement("inner") {
+		t.Fatalf("expected the root of the navigator but %q", nav.LocalName())
+	}
+
+	other := CreateXPathNavigator(doc)
+	if nav.MoveTo(other) {
+		t.Fatal("expected no move to a navigator with another root")
+	}
+	copied := nav.Copy().(*NodeNavigator)
+	copied.MoveToChild()
+	if !nav.MoveTo(copied) || nav.Value() != "0" {
+		t.Fatalf("expected to move to the first item but %q", nav.Value())
+	}
+}
@@ -0,0 +1,59 @@
+package jsonquery
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+// TestConcurrentQueries runs queries on a shared document from many
+// goroutines; run it with -race.
+func TestConcurrentQueries(t *testing.T) {
+	doc, _ := parseString(testConfig)
+	type check struct {
+		run  func() (interface{}, error)
+		want interface{}
+	}
+	checks := []check{
+		{func() (interface{}, error) { n, err := QueryAll(doc, "//people/*[age > 10]/name"); return len(n), err }, 1},
+		{func() (interface{}, error) { n, err := QueryAll(doc, "//metric | //ri1"); return len(n), err }, 7},
+		{func() (interface{}, error) { return QueryAggregate(doc, "sum(//metric)") }, 116.0},
+		{func() (interface{}, error) { return QueryAggregate(doc, "count(//metric)") }, 5.0},
+		{func() (interface{}, error) { return Evaluate(doc, "string(//people/*[1]/name)") }, "joe"},
+		{func() (interface{}, error) { return ValueOf(doc, "//route-instance/ri2/metric") }, "89"},
+		{func() (interface{}, error) {
+			n, err := QueryAllVars(doc, "//areas/*[metric >= $min]", map[string]interface{}{"min": 1})
+			return len(n), err
+		}, 2},
+		{func() (interface{}, error) {
+			v, err := Evaluate(doc, "//areas/*[metric > 0]/area_id")
+			return len(v.([]*Node)), err
+		}, 2},
+		{func() (interface{}, error) {
+			v, err := Evaluate(doc, "//metric[. > 1] | //name")
+			return len(v.([]*Node)), err
+		}, 5},
+		{func() (interface{}, error) { return doc.SelectElement("top").SelectElement("inner").InnerText(), nil }, "0123"},
+		{func() (interface{}, error) { return FindOne(doc, "//ri3").String(), nil }, `{"ospf":{"areas":[{"area_id":"0.0.0.2","metric":2}]}}`},
+	}
+	var wg sync.WaitGroup
+	for g := 0; g < 32; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				c := checks[(g+i)%len(checks)]
+				v, err := c.run()
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if fmt.Sprint(v) != fmt.Sprint(c.want) {
+					t.Errorf("expected %v but %v", c.want, v)
+					return
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,37 @@
+package jsonquery
+
+// Reduce calls fn for every string, number, boolean and null node of the
+// subtree of n, including n itself, in depth-first pre-order, passing the
+// value returned by the previous call as acc, initial for the first one.
+// It returns the value of the last call, or initial if there is none.
+// Objects and arrays are only traversed.
+func (n *Node) Reduce(fn func(acc interface{}, n *Node) interface{}, initial interface{}) interface{} {
+	acc := initial
+	eachLeaf(n, func(leaf *Node) {
+		acc = fn(acc, leaf)
+	})
+	return acc
+}
+
+// ReduceTyped is like Node.Reduce but with an accumulator of type T.
+func ReduceTyped[T any](n *Node, fn func(acc T, n *Node) T, initial T) T {
+	acc := initial
+	eachLeaf(n, func(leaf *Node) {
+		acc = fn(acc, leaf)
+	})
+	return acc
+}
+
+// eachLeaf calls fn for every scalar element node of the subtree of n in
+// depth-first pre-order.
+func eachLeaf(n *Node, fn func(*Node)) {
+	if n.Type == ElementNode && n.ElType != MapNode && n.ElType != ArrayNode {
+		fn(n)
+		return
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type != TextNode {
+			eachLeaf(c, fn)
+		}
+	}
+}
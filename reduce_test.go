@@ -0,0 +1,56 @@
+package jsonquery
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestReduce(t *testing.T) {
+	doc, _ := parseString(testConfig)
+	sum := doc.Reduce(func(acc interface{}, n *Node) interface{} {
+		if n.ElType != NumberNode {
+			return acc
+		}
+		f, _ := nodeNumber(n)
+		return acc.(float64) + f
+	}, 0.0)
+	if sum != 169.0 {
+		t.Fatalf("expected 169 but %v", sum)
+	}
+
+	doc, _ = parseString(`{"b":[1,{"c":true},[]],"a":"x","d":null,"e":{}}`)
+	leaves := doc.Reduce(func(acc interface{}, n *Node) interface{} {
+		return append(acc.([]string), n.Data+"="+n.InnerText())
+	}, []string(nil))
+	if e, g := "a=x =1 c=true d=", strings.Join(leaves.([]string), " "); e != g {
+		t.Fatalf("expected %q but %q", e, g)
+	}
+
+	leaf := FindOne(doc, "a")
+	if g := leaf.Reduce(func(acc interface{}, n *Node) interface{} { return acc.(int) + 1 }, 0); g != 1 {
+		t.Fatalf("expected 1 call for a scalar node but %v", g)
+	}
+	if g := FindOne(doc, "e").Reduce(func(acc interface{}, n *Node) interface{} { return acc.(int) + 1 }, 0); g != 0 {
+		t.Fatalf("expected no call for an empty object but %v", g)
+	}
+}
+
+func TestReduceTyped(t *testing.T) {
+	doc, _ := parseString(testConfig)
+	sum := ReduceTyped(doc, func(acc float64, n *Node) float64 {
+		if n.ElType != NumberNode {
+			return acc
+		}
+		f, _ := nodeNumber(n)
+		return acc + f
+	}, 0)
+	if sum != 169 {
+		t.Fatalf("expected 169 but %v", sum)
+	}
+	count := ReduceTyped(FindOne(doc, "//people"), func(acc int, n *Node) int {
+		return acc + 1
+	}, 0)
+	if count != 4 {
+		t.Fatalf("expected 4 leaves but %v", count)
+	}
+}
@@ -0,0 +1,346 @@
+package jsonquery
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// A ValidationError is a constraint of a JSON Schema violated by a node.
+type ValidationError struct {
+	// Path is the JSON Pointer of the failing node from the validated
+	// node.
+	Path string
+	// Keyword is the schema keyword violated, such as "type" or
+	// "required".
+	Keyword string
+	Message string
+}
+
+func (e ValidationError) Error() string {
+	path := e.Path
+	if path == "" {
+		path = "/"
+	}
+	return fmt.Sprintf("%s: %s: %s", path, e.Keyword, e.Message)
+}
+
+// ValidateSchema validates node against the JSON Schema (draft-07)
+// schema and returns all the constraints violated, in document order.
+// The keywords supported are type, enum, const, minimum, maximum,
+// exclusiveMinimum, exclusiveMaximum, multipleOf, minLength, maxLength,
+// pattern, required, properties, additionalProperties, items, minItems
+// and maxItems; other keywords, including $ref, are ignored.
+// Return an error if schema is not a valid JSON Schema.
+func ValidateSchema(node *Node, schema []byte) ([]ValidationError, error) {
+	var s interface{}
+	if err := json.Unmarshal(schema, &s); err != nil {
+		return nil, err
+	}
+	v := &validator{patterns: make(map[string]*regexp.Regexp)}
+	if err := v.validate(node, s, ""); err != nil {
+		return nil, err
+	}
+	return v.errs, nil
+}
+
+type validator struct {
+	errs     []ValidationError
+	patterns map[string]*regexp.Regexp
+}
+
+func (v *validator) fail(path, keyword, format string, args ...interface{}) {
+	v.errs = append(v.errs, ValidationError{Path: path, Keyword: keyword, Message: fmt.Sprintf(format, args...)})
+}
+
+func (v *validator) validate(n *Node, schema interface{}, path string) error {
+	var s map[string]interface{}
+	switch schema := schema.(type) {
+	case bool:
+		if !schema {
+			v.fail(path, "false", "no value is allowed")
+		}
+		return nil
+	case map[string]interface{}:
+		s = schema
+	default:
+		return fmt.Errorf("schema at %s must be an object or a boolean", path)
+	}
+
+	typ := schemaType(n)
+	if t, ok := s["type"]; ok {
+		var types []string
+		switch t := t.(type) {
+		case string:
+			types = []string{t}
+		case []interface{}:
+			for _, tt := range t {
+				ts, ok := tt.(string)
+				if !ok {
+					return fmt.Errorf("schema at %s: type must be a string or an array of strings", path)
+				}
+				types = append(types, ts)
+			}
+		default:
+			return fmt.Errorf("schema at %s: type must be a string or an array of strings", path)
+		}
+		if !matchesType(n, typ, types) {
+			v.fail(path, "type", "expected %s but got %s", strings.Join(types, " or "), typ)
+			// The other keywords would only report the same mismatch.
+			return nil
+		}
+	}
+
+	enum, hasEnum := s["enum"]
+	c, hasConst := s["const"]
+	if hasEnum || hasConst {
+		value, err := decodeValue(n)
+		if err != nil {
+			return err
+		}
+		if hasEnum {
+			values, ok := enum.([]interface{})
+			if !ok {
+				return fmt.Errorf("schema at %s: enum must be an array", path)
+			}
+			found := false
+			for _, e := range values {
+				if reflect.DeepEqual(e, value) {
+					found = true
+					break
+				}
+			}
+			if !found {
+				v.fail(path, "enum", "%s is not one of the allowed values", n)
+			}
+		}
+		if hasConst && !reflect.DeepEqual(c, value) {
+			v.fail(path, "const", "%s is not the allowed value", n)
+		}
+	}
+
+	switch typ {
+	case "number", "integer":
+		return v.validateNumber(n, s, path)
+	case "string":
+		return v.validateString(n, s, path)
+	case "array":
+		return v.validateArray(n, s, path)
+	case "object":
+		return v.validateObject(n, s, path)
+	}
+	return nil
+}
+
+func (v *validator) validateNumber(n *Node, s map[string]interface{}, path string) error {
+	f, err := strconv.ParseFloat(n.InnerText(), 64)
+	if err != nil {
+		return nil
+	}
+	if limit, ok, err := schemaNumber(s, "minimum", path); err != nil {
+		return err
+	} else if ok && f < limit {
+		v.fail(path, "minimum", "%v is less than %v", f, limit)
+	}
+	if limit, ok, err := schemaNumber(s, "maximum", path); err != nil {
+		return err
+	} else if ok && f > limit {
+		v.fail(path, "maximum", "%v is greater than %v", f, limit)
+	}
+	if limit, ok, err := schemaNumber(s, "exclusiveMinimum", path); err != nil {
+		return err
+	} else if ok && f <= limit {
+		v.fail(path, "exclusiveMinimum", "%v is not greater than %v", f, limit)
+	}
+	if limit, ok, err := schemaNumber(s, "exclusiveMaximum", path); err != nil {
+		return err
+	} else if ok && f >= limit {
+		v.fail(path, "exclusiveMaximum", "%v is not less than %v", f, limit)
+	}
+	if m, ok, err := schemaNumber(s, "multipleOf", path); err != nil {
+		return err
+	} else if ok && m > 0 {
+		if q := f / m; q != math.Trunc(q) {
+			v.fail(path, "multipleOf", "%v is not a multiple of %v", f, m)
+		}
+	}
+	return nil
+}
+
+func (v *validator) validateString(n *Node, s map[string]interface{}, path string) error {
+	str := n.InnerText()
+	length := float64(utf8.RuneCountInString(str))
+	if limit, ok, err := schemaNumber(s, "minLength", path); err != nil {
+		return err
+	} else if ok && length < limit {
+		v.fail(path, "minLength", "length %v is less than %v", length, limit)
+	}
+	if limit, ok, err := schemaNumber(s, "maxLength", path); err != nil {
+		return err
+	} else if ok && length > limit {
+		v.fail(path, "maxLength", "length %v is greater than %v", length, limit)
+	}
+	if p, ok := s["pattern"]; ok {
+		ps, ok := p.(string)
+		if !ok {
+			return fmt.Errorf("schema at %s: pattern must be a string", path)
+		}
+		re, ok := v.patterns[ps]
+		if !ok {
+			var err error
+			if re, err = regexp.Compile(ps); err != nil {
+				return fmt.Errorf("schema at %s: %v", path, err)
+			}
+			v.patterns[ps] = re
+		}
+		if !re.MatchString(str) {
+			v.fail(path, "pattern", "%q does not match %q", str, ps)
+		}
+	}
+	return nil
+}
+
+func (v *validator) validateArray(n *Node, s map[string]interface{}, path string) error {
+	items := n.ChildNodes()
+	count := float64(len(items))
+	if limit, ok, err := schemaNumber(s, "minItems", path); err != nil {
+		return err
+	} else if ok && count < limit {
+		v.fail(path, "minItems", "%v items are fewer than %v", count, limit)
+	}
+	if limit, ok, err := schemaNumber(s, "maxItems", path); err != nil {
+		return err
+	} else if ok && count > limit {
+		v.fail(path, "maxItems", "%v items are more than %v", count, limit)
+	}
+	switch schema := s["items"].(type) {
+	case nil:
+	case []interface{}:
+		for i, item := range items {
+			if i >= len(schema) {
+				break
+			}
+			if err := v.validate(item, schema[i], path+"/"+strconv.Itoa(i)); err != nil {
+				return err
+			}
+		}
+	default:
+		for i, item := range items {
+			if err := v.validate(item, schema, path+"/"+strconv.Itoa(i)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (v *validator) validateObject(n *Node, s map[string]interface{}, path string) error {
+	if required, ok := s["required"]; ok {
+		names, ok := required.([]interface{})
+		if !ok {
+			return fmt.Errorf("schema at %s: required must be an array", path)
+		}
+		var missing []string
+		for _, name := range names {
+			name, ok := name.(string)
+			if !ok {
+				return fmt.Errorf("schema at %s: required must be an array of strings", path)
+			}
+			if !n.HasChild(name) {
+				missing = append(missing, name)
+			}
+		}
+		if len(missing) > 0 {
+			sort.Strings(missing)
+			v.fail(path, "required", "missing %s", strings.Join(missing, ", "))
+		}
+	}
+	properties, _ := s["properties"].(map[string]interface{})
+	additional, hasAdditional := s["additionalProperties"]
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		p := path + "/" + escapePointerToken(c.Data)
+		if schema, ok := properties[c.Data]; ok {
+			if err := v.validate(c, schema, p); err != nil {
+				return err
+			}
+		} else if hasAdditional {
+			if allowed, ok := additional.(bool); ok && !allowed {
+				v.fail(p, "additionalProperties", "%s is not allowed", c.Data)
+			} else if err := v.validate(c, additional, p); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// schemaType returns the JSON Schema type of n.
+func schemaType(n *Node) string {
+	switch n.ElType {
+	case ArrayNode:
+		return "array"
+	case StringNode:
+		return "string"
+	case NumberNode:
+		return "number"
+	case BooleanNode:
+		return "boolean"
+	case NullNode:
+		return "null"
+	}
+	return "object"
+}
+
+// matchesType reports whether n, of JSON Schema type typ, is one of types.
+// An integer is a number without a fractional part.
+func matchesType(n *Node, typ string, types []string) bool {
+	for _, t := range types {
+		if t == typ {
+			return true
+		}
+		if t == "integer" && typ == "number" {
+			if f, err := strconv.ParseFloat(n.InnerText(), 64); err == nil && f == math.Trunc(f) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// schemaNumber returns the numeric value of the keyword of s, if present.
+func schemaNumber(s map[string]interface{}, keyword, path string) (float64, bool, error) {
+	v, ok := s[keyword]
+	if !ok {
+		return 0, false, nil
+	}
+	f, ok := v.(float64)
+	if !ok {
+		return 0, false, fmt.Errorf("schema at %s: %s must be a number", path, keyword)
+	}
+	return f, true, nil
+}
+
+// RequiredFields returns an error listing the keys missing from the
+// object n, such as "missing required fields: age, email", or nil if n
+// has all of them. Return an error if n is not an object.
+func (n *Node) RequiredFields(keys ...string) error {
+	if n.ElType != MapNode {
+		return fmt.Errorf("%s is not an object", schemaType(n))
+	}
+	var missing []string
+	for _, key := range keys {
+		if !n.HasChild(key) {
+			missing = append(missing, key)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("missing required fields: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
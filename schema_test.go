@@ -0,0 +1,100 @@
+package jsonquery
+
+import (
+	"testing"
+)
+
+func TestValidateSchema(t *testing.T) {
+	schema := `{
+		"type": "object",
+		"required": ["people", "top", "version"],
+		"properties": {
+			"people": {
+				"type": "array",
+				"maxItems": 3,
+				"items": {
+					"type": "object",
+					"required": ["name"],
+					"additionalProperties": false,
+					"properties": {
+						"name": {"type": "string", "minLength": 3, "maxLength": 5, "pattern": "^[a-z]+$"},
+						"age": {"type": "integer", "minimum": 0, "maximum": 120},
+						"role": {"enum": ["admin", "user", null]}
+					}
+				}
+			},
+			"a/b": {"type": ["string", "null"]}
+		}
+	}`
+	doc := MustParse(`{
+		"people": [
+			{"name": "joe", "age": 45, "role": null},
+			{"name": "Bo", "age": 121.5, "role": "root"},
+			{"age": -1, "email": "x@y"},
+			{"name": "markus", "role": "user"}
+		],
+		"top": {},
+		"a/b": 1
+	}`)
+	errs, err := ValidateSchema(doc, []byte(schema))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []ValidationError{
+		{"", "required", "missing version"},
+		{"/a~1b", "type", "expected string or null but got number"},
+		{"/people", "maxItems", "4 items are more than 3"},
+		{"/people/1/age", "type", "expected integer but got number"},
+		{"/people/1/name", "minLength", "length 2 is less than 3"},
+		{"/people/1/name", "pattern", `"Bo" does not match "^[a-z]+$"`},
+		{"/people/1/role", "enum", `"root" is not one of the allowed values`},
+		{"/people/2", "required", "missing name"},
+		{"/people/2/age", "minimum", "-1 is less than 0"},
+		{"/people/2/email", "additionalProperties", "email is not allowed"},
+		{"/people/3/name", "maxLength", "length 6 is greater than 5"},
+	}
+	if len(errs) != len(want) {
+		t.Fatalf("expected %v but %v", want, errs)
+	}
+	for i := range want {
+		if errs[i] != want[i] {
+			t.Fatalf("expected %v but %v", want[i], errs[i])
+		}
+	}
+	if g, e := errs[0].Error(), "/: required: missing version"; g != e {
+		t.Fatalf("expected %v but %v", e, g)
+	}
+
+	errs, err = ValidateSchema(FindOne(doc, "people/*[1]"), []byte(`{"properties":{"name":{"const":"joe"}}}`))
+	if err != nil || len(errs) != 0 {
+		t.Fatalf("expected no errors but %v, %v", errs, err)
+	}
+	if _, err := ValidateSchema(doc, []byte(`{"properties":{"people":{"items":{"properties":{"name":{"pattern":"("}}}}}}`)); err == nil {
+		t.Fatal("expected error for invalid pattern")
+	}
+	if _, err := ValidateSchema(doc, []byte(`{"minProperties":1,"required":"top"}`)); err == nil {
+		t.Fatal("expected error for invalid required")
+	}
+}
+
+func TestRequiredFields(t *testing.T) {
+	doc := MustParse(`{"name":"joe","age":45,"tags":[]}`)
+	tests := []struct {
+		keys []string
+		err  string
+	}{
+		{nil, ""},
+		{[]string{"name", "age"}, ""},
+		{[]string{"name", "age", "email"}, "missing required fields: email"},
+		{[]string{"phone", "name", "email"}, "missing required fields: phone, email"},
+	}
+	for _, test := range tests {
+		err := doc.RequiredFields(test.keys...)
+		if test.err == "" && err != nil || test.err != "" && (err == nil || err.Error() != test.err) {
+			t.Fatalf("RequiredFields(%v) expected %q but %v", test.keys, test.err, err)
+		}
+	}
+	if err := FindOne(doc, "tags").RequiredFields("name"); err == nil {
+		t.Fatal("expected error for an array")
+	}
+}
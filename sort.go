@@ -0,0 +1,92 @@
+package jsonquery
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// SortNodes sorts nodes stably by the value of the XPath expression byExpr
+// evaluated relative to each node, such as "age" or "name". The value of a
+// node-set is the text of its first node. Values are compared as numbers
+// if numeric is true, or as strings otherwise, in descending order if desc
+// is true. Nodes without a value, or whose value is not a number when
+// numeric is true, are ordered last.
+// Return an error if the expression `byExpr` cannot be parsed.
+func SortNodes(nodes []*Node, byExpr string, numeric bool, desc bool) error {
+	exp, err := getQuery(byExpr)
+	if err != nil {
+		return err
+	}
+	type key struct {
+		s  string
+		f  float64
+		ok bool
+	}
+	keys := make(map[*Node]key, len(nodes))
+	for _, n := range nodes {
+		v, err := exp.Evaluate(n)
+		if err != nil {
+			return err
+		}
+		var k key
+		k.s, k.ok = valueString(v)
+		if k.ok && numeric {
+			if f, isNumber := v.(float64); isNumber {
+				k.f = f
+			} else {
+				k.f, err = strconv.ParseFloat(strings.TrimSpace(k.s), 64)
+				k.ok = err == nil
+			}
+		}
+		keys[n] = k
+	}
+	sort.SliceStable(nodes, func(i, j int) bool {
+		a, b := keys[nodes[i]], keys[nodes[j]]
+		if !a.ok || !b.ok {
+			return a.ok && !b.ok
+		}
+		if desc {
+			a, b = b, a
+		}
+		if numeric {
+			return a.f < b.f
+		}
+		return a.s < b.s
+	})
+	return nil
+}
+
+// GroupNodes groups nodes by the value of the XPath expression keyExpr
+// evaluated relative to each node, such as "status" or
+// "name(ancestor::*[3])". The value of a node-set is the text of its first
+// node, or "" if it is empty. The nodes of a group are in document order.
+// Return an error if the expression `keyExpr` cannot be parsed.
+func GroupNodes(nodes []*Node, keyExpr string) (map[string][]*Node, error) {
+	exp, err := getQuery(keyExpr)
+	if err != nil {
+		return nil, err
+	}
+	groups := make(map[string][]*Node)
+	for _, n := range nodes {
+		v, err := exp.Evaluate(n)
+		if err != nil {
+			return nil, err
+		}
+		key, _ := valueString(v)
+		groups[key] = append(groups[key], n)
+	}
+	for key, group := range groups {
+		groups[key] = sortDocumentOrder(group)
+	}
+	return groups, nil
+}
+
+// valueString converts the result of Expr.Evaluate to a string, reporting
+// false for an empty node-set.
+func valueString(v interface{}) (string, bool) {
+	if a, ok := v.([]*Node); ok && len(a) == 0 {
+		return "", false
+	}
+	return stringArg(v), true
+}
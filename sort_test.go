@@ -0,0 +1,99 @@
+package jsonquery
+
+import (
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestSortNodes(t *testing.T) {
+	doc := MustParse(`{"people":[
+		{"name":"joe","age":45},
+		{"name":"mark","age":2},
+		{"name":"ann"},
+		{"name":"bob","age":"unknown"},
+		{"name":"carl","age":9}
+	]}`)
+	names := func(nodes []*Node) string {
+		var a []string
+		for _, n := range nodes {
+			a = append(a, n.SelectElement("name").InnerText())
+		}
+		return strings.Join(a, ",")
+	}
+	for _, test := range []struct {
+		by            string
+		numeric, desc bool
+		want          string
+	}{
+		{"age", true, false, "mark,carl,joe,ann,bob"},
+		{"age", true, true, "joe,carl,mark,ann,bob"},
+		// As strings "9" > "45" and "unknown" is a value.
+		{"age", false, false, "mark,joe,carl,bob,ann"},
+		{"name", false, false, "ann,bob,carl,joe,mark"},
+		{"name", false, true, "mark,joe,carl,bob,ann"},
+		{"string-length(name)", true, false, "joe,ann,bob,mark,carl"},
+		{"missing", false, false, "joe,mark,ann,bob,carl"},
+	} {
+		nodes := Find(doc, "//people/*")
+		if err := SortNodes(nodes, test.by, test.numeric, test.desc); err != nil {
+			t.Fatal(err)
+		}
+		if g := names(nodes); g != test.want {
+			t.Fatalf("sort by %s numeric=%v desc=%v: expected %v but %v", test.by, test.numeric, test.desc, test.want, g)
+		}
+	}
+	if err := SortNodes(Find(doc, "//people/*"), "age[", true, false); err == nil {
+		t.Fatal("expected error for an invalid expression")
+	}
+}
+
+func TestGroupNodes(t *testing.T) {
+	doc, _ := parseString(testConfig)
+	format := func(groups map[string][]*Node, field string) string {
+		var keys []string
+		for key := range groups {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		var a []string
+		for _, key := range keys {
+			var values []string
+			for _, n := range groups[key] {
+				values = append(values, n.SelectElement(field).InnerText())
+			}
+			a = append(a, key+":"+strings.Join(values, ","))
+		}
+		return strings.Join(a, " ")
+	}
+
+	groups, err := GroupNodes(Find(doc, "//areas/*"), "name(ancestor::*[3])")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e, g := "ri1:0.0.0.0 ri2:0.0.0.1 ri3:0.0.0.2", format(groups, "area_id"); e != g {
+		t.Fatalf("expected %v but %v", e, g)
+	}
+
+	people := MustParse(`[{"name":"joe","age":45},{"name":"mark","age":2},{"name":"ann","age":41},{"name":"bob"}]`)
+	nodes := Find(people, "/*")
+	// Groups keep document order even if nodes are not.
+	nodes[0], nodes[2] = nodes[2], nodes[0]
+	groups, err = GroupNodes(nodes, "floor(age div 10)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e, g := "0:mark 4:joe,ann NaN:bob", format(groups, "name"); e != g {
+		t.Fatalf("expected %v but %v", e, g)
+	}
+	groups, err = GroupNodes(Find(people, "/*"), "age")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e, g := ":bob 2:mark 41:ann 45:joe", format(groups, "name"); e != g {
+		t.Fatalf("expected %v but %v", e, g)
+	}
+	if _, err := GroupNodes(nodes, "age["); err == nil {
+		t.Fatal("expected error for an invalid expression")
+	}
+}
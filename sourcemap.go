@@ -0,0 +1,179 @@
+package jsonquery
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"sort"
+)
+
+// A SourceMap holds the location in the source text of the nodes of a
+// document parsed by ParseWithSourceMap.
+type SourceMap struct {
+	spans map[*Node]span
+	// lines holds the offset of the start of each line.
+	lines []int
+}
+
+type span struct {
+	start, end int
+}
+
+// ParseWithSourceMap is like Parse but also returns the location of every
+// node of the document in the text read from r.
+func ParseWithSourceMap(r io.Reader) (*Node, *SourceMap, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	doc, err := parse(b)
+	if err != nil {
+		return nil, nil, err
+	}
+	m := &SourceMap{spans: make(map[*Node]span), lines: []int{0}}
+	for i, c := range b {
+		if c == '\n' {
+			m.lines = append(m.lines, i+1)
+		}
+	}
+	s := &sourceScanner{b: b, m: m}
+	start := s.skipSpace()
+	s.value(doc)
+	m.spans[doc] = span{start, s.i}
+	return doc, m, nil
+}
+
+// Lookup returns the location of n in the source text: the 1-based line
+// and column, in bytes, of its first character, and the offsets of its
+// first character and of the one after its last. An object member starts
+// at its key, and the other nodes at their value. ok is false if n was
+// not created by the parse of m, or was added to the document later.
+func (m *SourceMap) Lookup(n *Node) (line, col, startOffset, endOffset int, ok bool) {
+	sp, ok := m.spans[n]
+	if !ok {
+		return 0, 0, 0, 0, false
+	}
+	i := sort.Search(len(m.lines), func(i int) bool { return m.lines[i] > sp.start }) - 1
+	return i + 1, sp.start - m.lines[i] + 1, sp.start, sp.end, true
+}
+
+// sourceScanner walks the text of a valid JSON document along the nodes
+// parsed from it, recording their location.
+type sourceScanner struct {
+	b []byte
+	i int
+	m *SourceMap
+}
+
+func (s *sourceScanner) skipSpace() int {
+	for s.i < len(s.b) {
+		switch s.b[s.i] {
+		case ' ', '\t', '\n', '\r':
+			s.i++
+		default:
+			return s.i
+		}
+	}
+	return s.i
+}
+
+// value scans the value of n, which starts at the current offset. n is
+// nil for values that are not in the tree.
+func (s *sourceScanner) value(n *Node) {
+	start := s.i
+	switch s.b[s.i] {
+	case '{':
+		s.i++
+		seen := make(map[string]bool)
+		for s.skipSpace(); s.b[s.i] != '}'; s.skipSpace() {
+			if s.b[s.i] == ',' {
+				s.i++
+				s.skipSpace()
+			}
+			keyStart := s.i
+			var key string
+			json.Unmarshal(s.b[keyStart:s.stringEnd()], &key)
+			s.skipSpace()
+			s.i++ // ':'
+			s.skipSpace()
+			var c *Node
+			if n != nil {
+				c = n.selectMember(key)
+			}
+			if seen[key] {
+				// The last of duplicate members is the one in the tree.
+				s.forget(c)
+			}
+			seen[key] = true
+			s.value(c)
+			s.record(c, keyStart)
+		}
+		s.i++
+	case '[':
+		s.i++
+		var c *Node
+		if n != nil {
+			c = n.FirstChild
+		}
+		for s.skipSpace(); s.b[s.i] != ']'; s.skipSpace() {
+			if s.b[s.i] == ',' {
+				s.i++
+				s.skipSpace()
+			}
+			itemStart := s.i
+			s.value(c)
+			s.record(c, itemStart)
+			if c != nil {
+				c = c.NextSibling
+			}
+		}
+		s.i++
+	case '"':
+		s.stringEnd()
+	default:
+		for s.i < len(s.b) && !isJSONDelim(s.b[s.i]) {
+			s.i++
+		}
+	}
+	if n != nil && n.FirstChild != nil && n.FirstChild.Type == TextNode {
+		s.record(n.FirstChild, start)
+	}
+}
+
+// record records that n spans from start to the current offset.
+func (s *sourceScanner) record(n *Node, start int) {
+	if n != nil {
+		s.m.spans[n] = span{start, s.i}
+	}
+}
+
+// forget removes the locations of n and its descendants.
+func (s *sourceScanner) forget(n *Node) {
+	if n == nil {
+		return
+	}
+	delete(s.m.spans, n)
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		s.forget(c)
+	}
+}
+
+func isJSONDelim(c byte) bool {
+	switch c {
+	case ',', '}', ']', ' ', '\t', '\n', '\r':
+		return true
+	}
+	return false
+}
+
+// stringEnd moves past the string at the current offset and returns the
+// offset after it.
+func (s *sourceScanner) stringEnd() int {
+	for s.i++; s.b[s.i] != '"'; s.i++ {
+		if s.b[s.i] == '\\' {
+			s.i++
+		}
+	}
+	s.i++
+	return s.i
+}
@@ -0,0 +1,50 @@
+package jsonquery
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseWithSourceMap(t *testing.T) {
+	src := `{
+  "name": "jo\"e",
+  "tags": [ 1, true ],
+  "none": null,
+  "dup": [1, {"a": 2}],
+  "dup": {"b": 3}
+}`
+	doc, m, err := ParseWithSourceMap(strings.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		n         *Node
+		line, col int
+		text      string
+	}{
+		{doc, 1, 1, src},
+		{doc.SelectElement("name"), 2, 3, `"name": "jo\"e"`},
+		{doc.SelectElement("name").FirstChild, 2, 11, `"jo\"e"`},
+		{doc.SelectElement("tags"), 3, 3, `"tags": [ 1, true ]`},
+		{FindOne(doc, "tags/*[1]"), 3, 13, `1`},
+		{FindOne(doc, "tags/*[2]").FirstChild, 3, 16, `true`},
+		{doc.SelectElement("none"), 4, 3, `"none": null`},
+		{doc.SelectElement("dup"), 6, 3, `"dup": {"b": 3}`},
+		{FindOne(doc, "dup/b"), 6, 11, `"b": 3`},
+	} {
+		line, col, start, end, ok := m.Lookup(test.n)
+		if !ok {
+			t.Fatalf("%s: expected a location", test.n)
+		}
+		if line != test.line || col != test.col || src[start:end] != test.text {
+			t.Fatalf("%s: expected %d:%d %q but %d:%d %q", test.n, test.line, test.col, test.text, line, col, src[start:end])
+		}
+	}
+	if _, _, _, _, ok := m.Lookup(MustParse(`1`)); ok {
+		t.Fatal("expected no location for a node of another document")
+	}
+
+	if _, _, err := ParseWithSourceMap(strings.NewReader(`{"a":`)); err == nil {
+		t.Fatal("expected error for invalid JSON")
+	}
+}
@@ -0,0 +1,79 @@
+package jsonquery
+
+// Stats holds metrics of a node tree, as returned by Node.Stats.
+type Stats struct {
+	// Nodes is the number of values of the tree, including the root and
+	// excluding text nodes.
+	Nodes int
+	// MaxDepth is the depth of the deepest value, the root being at
+	// depth 0.
+	MaxDepth int
+	Objects  int
+	Arrays   int
+	// Scalars is the number of strings, numbers, booleans and nulls.
+	Scalars int
+	// LongestArray is the number of items of the longest array.
+	LongestArray int
+}
+
+// Stats returns the metrics of the tree of n in a single traversal.
+func (n *Node) Stats() Stats {
+	var s Stats
+	var walk func(*Node, int)
+	walk = func(n *Node, depth int) {
+		s.Nodes++
+		if depth > s.MaxDepth {
+			s.MaxDepth = depth
+		}
+		switch n.ElType {
+		case MapNode:
+			s.Objects++
+		case ArrayNode:
+			s.Arrays++
+		default:
+			s.Scalars++
+			return
+		}
+		items := 0
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c, depth+1)
+			items++
+		}
+		if n.ElType == ArrayNode && items > s.LongestArray {
+			s.LongestArray = items
+		}
+	}
+	walk(n, 0)
+	return s
+}
+
+// DescendantCount returns the number of values below n: the members of
+// objects and the items of arrays, at any depth.
+func (n *Node) DescendantCount() int {
+	count, _ := subtreeSize(n)
+	return count
+}
+
+// SizeBytes returns an estimate of the size of the subtree of n: the sum
+// of the lengths of the keys of its descendants and of the texts of its
+// strings, numbers and booleans. It ignores the structure, so it is less
+// than the size of the JSON encoding.
+func (n *Node) SizeBytes() int {
+	_, size := subtreeSize(n)
+	return size
+}
+
+// subtreeSize returns the number of element nodes below n and the size
+// estimated by SizeBytes in a single traversal.
+func subtreeSize(n *Node) (count, size int) {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		size += len(c.Data)
+		if c.Type == ElementNode {
+			count++
+			cc, cs := subtreeSize(c)
+			count += cc
+			size += cs
+		}
+	}
+	return count, size
+}
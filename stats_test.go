@@ -0,0 +1,55 @@
+package jsonquery
+
+import (
+	"testing"
+)
+
+func TestStats(t *testing.T) {
+	doc, _ := parseString(testConfig)
+	e := Stats{
+		Nodes:        39,
+		MaxDepth:     8,
+		Objects:      17,
+		Arrays:       6,
+		Scalars:      16,
+		LongestArray: 4,
+	}
+	if g := doc.Stats(); g != e {
+		t.Fatalf("expected %+v but %+v", e, g)
+	}
+	if g, e := MustParse(`null`).Stats(), (Stats{Nodes: 1, Scalars: 1}); g != e {
+		t.Fatalf("expected %+v but %+v", e, g)
+	}
+}
+
+func TestDescendantCount(t *testing.T) {
+	doc, _ := parseString(`{
+		"name":"John",
+		"age":30,
+		"cars": [
+			{ "name":"Ford", "models":[ "Fiesta", "Focus", "Mustang" ] },
+			{ "name":"BMW", "models":[ "320", "X3", "X5" ] },
+			{ "name":"Fiat", "models":[ "500", "Panda" ] }
+		]
+	}`)
+	for _, test := range []struct {
+		n           *Node
+		count, size int
+	}{
+		{doc, 20, 91},
+		{doc.SelectElement("cars"), 17, 74},
+		{FindOne(doc, "//cars/*[1]"), 5, 32},
+		{FindOne(doc, "//cars/*[1]/name"), 0, 4},
+		{FindOne(doc, "age"), 0, 2},
+	} {
+		if g := test.n.DescendantCount(); g != test.count {
+			t.Fatalf("%s: expected %d descendants but %d", test.n, test.count, g)
+		}
+		if g := test.n.SizeBytes(); g != test.size {
+			t.Fatalf("%s: expected %d bytes but %d", test.n, test.size, g)
+		}
+	}
+	if g := doc.DescendantCount(); g != doc.Stats().Nodes-1 {
+		t.Fatalf("expected the number of nodes of Stats without the root but %d", g)
+	}
+}
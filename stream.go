@@ -0,0 +1,258 @@
+package jsonquery
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// StreamingQueryAll searches the JSON document read from r for the nodes
+// matching expr without building the tree of the whole document, so it
+// can search documents larger than memory. Each node matched is sent on
+// the first channel as a tree of its own, with no parent, which is closed
+// at the end of the search. The second channel receives the error that
+// stopped the search, if any, and is closed afterwards.
+//
+// expr must be a path of steps such as `/a/b` or `//a`, naming a member
+// or `*` for any member or array item, whose last step may have
+// predicates on its own subtree, such as `//people/*[age > 40]`. Nodes
+// are sent in the order of the document, in which the members of an
+// object are not sorted by key. A node matched inside another one is
+// sent after it, as a copy.
+// Return an error on the second channel if expr is not of this form,
+// r is not valid JSON, or ctx is done.
+func StreamingQueryAll(ctx context.Context, r io.Reader, expr string) (<-chan *Node, <-chan error) {
+	nodes := make(chan *Node)
+	errc := make(chan error, 1)
+	go func() {
+		defer close(errc)
+		defer close(nodes)
+		p, err := compileStreamPath(expr)
+		if err == nil {
+			s := &streamSearch{ctx: ctx, d: json.NewDecoder(r), p: p, nodes: nodes}
+			err = s.value(nil, "")
+		}
+		if err != nil {
+			errc <- err
+		}
+	}()
+	return nodes, errc
+}
+
+// A streamPath is an expression of StreamingQueryAll.
+type streamPath struct {
+	steps []streamStep
+	// deep is set if a step searches descendants.
+	deep bool
+	// pred holds the predicates of the last step, applied to `self::*`.
+	pred *Expr
+}
+
+type streamStep struct {
+	desc bool
+	name string
+}
+
+// streamPredicateRefs are the parts of a predicate that refer to nodes
+// outside of the subtree of the node tested, or to its position.
+var streamPredicateRefs = []string{"..", "ancestor", "parent::", "preceding", "following", "position(", "last(", "$"}
+
+func compileStreamPath(expr string) (*streamPath, error) {
+	p := &streamPath{}
+	s := strings.TrimSpace(expr)
+	if s != "" && s[0] != '/' {
+		s = "/" + s
+	}
+	for s != "" && s[0] == '/' {
+		step := streamStep{desc: strings.HasPrefix(s, "//")}
+		s = strings.TrimLeft(s[1:], "/")
+		i := 0
+		for i < len(s) && s[i] != '/' && s[i] != '[' {
+			i++
+		}
+		step.name = strings.TrimSpace(s[:i])
+		if !isStreamName(step.name) {
+			return nil, fmt.Errorf("jsonquery: expression %q is not supported for streaming: invalid step %q", expr, step.name)
+		}
+		p.deep = p.deep || step.desc
+		p.steps = append(p.steps, step)
+		s = s[i:]
+	}
+	if s != "" {
+		if s[0] != '[' {
+			return nil, fmt.Errorf("jsonquery: expression %q is not supported for streaming", expr)
+		}
+		refs := stripLiterals(s)
+		for _, ref := range streamPredicateRefs {
+			if strings.Contains(refs, ref) {
+				return nil, fmt.Errorf("jsonquery: expression %q is not supported for streaming: predicate refers to %q", expr, ref)
+			}
+		}
+		for rest := s; rest != ""; {
+			end := matchingBracket(rest, 0)
+			if end < 0 {
+				return nil, fmt.Errorf("jsonquery: expression %q is not supported for streaming", expr)
+			}
+			if _, err := strconv.ParseFloat(strings.TrimSpace(rest[1:end]), 64); err == nil {
+				return nil, fmt.Errorf("jsonquery: expression %q is not supported for streaming: predicate refers to the position", expr)
+			}
+			rest = strings.TrimLeft(rest[end+1:], " \t\r\n")
+			if rest != "" && rest[0] != '[' {
+				return nil, fmt.Errorf("jsonquery: expression %q is not supported for streaming", expr)
+			}
+		}
+		pred, err := Compile("self::*" + s)
+		if err != nil {
+			return nil, err
+		}
+		p.pred = pred
+	}
+	if len(p.steps) == 0 {
+		return nil, fmt.Errorf("jsonquery: expression %q is not supported for streaming", expr)
+	}
+	return p, nil
+}
+
+func isStreamName(name string) bool {
+	if name == "*" {
+		return true
+	}
+	for i, r := range name {
+		if i == 0 && !isNameStart(r) || !isNameChar(r) {
+			return false
+		}
+	}
+	return name != ""
+}
+
+// match reports whether the names of a node and of its ancestors, from
+// the root, are matched by the steps of p.
+func (p *streamPath) match(path []string) bool {
+	var match func(steps []streamStep, path []string) bool
+	match = func(steps []streamStep, path []string) bool {
+		if len(steps) == 0 || len(path) == 0 {
+			return len(steps) == 0 && len(path) == 0
+		}
+		st := steps[0]
+		if (st.name == "*" || st.name == path[0]) && match(steps[1:], path[1:]) {
+			return true
+		}
+		return st.desc && match(steps, path[1:])
+	}
+	return match(p.steps, path)
+}
+
+// A streamSearch searches a JSON stream for the nodes of a streamPath.
+type streamSearch struct {
+	ctx   context.Context
+	d     *json.Decoder
+	p     *streamPath
+	nodes chan<- *Node
+}
+
+// value searches the next value of the stream, named name, whose
+// ancestors are named path.
+func (s *streamSearch) value(path []string, name string) error {
+	if err := s.ctx.Err(); err != nil {
+		return err
+	}
+	if path != nil || name != "" {
+		path = append(path, name)
+	}
+	if len(path) > 0 && s.p.match(path) {
+		var v interface{}
+		if err := s.d.Decode(&v); err != nil {
+			return err
+		}
+		n := &Node{Type: ElementNode, Data: name}
+		parseValue(v, n, 1, nil)
+		return s.emit(n, path[:len(path)-1])
+	}
+	if !s.p.deep && len(path) >= len(s.p.steps) {
+		var skip json.RawMessage
+		return s.d.Decode(&skip)
+	}
+	t, err := s.d.Token()
+	if err != nil {
+		return err
+	}
+	switch t {
+	case json.Delim('{'):
+		for s.d.More() {
+			key, err := s.d.Token()
+			if err != nil {
+				return err
+			}
+			if err := s.value(path, key.(string)); err != nil {
+				return err
+			}
+		}
+	case json.Delim('['):
+		for s.d.More() {
+			if err := s.value(path, ""); err != nil {
+				return err
+			}
+		}
+	default:
+		return nil
+	}
+	_, err = s.d.Token()
+	return err
+}
+
+// emit sends n if it satisfies the predicates, and the copies of the
+// nodes matched in its subtree. path holds the names of the ancestors of
+// n.
+func (s *streamSearch) emit(n *Node, path []string) error {
+	var matches []*Node
+	var walk func(c *Node, path []string) error
+	walk = func(c *Node, path []string) error {
+		path = append(path, c.Data)
+		if c == n || s.p.match(path) {
+			m := c
+			if c != n {
+				m = c.Clone()
+			}
+			ok, err := s.test(m)
+			if err != nil {
+				return err
+			}
+			if ok {
+				matches = append(matches, m)
+			}
+		}
+		if !s.p.deep {
+			return nil
+		}
+		for cc := c.FirstChild; cc != nil; cc = cc.NextSibling {
+			if cc.Type == ElementNode {
+				if err := walk(cc, path); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	if err := walk(n, path); err != nil {
+		return err
+	}
+	for _, m := range matches {
+		select {
+		case s.nodes <- m:
+		case <-s.ctx.Done():
+			return s.ctx.Err()
+		}
+	}
+	return nil
+}
+
+func (s *streamSearch) test(n *Node) (bool, error) {
+	if s.p.pred == nil {
+		return true, nil
+	}
+	m, err := s.p.pred.Query(n)
+	return m != nil, err
+}
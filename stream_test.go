@@ -0,0 +1,75 @@
+package jsonquery
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func streamAll(ctx context.Context, src, expr string) ([]string, error) {
+	nodes, errc := StreamingQueryAll(ctx, strings.NewReader(src), expr)
+	var a []string
+	for n := range nodes {
+		if n.Parent != nil {
+			return nil, errors.New("expected nodes without parent")
+		}
+		a = append(a, n.Data+"="+n.String())
+	}
+	return a, <-errc
+}
+
+func TestStreamingQueryAll(t *testing.T) {
+	doc, _ := parseString(testConfig)
+	for _, expr := range []string{
+		"//people/*[age < 44]",
+		"//people/*/name",
+		"/top/inner/*",
+		"top/route-instance/*[metric > 50]",
+		"//metric",
+		"//*[metric]",
+		"//area_id",
+		"//ospf//*[area_id = '0.0.0.1']",
+		"//areas",
+		"//top/*/*",
+		"//nothing",
+	} {
+		g, err := streamAll(context.Background(), testConfig, expr)
+		if err != nil {
+			t.Fatalf("%s: %v", expr, err)
+		}
+		var e []string
+		for _, n := range Find(doc, expr) {
+			e = append(e, n.Data+"="+n.String())
+		}
+		sort.Strings(e)
+		sort.Strings(g)
+		if strings.Join(e, "\n") != strings.Join(g, "\n") {
+			t.Fatalf("%s: expected %v but %v", expr, e, g)
+		}
+	}
+
+	// Nodes come in the order of the document.
+	g, err := streamAll(context.Background(), `{"b":{"a":1},"a":{"a":2}}`, "//a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e := `a=1 a={"a":2} a=2`; strings.Join(g, " ") != e {
+		t.Fatalf("expected %v but %v", e, g)
+	}
+
+	for _, expr := range []string{"//a/..", "//a[1]", "//a[../b]", "//a[b]/c", "count(//a)", "//a | //b", ""} {
+		if _, err := streamAll(context.Background(), testConfig, expr); err == nil {
+			t.Fatalf("%s: expected error for an unsupported expression", expr)
+		}
+	}
+	if _, err := streamAll(context.Background(), `{"a": [1, }`, "//a"); err == nil {
+		t.Fatal("expected error for invalid JSON")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := streamAll(ctx, testConfig, "//a"); err != context.Canceled {
+		t.Fatalf("expected %v but %v", context.Canceled, err)
+	}
+}
@@ -0,0 +1,94 @@
+package jsonquery
+
+import "sync"
+
+// NodeSync guards a Node tree with a sync.RWMutex so that it can be
+// queried and patched concurrently. Queries hold the read lock and
+// patches hold the write lock.
+//
+// Query, QueryAll and SelectElement return copies of the nodes of the
+// guarded tree, which later patches don't change. Use View to read the
+// tree itself, or Snapshot to process the document without holding the
+// lock.
+type NodeSync struct {
+	mu   sync.RWMutex
+	root *Node
+}
+
+// NewNodeSync returns a NodeSync guarding root. root must not be accessed
+// directly afterwards.
+func NewNodeSync(root *Node) *NodeSync {
+	return &NodeSync{root: root}
+}
+
+// Query is like the Query function on the guarded tree, but returns a
+// deep copy of the node found.
+func (s *NodeSync) Query(expr string) (*Node, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	n, err := Query(s.root, expr)
+	if n == nil {
+		return nil, err
+	}
+	return n.Clone(), nil
+}
+
+// QueryAll is like the QueryAll function on the guarded tree, but returns
+// deep copies of the nodes found. Each node is copied with all its child
+// nodes, so a query selecting nested nodes copies them several times.
+func (s *NodeSync) QueryAll(expr string) ([]*Node, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	nodes, err := QueryAll(s.root, expr)
+	if err != nil {
+		return nil, err
+	}
+	for i, n := range nodes {
+		nodes[i] = n.Clone()
+	}
+	return nodes, nil
+}
+
+// SelectElement returns a deep copy of the first child element of the
+// root with the specified name, or nil if there is none.
+func (s *NodeSync) SelectElement(name string) *Node {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if n := s.root.SelectElement(name); n != nil {
+		return n.Clone()
+	}
+	return nil
+}
+
+// View calls fn with the root of the guarded tree, holding the read lock
+// until fn returns. fn must not modify the tree or keep any of its nodes
+// after returning.
+func (s *NodeSync) View(fn func(root *Node)) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	fn(s.root)
+}
+
+// ApplyPatch applies the JSON Patch document patch to the guarded tree,
+// as the ApplyPatch function.
+func (s *NodeSync) ApplyPatch(patch []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return ApplyPatch(s.root, patch)
+}
+
+// ApplyMergePatch applies the JSON Merge Patch document patch to the
+// guarded tree, as the ApplyMergePatch function.
+func (s *NodeSync) ApplyMergePatch(patch []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return ApplyMergePatch(s.root, patch)
+}
+
+// Snapshot returns a deep copy of the guarded tree, which can be used
+// without locking.
+func (s *NodeSync) Snapshot() *Node {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.root.Clone()
+}
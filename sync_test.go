@@ -0,0 +1,108 @@
+package jsonquery
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestNodeSync(t *testing.T) {
+	s := NewNodeSync(MustParse(`{"count":0,"items":[]}`))
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			patch := fmt.Sprintf(`[{"op":"add","path":"/items/-","value":%d}]`, i)
+			if err := s.ApplyPatch([]byte(patch)); err != nil {
+				t.Error(err)
+			}
+		}(i)
+		go func() {
+			defer wg.Done()
+			if _, err := s.QueryAll("items/*"); err != nil {
+				t.Error(err)
+			}
+			s.Snapshot()
+		}()
+	}
+	wg.Wait()
+	if err := s.ApplyMergePatch([]byte(`{"count":10}`)); err != nil {
+		t.Fatal(err)
+	}
+	if n := s.SelectElement("count"); n == nil || n.InnerText() != "10" {
+		t.Fatalf("expected count 10 but %v", n)
+	}
+	nodes, err := s.QueryAll("items/*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nodes) != 10 {
+		t.Fatalf("expected 10 items but %d", len(nodes))
+	}
+	snapshot := s.Snapshot()
+	if err := s.ApplyPatch([]byte(`[{"op":"remove","path":"/items"}]`)); err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := s.Query("items"); n != nil {
+		t.Fatalf("expected items to be removed but %v", n)
+	}
+	if len(Find(snapshot, "items/*")) != 10 {
+		t.Fatal("expected the snapshot to be unchanged")
+	}
+}
+
+func TestNodeSyncCopies(t *testing.T) {
+	s := NewNodeSync(MustParse(`{"config":{"level":1},"items":[1,2]}`))
+	config := s.SelectElement("config")
+	level, err := s.Query("config/level")
+	if err != nil {
+		t.Fatal(err)
+	}
+	items, err := s.QueryAll("items/*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			if err := s.ApplyMergePatch([]byte(fmt.Sprintf(`{"config":{"level":%d}}`, i))); err != nil {
+				t.Error(err)
+			}
+		}(i)
+		go func() {
+			defer wg.Done()
+			// The nodes returned earlier are not part of the tree being
+			// patched.
+			if e, g := "1", config.SelectElement("level").InnerText(); e != g {
+				t.Errorf("expected %v but %v", e, g)
+			}
+			if e, g := "1", level.InnerText(); e != g {
+				t.Errorf("expected %v but %v", e, g)
+			}
+		}()
+	}
+	wg.Wait()
+	if e, g := 2, len(items); e != g {
+		t.Fatalf("expected %v but %v", e, g)
+	}
+	if config.Parent != nil || items[0].Parent != nil {
+		t.Fatal("expected detached copies")
+	}
+
+	var n int
+	s.View(func(root *Node) {
+		n = len(Find(root, "items/*"))
+	})
+	if e, g := 2, n; e != g {
+		t.Fatalf("expected %v but %v", e, g)
+	}
+	if n, err := s.Query("missing"); n != nil || err != nil {
+		t.Fatalf("expected nil but %v, %v", n, err)
+	}
+	if n := s.SelectElement("missing"); n != nil {
+		t.Fatalf("expected nil but %v", n)
+	}
+}
@@ -0,0 +1,50 @@
+package jsonquery
+
+import (
+	"io"
+	"time"
+
+	"github.com/BurntSushi/toml"
+)
+
+// ParseTOML parses a TOML document into a Node tree. Tables become
+// MapNode elements and arrays become ArrayNode elements, while integers,
+// floats, booleans and strings keep their kinds. Datetimes become
+// StringNode elements in RFC 3339 format.
+func ParseTOML(r io.Reader) (*Node, error) {
+	var v map[string]interface{}
+	if _, err := toml.NewDecoder(r).Decode(&v); err != nil {
+		return nil, err
+	}
+	doc := &Node{Type: DocumentNode}
+	parseValue(tomlValue(v), doc, 1, nil)
+	return doc, nil
+}
+
+// tomlValue converts a decoded TOML value into the values produced by
+// encoding/json.
+func tomlValue(x interface{}) interface{} {
+	switch v := x.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, vv := range v {
+			m[key] = tomlValue(vv)
+		}
+		return m
+	case []map[string]interface{}:
+		a := make([]interface{}, len(v))
+		for i, vv := range v {
+			a[i] = tomlValue(vv)
+		}
+		return a
+	case []interface{}:
+		a := make([]interface{}, len(v))
+		for i, vv := range v {
+			a[i] = tomlValue(vv)
+		}
+		return a
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	}
+	return x
+}
@@ -0,0 +1,65 @@
+package jsonquery
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseTOML(t *testing.T) {
+	s := `
+title = "example"
+enabled = true
+ports = [ 8000, 8001 ]
+released = 1979-05-27T07:32:00Z
+
+[database]
+server = "192.168.1.1"
+max_conn = 9007199254740993
+ratio = 0.75
+
+[[servers]]
+name = "alpha"
+
+[[servers]]
+name = "beta"
+`
+	doc, err := ParseTOML(strings.NewReader(s))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []struct {
+		expr, value string
+		typ         ElementType
+	}{
+		{"title", "example", StringNode},
+		{"enabled", "true", BooleanNode},
+		{"ports/*[2]", "8001", NumberNode},
+		{"released", "1979-05-27T07:32:00Z", StringNode},
+		{"database/server", "192.168.1.1", StringNode},
+		{"database/max_conn", "9007199254740993", NumberNode},
+		{"database/ratio", "0.75", NumberNode},
+		{"servers/*[name='beta']/name", "beta", StringNode},
+	}
+	for _, v := range expected {
+		n := FindOne(doc, v.expr)
+		if n == nil {
+			t.Fatalf("%s: no node found", v.expr)
+		}
+		if e, g := v.value, n.InnerText(); e != g {
+			t.Fatalf("%s: expected %v but %v", v.expr, e, g)
+		}
+		if e, g := v.typ, n.ElType; e != g {
+			t.Fatalf("%s: expected type %v but %v", v.expr, e, g)
+		}
+	}
+	if e, g := ArrayNode, FindOne(doc, "servers").ElType; e != g {
+		t.Fatalf("expected %v but %v", e, g)
+	}
+	if e, g := MapNode, FindOne(doc, "database").ElType; e != g {
+		t.Fatalf("expected %v but %v", e, g)
+	}
+
+	if _, err := ParseTOML(strings.NewReader("a = ")); err == nil {
+		t.Fatal("expected error for invalid TOML")
+	}
+}
@@ -0,0 +1,311 @@
+package jsonquery
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// Zip returns a new array whose items are objects merging the members of
+// the items at the same position in the arrays n and other, like zip in
+// Python. An item that is not an object contributes a member named after
+// its array, so zipping {"names":["a"],"values":[1]} gives
+// [{"names":"a","values":1}]. A member of other replaces a member of n
+// with the same name. n and other are not modified.
+// Return an error if n or other is not an array, they have different
+// lengths or an item that is not an object belongs to an unnamed array.
+func (n *Node) Zip(other *Node) (*Node, error) {
+	a, b := n.ChildNodes(), other.ChildNodes()
+	if n.ElType != ArrayNode || other.ElType != ArrayNode {
+		return nil, fmt.Errorf("cannot zip %s and %s: not arrays", n.Data, other.Data)
+	}
+	if len(a) != len(b) {
+		return nil, fmt.Errorf("cannot zip arrays of length %d and %d", len(a), len(b))
+	}
+	zipped := &Node{Type: ElementNode, ElType: ArrayNode}
+	for i := range a {
+		item := &Node{Type: ElementNode, ElType: MapNode}
+		for _, c := range []*Node{a[i], b[i]} {
+			if c.ElType != MapNode {
+				if c.Parent.Data == "" {
+					return nil, fmt.Errorf("cannot zip item %d: not an object in an unnamed array", i)
+				}
+				addMember(item, c.Parent.Data, c)
+				continue
+			}
+			for m := c.FirstChild; m != nil; m = m.NextSibling {
+				addMember(item, m.Data, m)
+			}
+		}
+		appendChild(zipped, item)
+	}
+	return zipped, nil
+}
+
+// addMember adds a copy of the value of v to the object n as the member
+// name, replacing an existing member with that name.
+func addMember(n *Node, name string, v *Node) {
+	c := v.Clone()
+	c.Data = name
+	if old := n.selectMember(name); old != nil {
+		replaceValue(old, c)
+		return
+	}
+	appendChild(n, c)
+	setLevel(c, n.level+1)
+}
+
+// Transform returns a new tree built by calling fn with every element
+// node of the subtree of n, parents before their children, and replacing
+// the node by the result of fn: nil deletes the node, n itself keeps it
+// and transforms its children, and any other node replaces it with a
+// copy of that node and its children, which are not transformed. A
+// replacement keeps the name of the node it replaces. The tree of n is
+// not modified. Transform returns nil if fn deletes n.
+func (n *Node) Transform(fn func(*Node) *Node) *Node {
+	var transform func(*Node) *Node
+	transform = func(n *Node) *Node {
+		if n.Type == TextNode {
+			return &Node{Type: TextNode, Data: n.Data}
+		}
+		r := fn(n)
+		if r == nil {
+			return nil
+		}
+		if r != n {
+			c := r.Clone()
+			c.Type, c.Data = n.Type, n.Data
+			return c
+		}
+		c := &Node{Type: n.Type, ElType: n.ElType, Data: n.Data}
+		for nn := n.FirstChild; nn != nil; nn = nn.NextSibling {
+			if cc := transform(nn); cc != nil {
+				appendChild(c, cc)
+			}
+		}
+		return c
+	}
+	c := transform(n)
+	if c != nil {
+		setLevel(c, n.level)
+	}
+	return c
+}
+
+// TransformText replaces the text of every value in the tree of root by
+// the result of fn, called with the JSON Pointer of the value, such as
+// "/users/0/password", and its text. A number or boolean whose text is
+// changed becomes a string. Unlike Transform, the tree is modified in
+// place.
+func TransformText(root *Node, fn func(path string, value string) string) {
+	mutate(root, func() {
+		var walk func(*Node)
+		walk = func(n *Node) {
+			for c := n.FirstChild; c != nil; c = c.NextSibling {
+				if c.Type != TextNode {
+					walk(c)
+					continue
+				}
+				if v := fn(nodePointer(c), c.Data); v != c.Data {
+					c.Data = v
+					n.ElType = StringNode
+				}
+			}
+		}
+		walk(root)
+	})
+}
+
+// Merge returns a new node merging the objects n and other: it has the
+// members of both, and the values of members in both are merged
+// recursively if they are objects or taken from other otherwise, so
+// arrays are replaced rather than concatenated. Members only in other
+// follow the members of n. If n or other is not an object, Merge returns
+// a copy of other. n and other are not modified.
+func (n *Node) Merge(other *Node) *Node {
+	if n.ElType != MapNode || other.ElType != MapNode {
+		c := other.Clone()
+		c.Type, c.Data = ElementNode, n.Data
+		return c
+	}
+	c := &Node{Type: ElementNode, ElType: MapNode, Data: n.Data}
+	for m := n.FirstChild; m != nil; m = m.NextSibling {
+		if o := other.selectMember(m.Data); o != nil {
+			appendChild(c, m.Merge(o))
+		} else {
+			appendChild(c, m.Clone())
+		}
+	}
+	for o := other.FirstChild; o != nil; o = o.NextSibling {
+		if !n.HasChild(o.Data) {
+			appendChild(c, o.Clone())
+		}
+	}
+	setLevel(c, n.level)
+	return c
+}
+
+// Intersect returns a new node with the members of the object n whose
+// names are also members of the object other, or the items of the array
+// n that are equal to an item of the array other, comparing their JSON
+// values. Values are copied from n. n and other are not modified.
+// Return an error if n and other are not both objects or both arrays.
+func (n *Node) Intersect(other *Node) (*Node, error) {
+	return n.filterChildren(other, "intersect", true)
+}
+
+// Subtract returns a new node with the members of the object n whose
+// names are not members of the object other, or the items of the array
+// n that are not equal to any item of the array other, comparing their
+// JSON values. Values are copied from n. n and other are not modified.
+// Subtract returns nil if n and other are not both objects or both
+// arrays, or an item of the arrays cannot be encoded as JSON.
+func (n *Node) Subtract(other *Node) *Node {
+	c, err := n.filterChildren(other, "subtract", false)
+	if err != nil {
+		return nil
+	}
+	return c
+}
+
+// filterChildren returns a copy of n with the children that are in
+// other if in is true, or that are not in other otherwise.
+func (n *Node) filterChildren(other *Node, op string, in bool) (*Node, error) {
+	if n.ElType != other.ElType || n.ElType != MapNode && n.ElType != ArrayNode {
+		return nil, fmt.Errorf("cannot %s %s and %s", op, schemaType(n), schemaType(other))
+	}
+	c := &Node{Type: ElementNode, ElType: n.ElType, Data: n.Data}
+	var values []interface{}
+	if n.ElType == ArrayNode {
+		for o := other.FirstChild; o != nil; o = o.NextSibling {
+			v, err := decodeValue(o)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, v)
+		}
+	}
+	for m := n.FirstChild; m != nil; m = m.NextSibling {
+		found := false
+		if n.ElType == MapNode {
+			found = other.HasChild(m.Data)
+		} else {
+			v, err := decodeValue(m)
+			if err != nil {
+				return nil, err
+			}
+			for _, ov := range values {
+				if reflect.DeepEqual(v, ov) {
+					found = true
+					break
+				}
+			}
+		}
+		if found == in {
+			appendChild(c, m.Clone())
+		}
+	}
+	setLevel(c, n.level)
+	return c, nil
+}
+
+// CompactOptions configures which values CompactWithOptions removes in
+// addition to nulls and empty objects and arrays.
+type CompactOptions struct {
+	// EmptyStrings removes empty strings.
+	EmptyStrings bool
+	// ZeroValues removes the number 0 and false.
+	ZeroValues bool
+}
+
+// Compact returns a new tree without the nulls and the empty objects and
+// arrays of the tree of n, recursively, so an object or array that only
+// holds such values is removed too. n itself is kept even if it becomes
+// empty, and becomes null if it is a value that is removed. The tree of n
+// is not modified.
+func (n *Node) Compact() *Node {
+	return n.CompactWithOptions(CompactOptions{})
+}
+
+// CompactWithOptions is like Compact but also removes the values
+// selected by opts.
+func (n *Node) CompactWithOptions(opts CompactOptions) *Node {
+	var compact func(*Node) *Node
+	compact = func(n *Node) *Node {
+		switch n.ElType {
+		case NullNode:
+			return nil
+		case StringNode:
+			if opts.EmptyStrings && n.InnerText() == "" {
+				return nil
+			}
+		case NumberNode:
+			if f, err := nodeNumber(n); opts.ZeroValues && err == nil && f == 0 {
+				return nil
+			}
+		case BooleanNode:
+			if opts.ZeroValues && n.InnerText() == "false" {
+				return nil
+			}
+		case MapNode, ArrayNode:
+			c := &Node{Type: n.Type, ElType: n.ElType, Data: n.Data}
+			for nn := n.FirstChild; nn != nil; nn = nn.NextSibling {
+				if cc := compact(nn); cc != nil {
+					appendChild(c, cc)
+				}
+			}
+			if c.FirstChild == nil {
+				return nil
+			}
+			return c
+		}
+		return n.Clone()
+	}
+	c := compact(n)
+	if c == nil {
+		c = &Node{Type: n.Type, ElType: n.ElType, Data: n.Data}
+		if n.ElType != MapNode && n.ElType != ArrayNode {
+			c.ElType = NullNode
+		}
+	}
+	setLevel(c, n.level)
+	return c
+}
+
+// Project reshapes every node of nodes into a map whose keys are the keys
+// of mapping, such as {"full": "name", "years": "age"}. The value of a key
+// is the result of the XPath expression mapping[key] evaluated relative to
+// the node: the decoded JSON value of the first node matched, or nil if
+// none matches, for a node-set, and a float64, string or bool otherwise.
+// Objects and arrays become maps and slices.
+// Return an error if an expression cannot be parsed.
+func Project(nodes []*Node, mapping map[string]string) ([]map[string]interface{}, error) {
+	exprs := make(map[string]*Expr, len(mapping))
+	for key, expr := range mapping {
+		exp, err := getQuery(expr)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", key, err)
+		}
+		exprs[key] = exp
+	}
+	result := make([]map[string]interface{}, len(nodes))
+	for i, n := range nodes {
+		m := make(map[string]interface{}, len(exprs))
+		for key, exp := range exprs {
+			v, err := exp.Evaluate(n)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", key, err)
+			}
+			if nodes, ok := v.([]*Node); ok {
+				v = nil
+				if len(nodes) > 0 {
+					if v, err = decodeValue(nodes[0]); err != nil {
+						return nil, fmt.Errorf("%s: %w", key, err)
+					}
+				}
+			}
+			m[key] = v
+		}
+		result[i] = m
+	}
+	return result, nil
+}
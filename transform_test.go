@@ -0,0 +1,218 @@
+package jsonquery
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestZip(t *testing.T) {
+	doc := MustParse(`{"names":["a","b"],"values":[1,2],"people":[{"name":"joe","age":1},{"name":"mark"}],"extra":[{"age":45},{"age":2,"x":true}],"short":[1]}`)
+	tests := []struct {
+		a, b, want string
+	}{
+		{"names", "values", `[{"names":"a","values":1},{"names":"b","values":2}]`},
+		{"people", "extra", `[{"age":45,"name":"joe"},{"age":2,"name":"mark","x":true}]`},
+		{"people", "names", `[{"age":1,"name":"joe","names":"a"},{"name":"mark","names":"b"}]`},
+	}
+	for _, test := range tests {
+		before := doc.String()
+		z, err := FindOne(doc, test.a).Zip(FindOne(doc, test.b))
+		if err != nil {
+			t.Fatalf("%s.Zip(%s): %v", test.a, test.b, err)
+		}
+		if g := z.String(); g != test.want {
+			t.Fatalf("%s.Zip(%s): expected %s but %s", test.a, test.b, test.want, g)
+		}
+		if doc.String() != before {
+			t.Fatalf("%s.Zip(%s) modified the inputs", test.a, test.b)
+		}
+	}
+	z, _ := FindOne(doc, "names").Zip(FindOne(doc, "values"))
+	if nodes := Find(z, "*[values = 2]/names"); len(nodes) != 1 || nodes[0].InnerText() != "b" {
+		t.Fatalf("expected zipped items to be queryable but %v", nodes)
+	}
+
+	if _, err := FindOne(doc, "names").Zip(FindOne(doc, "short")); err == nil || !strings.Contains(err.Error(), "length") {
+		t.Fatalf("expected length error but %v", err)
+	}
+	if _, err := FindOne(doc, "names").Zip(FindOne(doc, "names/*[1]")); err == nil {
+		t.Fatal("expected error zipping a string")
+	}
+}
+
+func TestTransform(t *testing.T) {
+	doc, _ := parseString(testConfig)
+	before := doc.String()
+	out := doc.Transform(func(n *Node) *Node {
+		switch {
+		case n.Data == "people" || n.Data == "inner":
+			return nil
+		case n.Data == "metric":
+			// Replace a scalar with an object.
+			return MustParse(`{"cost":` + n.InnerText() + `,"unit":"ms"}`)
+		case n.Data == "area_id":
+			return ParseTree(strings.Replace(n.InnerText(), ".", "-", -1))
+		}
+		return n
+	})
+	if doc.String() != before {
+		t.Fatal("Transform modified the original tree")
+	}
+	want := `{"top":{"route-instance":{"ri1":{"metric":{"cost":24,"unit":"ms"}},"ri2":{"metric":{"cost":89,"unit":"ms"}}},` +
+		`"sites":[{"ri1":{"ospf":{"areas":[{"area_id":"0-0-0-0","metric":{"cost":0,"unit":"ms"}}]}},` +
+		`"ri2":{"ospf":{"areas":[{"area_id":"0-0-0-1","metric":{"cost":1,"unit":"ms"}}]}},` +
+		`"ri3":{"ospf":{"areas":[{"area_id":"0-0-0-2","metric":{"cost":2,"unit":"ms"}}]}}}]}}`
+	if g := out.String(); g != want {
+		t.Fatalf("expected %s but %s", want, g)
+	}
+	if sum, err := QueryAggregate(out, "sum(//metric/cost)"); err != nil || sum != 116 {
+		t.Fatalf("expected the new tree to be queryable but %v, %v", sum, err)
+	}
+	if out.Type != DocumentNode {
+		t.Fatalf("expected a document but %v", out.Type)
+	}
+
+	if out := doc.Transform(func(*Node) *Node { return nil }); out != nil {
+		t.Fatalf("expected nil but %v", out)
+	}
+}
+
+func TestTransformText(t *testing.T) {
+	doc := MustParse(`{"users":[{"name":"joe","password":"s3cret"},{"name":"mark","password":1234}],"password":null}`)
+	var paths []string
+	TransformText(doc, func(path, value string) string {
+		paths = append(paths, path)
+		if strings.HasSuffix(path, "/password") {
+			return "***"
+		}
+		return value
+	})
+	if e, g := `{"password":null,"users":[{"name":"joe","password":"***"},{"name":"mark","password":"***"}]}`, doc.String(); e != g {
+		t.Fatalf("expected %v but %v", e, g)
+	}
+	if e, g := "/users/0/name /users/0/password /users/1/name /users/1/password", strings.Join(paths, " "); e != g {
+		t.Fatalf("expected %v but %v", e, g)
+	}
+}
+
+func TestMerge(t *testing.T) {
+	a := MustParse(`{"name":"joe","tags":["a","b"],"address":{"city":"Oslo","zip":"0150","geo":{"lat":1}},"age":45}`)
+	b := MustParse(`{"tags":["c"],"address":{"zip":"0151","geo":{"lon":2},"street":"Main"},"age":{"years":45},"email":"joe@example.com"}`)
+	sa, sb := a.String(), b.String()
+	m := a.Merge(b)
+	want := `{"address":{"city":"Oslo","geo":{"lat":1,"lon":2},"street":"Main","zip":"0151"},"age":{"years":45},"email":"joe@example.com","name":"joe","tags":["c"]}`
+	if g := m.String(); g != want {
+		t.Fatalf("expected %s but %s", want, g)
+	}
+	if a.String() != sa || b.String() != sb {
+		t.Fatal("Merge modified its operands")
+	}
+	if n := FindOne(m, "address/geo/lon"); n == nil || n.InnerText() != "2" {
+		t.Fatalf("expected the merged tree to be queryable but %v", n)
+	}
+	if g := FindOne(a, "name").Merge(FindOne(b, "email")).String(); g != `"joe@example.com"` {
+		t.Fatalf("expected other to win for scalars but %s", g)
+	}
+}
+
+func TestIntersect(t *testing.T) {
+	data := MustParse(`{"name":"joe","age":45,"ssn":"123","address":{"city":"Oslo"},"tags":["a",{"b":1},2,"c"]}`)
+	template := MustParse(`{"name":true,"address":null,"tags":[{"b":1.0},"c","x"]}`)
+	before := data.String()
+	n, err := data.Intersect(template)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e, g := `{"address":{"city":"Oslo"},"name":"joe","tags":["a",{"b":1},2,"c"]}`, n.String(); e != g {
+		t.Fatalf("expected %v but %v", e, g)
+	}
+	n, err = FindOne(data, "tags").Intersect(FindOne(template, "tags"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e, g := `[{"b":1},"c"]`, n.String(); e != g {
+		t.Fatalf("expected %v but %v", e, g)
+	}
+	if data.String() != before {
+		t.Fatal("Intersect modified its operand")
+	}
+	if _, err := FindOne(data, "name").Intersect(FindOne(template, "name")); err == nil {
+		t.Fatal("expected error for scalars")
+	}
+	if _, err := data.Intersect(FindOne(template, "tags")); err == nil {
+		t.Fatal("expected error for an object and an array")
+	}
+}
+
+func TestSubtract(t *testing.T) {
+	config := MustParse(`{"host":"example.com","port":8080,"debug":true,"paths":["/a","/b",{"c":1}]}`)
+	defaults := MustParse(`{"port":80,"debug":false,"timeout":30,"paths":["/b",{"c":1.0}]}`)
+	before := config.String()
+	n := config.Subtract(defaults)
+	if e, g := `{"host":"example.com"}`, n.String(); e != g {
+		t.Fatalf("expected %v but %v", e, g)
+	}
+	n = FindOne(config, "paths").Subtract(FindOne(defaults, "paths"))
+	if e, g := `["/a"]`, n.String(); e != g {
+		t.Fatalf("expected %v but %v", e, g)
+	}
+	if config.String() != before {
+		t.Fatal("Subtract modified its operand")
+	}
+	if n := FindOne(config, "port").Subtract(FindOne(defaults, "port")); n != nil {
+		t.Fatalf("expected nil for scalars but %v", n)
+	}
+	if n := config.Subtract(FindOne(defaults, "paths")); n != nil {
+		t.Fatalf("expected nil for an object and an array but %v", n)
+	}
+}
+
+func TestCompact(t *testing.T) {
+	doc := MustParse(`{"a":null,"b":{},"c":[],"d":{"e":null,"f":[null,{}]},"g":[1,null,0,"",false],"h":"","i":{"j":0,"k":false},"l":"x"}`)
+	before := doc.String()
+	if e, g := `{"g":[1,0,"",false],"h":"","i":{"j":0,"k":false},"l":"x"}`, doc.Compact().String(); e != g {
+		t.Fatalf("expected %v but %v", e, g)
+	}
+	if e, g := `{"g":[1,0,false],"i":{"j":0,"k":false},"l":"x"}`, doc.CompactWithOptions(CompactOptions{EmptyStrings: true}).String(); e != g {
+		t.Fatalf("expected %v but %v", e, g)
+	}
+	if e, g := `{"g":[1],"l":"x"}`, doc.CompactWithOptions(CompactOptions{EmptyStrings: true, ZeroValues: true}).String(); e != g {
+		t.Fatalf("expected %v but %v", e, g)
+	}
+	if doc.String() != before {
+		t.Fatal("Compact modified the original tree")
+	}
+	if e, g := `{}`, MustParse(`{"a":{"b":[null]}}`).Compact().String(); e != g {
+		t.Fatalf("expected %v but %v", e, g)
+	}
+	if n := FindOne(doc.Compact(), "i/j"); n == nil || n.InnerText() != "0" {
+		t.Fatalf("expected the compacted tree to be queryable but %v", n)
+	}
+}
+
+func TestProject(t *testing.T) {
+	doc, _ := parseString(testConfig)
+	people := Find(doc, "//people/*")
+	got, err := Project(people, map[string]string{
+		"full":  "name",
+		"years": "age",
+		"next":  "age + 1",
+		"email": "email",
+		"top":   "../../inner",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []map[string]interface{}{
+		{"full": "joe", "years": 45.0, "next": 46.0, "email": nil, "top": []interface{}{0.0, 1.0, 2.0, 3.0}},
+		{"full": "mark", "years": 2.0, "next": 3.0, "email": nil, "top": []interface{}{0.0, 1.0, 2.0, 3.0}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %v but %v", want, got)
+	}
+
+	if _, err := Project(people, map[string]string{"bad": "name["}); err == nil {
+		t.Fatal("expected error for an invalid expression")
+	}
+}
@@ -0,0 +1,241 @@
+package jsonquery
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+)
+
+// A ValueOption configures how QueryAllStrings, QueryAllInts and
+// QueryAllFloats convert the matched nodes.
+type ValueOption func(*valueOptions)
+
+type valueOptions struct {
+	skipInvalid bool
+	includeNull bool
+}
+
+// SkipInvalid makes the typed query functions skip the matched nodes
+// that cannot be converted instead of returning an error.
+func SkipInvalid() ValueOption {
+	return func(o *valueOptions) {
+		o.skipInvalid = true
+	}
+}
+
+// IncludeNull makes DistinctValues and DistinctTypedValues report null
+// values, as "null" and nil respectively, instead of skipping them like
+// missing values. Only DistinctTypedValues tells a null from the string
+// "null".
+func IncludeNull() ValueOption {
+	return func(o *valueOptions) {
+		o.includeNull = true
+	}
+}
+
+// QueryAllStrings returns the text of the nodes that match the specified
+// XPath expr. Return an error if the expression `expr` cannot be parsed
+// or, unless SkipInvalid is set, a node is not a string, number or
+// boolean.
+func QueryAllStrings(top *Node, expr string, opts ...ValueOption) ([]string, error) {
+	var a []string
+	err := queryAllValues(top, expr, opts, func(n *Node) error {
+		if !isScalar(n) {
+			return fmt.Errorf("%s is not a scalar", n)
+		}
+		a = append(a, n.InnerText())
+		return nil
+	})
+	return a, err
+}
+
+// QueryAllInts returns the integer values of the nodes that match the
+// specified XPath expr. Numeric strings are converted. Return an error if
+// the expression `expr` cannot be parsed or, unless SkipInvalid is set,
+// a node is not an integer.
+func QueryAllInts(top *Node, expr string, opts ...ValueOption) ([]int, error) {
+	var a []int
+	err := queryAllValues(top, expr, opts, func(n *Node) error {
+		f, err := nodeNumber(n)
+		if err != nil {
+			return err
+		}
+		if f != math.Trunc(f) || float64(int(f)) != f {
+			return fmt.Errorf("%v is not an integer", f)
+		}
+		a = append(a, int(f))
+		return nil
+	})
+	return a, err
+}
+
+// QueryAllFloats returns the numeric values of the nodes that match the
+// specified XPath expr. Numeric strings are converted. Return an error if
+// the expression `expr` cannot be parsed or, unless SkipInvalid is set,
+// a node is not a number.
+func QueryAllFloats(top *Node, expr string, opts ...ValueOption) ([]float64, error) {
+	var a []float64
+	err := queryAllValues(top, expr, opts, func(n *Node) error {
+		f, err := nodeNumber(n)
+		if err != nil {
+			return err
+		}
+		a = append(a, f)
+		return nil
+	})
+	return a, err
+}
+
+// QueryAllInto decodes each node that matches the specified XPath expr
+// into a new element appended to the slice dest points to, as
+// json.Unmarshal does with the JSON encoding of the node, so the JSON
+// types of values are kept and json struct tags are honored.
+// Return an error if the expression `expr` cannot be parsed, dest is not
+// a pointer to a slice or a node cannot be decoded; a decoding error
+// wraps the error of json.Unmarshal, which identifies the field, with the
+// index of the result.
+func QueryAllInto(top *Node, expr string, dest interface{}) error {
+	v := reflect.ValueOf(dest)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Slice {
+		return errors.New("dest must be a non-nil pointer to a slice")
+	}
+	nodes, err := QueryAll(top, expr)
+	if err != nil {
+		return err
+	}
+	s := v.Elem()
+	for i, n := range nodes {
+		b, err := n.ToJSON()
+		if err != nil {
+			return fmt.Errorf("result %d: %w", i, err)
+		}
+		elem := reflect.New(s.Type().Elem())
+		if err := json.Unmarshal(b, elem.Interface()); err != nil {
+			return fmt.Errorf("result %d: %w", i, err)
+		}
+		s = reflect.Append(s, elem.Elem())
+	}
+	v.Elem().Set(s)
+	return nil
+}
+
+// DistinctValues returns the distinct texts of the nodes that match the
+// specified XPath expr, in the order they are first found, without
+// collecting the nodes. Null values are skipped unless IncludeNull is
+// set.
+// Return an error if the expression `expr` cannot be parsed or, unless
+// SkipInvalid is set, a node is not a string, number, boolean or null.
+func DistinctValues(top *Node, expr string, opts ...ValueOption) ([]string, error) {
+	var values []string
+	seen := make(map[string]bool)
+	err := distinctValues(top, expr, opts, func(n *Node, typ ElementType) {
+		s := n.InnerText()
+		if typ == NullNode {
+			s = "null"
+		}
+		if !seen[s] {
+			seen[s] = true
+			values = append(values, s)
+		}
+	})
+	return values, err
+}
+
+// DistinctTypedValues is like DistinctValues but returns the values as
+// string, float64, bool or nil, so that the number 1 and the string "1"
+// are distinct.
+func DistinctTypedValues(top *Node, expr string, opts ...ValueOption) ([]interface{}, error) {
+	type key struct {
+		typ  ElementType
+		text string
+	}
+	var values []interface{}
+	seen := make(map[key]bool)
+	err := distinctValues(top, expr, opts, func(n *Node, typ ElementType) {
+		k := key{typ, n.InnerText()}
+		if seen[k] {
+			return
+		}
+		seen[k] = true
+		var v interface{}
+		switch typ {
+		case StringNode:
+			v = k.text
+		case NumberNode:
+			v, _ = nodeNumber(n)
+		case BooleanNode:
+			v = k.text == "true"
+		}
+		values = append(values, v)
+	})
+	return values, err
+}
+
+// distinctValues calls add with each node that matches expr and is a
+// scalar or, if IncludeNull is set, a null, along with its type.
+func distinctValues(top *Node, expr string, opts []ValueOption, add func(*Node, ElementType)) (err error) {
+	var o valueOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	exp, err := getQuery(expr)
+	if err != nil {
+		return err
+	}
+	t, err := exp.selectVars(top, nil)
+	if err != nil {
+		return err
+	}
+	defer recoverFuncError(&err)
+	for i := 0; t.MoveNext(); i++ {
+		n := t.Current().(*NodeNavigator).node()
+		typ := n.ElType
+		if n.Type == TextNode && n.Parent != nil {
+			typ = n.Parent.ElType
+		}
+		switch {
+		case typ == NullNode:
+			if o.includeNull {
+				add(n, typ)
+			}
+		case isScalar(n):
+			add(n, typ)
+		case !o.skipInvalid:
+			return fmt.Errorf("result %d: %s is not a scalar", i, n)
+		}
+	}
+	return nil
+}
+
+// queryAllValues calls add with each node that matches expr, reporting
+// the index of the node that add fails to convert.
+func queryAllValues(top *Node, expr string, opts []ValueOption, add func(*Node) error) error {
+	var o valueOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	nodes, err := QueryAll(top, expr)
+	if err != nil {
+		return err
+	}
+	for i, n := range nodes {
+		if err := add(n); err != nil && !o.skipInvalid {
+			return fmt.Errorf("result %d: %v", i, err)
+		}
+	}
+	return nil
+}
+
+// isScalar reports whether n is a string, number or boolean.
+func isScalar(n *Node) bool {
+	if n.Type == TextNode {
+		return true
+	}
+	switch n.ElType {
+	case StringNode, NumberNode, BooleanNode:
+		return true
+	}
+	return false
+}
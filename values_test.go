@@ -0,0 +1,147 @@
+package jsonquery
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestQueryAllTyped(t *testing.T) {
+	doc, _ := parseString(testConfig)
+
+	names, err := QueryAllStrings(doc, "//name")
+	if err != nil || !reflect.DeepEqual(names, []string{"joe", "mark"}) {
+		t.Fatalf("expected [joe mark] but %v, %v", names, err)
+	}
+	ages, err := QueryAllInts(doc, "//age")
+	if err != nil || !reflect.DeepEqual(ages, []int{45, 2}) {
+		t.Fatalf("expected [45 2] but %v, %v", ages, err)
+	}
+	floats, err := QueryAllFloats(doc, "//age | //route-instance/*/metric")
+	if err != nil || !reflect.DeepEqual(floats, []float64{45, 2, 24, 89}) {
+		t.Fatalf("expected [45 2 24 89] but %v, %v", floats, err)
+	}
+	if a, err := QueryAllStrings(doc, "//missing"); err != nil || len(a) != 0 {
+		t.Fatalf("expected no strings but %v, %v", a, err)
+	}
+
+	doc = MustParse(`{"people":[{"name":"joe","age":"45"},{"name":{"first":"mark"},"age":2.5},{"name":true,"age":null}]}`)
+	if _, err := QueryAllStrings(doc, "//people/*/name"); err == nil || err.Error() != `result 1: {"first":"mark"} is not a scalar` {
+		t.Fatalf("expected non-scalar error but %v", err)
+	}
+	if a, err := QueryAllStrings(doc, "//people/*/name", SkipInvalid()); err != nil || !reflect.DeepEqual(a, []string{"joe", "true"}) {
+		t.Fatalf("expected [joe true] but %v, %v", a, err)
+	}
+	if _, err := QueryAllInts(doc, "//people/*/age"); err == nil || err.Error() != "result 1: 2.5 is not an integer" {
+		t.Fatalf("expected integer error but %v", err)
+	}
+	if a, err := QueryAllInts(doc, "//people/*/age", SkipInvalid()); err != nil || !reflect.DeepEqual(a, []int{45}) {
+		t.Fatalf("expected [45] but %v, %v", a, err)
+	}
+	if _, err := QueryAllFloats(doc, "//people/*/age"); err == nil || err.Error() != "result 2: null age is not a number" {
+		t.Fatalf("expected number error but %v", err)
+	}
+	if a, err := QueryAllFloats(doc, "//people/*/age", SkipInvalid()); err != nil || !reflect.DeepEqual(a, []float64{45, 2.5}) {
+		t.Fatalf("expected [45 2.5] but %v, %v", a, err)
+	}
+}
+
+func TestQueryAllInto(t *testing.T) {
+	doc, _ := parseString(testConfig)
+	type Person struct {
+		Name string
+		Age  int
+	}
+	var people []Person
+	if err := QueryAllInto(doc, "//people/*", &people); err != nil {
+		t.Fatal(err)
+	}
+	if e := []Person{{"joe", 45}, {"mark", 2}}; !reflect.DeepEqual(people, e) {
+		t.Fatalf("expected %v but %v", e, people)
+	}
+
+	var routes []struct {
+		Metric int `json:"metric"`
+	}
+	if err := QueryAllInto(doc, "//route-instance/*", &routes); err != nil {
+		t.Fatal(err)
+	}
+	if len(routes) != 2 || routes[0].Metric != 24 || routes[1].Metric != 89 {
+		t.Fatalf("expected metrics 24 and 89 but %v", routes)
+	}
+
+	var maps []map[string]interface{}
+	if err := QueryAllInto(doc, "//areas/*[metric = 2]", &maps); err != nil {
+		t.Fatal(err)
+	}
+	if e := []map[string]interface{}{{"area_id": "0.0.0.2", "metric": 2.0}}; !reflect.DeepEqual(maps, e) {
+		t.Fatalf("expected %v but %v", e, maps)
+	}
+
+	var bad []struct {
+		Name int `json:"name"`
+	}
+	err := QueryAllInto(doc, "//people/*", &bad)
+	var typeErr *json.UnmarshalTypeError
+	if !errors.As(err, &typeErr) || typeErr.Field != "name" || !strings.HasPrefix(err.Error(), "result 0: ") {
+		t.Fatalf("expected a decoding error of result 0 field name but %v", err)
+	}
+	if err := QueryAllInto(doc, "//people/*", people); err == nil {
+		t.Fatal("expected error for a non-pointer destination")
+	}
+}
+
+func TestDistinctValues(t *testing.T) {
+	statuses := []string{`"up"`, `"down"`, `"up"`, `null`, `"testing"`, `1`, `"1"`, `true`, `"down"`}
+	var items []string
+	for i := 0; i < 1000; i++ {
+		if i%10 == 9 {
+			// Missing status.
+			items = append(items, `{"id":`+strconv.Itoa(i)+`}`)
+			continue
+		}
+		items = append(items, `{"id":`+strconv.Itoa(i)+`,"status":`+statuses[i%len(statuses)]+`}`)
+	}
+	doc := MustParse(`[` + strings.Join(items, ",") + `]`)
+
+	values, err := DistinctValues(doc, "//status")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e, g := "[up down testing 1 true]", fmt.Sprint(values); e != g {
+		t.Fatalf("expected %v but %v", e, g)
+	}
+	values, err = DistinctValues(doc, "//status", IncludeNull())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e, g := "[up down null testing 1 true]", fmt.Sprint(values); e != g {
+		t.Fatalf("expected %v but %v", e, g)
+	}
+
+	typed, err := DistinctTypedValues(doc, "//status", IncludeNull())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e, g := `[]interface {}{"up", "down", interface {}(nil), "testing", 1, "1", true}`, fmt.Sprintf("%#v", typed); e != g {
+		t.Fatalf("expected %v but %v", e, g)
+	}
+	typed, err = DistinctTypedValues(doc, "//status/text()")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(typed) != 6 {
+		t.Fatalf("expected 6 values but %v", typed)
+	}
+
+	if _, err := DistinctValues(doc, "/*"); err == nil {
+		t.Fatal("expected error for objects")
+	}
+	if values, err := DistinctValues(doc, "/* | //status", SkipInvalid()); err != nil || len(values) != 5 {
+		t.Fatalf("expected 5 values but %v, %v", values, err)
+	}
+}
@@ -0,0 +1,158 @@
+package jsonquery
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// xmlTypes maps the type attribute written by ToXMLEncoder to an ElementType.
+var xmlTypes = map[string]ElementType{
+	"object":  MapNode,
+	"array":   ArrayNode,
+	"string":  StringNode,
+	"number":  NumberNode,
+	"boolean": BooleanNode,
+	"null":    NullNode,
+}
+
+// FromXMLDecoder reads an XML document from d and returns it as a Node
+// tree. Element names become the Data of element nodes. An element with
+// child elements becomes a MapNode, or an ArrayNode if all its children
+// are named `element`; an element without child elements becomes a
+// StringNode holding its text. The type attribute written by
+// ToXMLEncoder overrides this, so that trees round-trip losslessly.
+func FromXMLDecoder(d *xml.Decoder) (*Node, error) {
+	doc := &Node{Type: DocumentNode}
+	var (
+		stack = []*Node{doc}
+		types = []string{""}
+		texts = []string{""}
+	)
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			n := &Node{Type: ElementNode, Data: tok.Name.Local}
+			appendChild(stack[len(stack)-1], n)
+			var typ string
+			for _, attr := range tok.Attr {
+				if attr.Name.Local == "type" {
+					typ = attr.Value
+				}
+			}
+			if t, ok := xmlTypes[typ]; ok {
+				n.ElType = t
+			}
+			stack = append(stack, n)
+			types = append(types, typ)
+			texts = append(texts, "")
+		case xml.CharData:
+			texts[len(texts)-1] += string(tok)
+		case xml.EndElement:
+			n := stack[len(stack)-1]
+			finishXMLNode(n, types[len(types)-1], texts[len(texts)-1])
+			stack = stack[:len(stack)-1]
+			types = types[:len(types)-1]
+			texts = texts[:len(texts)-1]
+		}
+	}
+	if doc.FirstChild != nil {
+		finishXMLNode(doc, "", "")
+	}
+	return doc, nil
+}
+
+// finishXMLNode sets the ElementType of n once all its children are read.
+func finishXMLNode(n *Node, typ, text string) {
+	if _, ok := xmlTypes[typ]; !ok {
+		n.ElType = StringNode
+		if n.FirstChild != nil {
+			n.ElType = ArrayNode
+			for c := n.FirstChild; c != nil; c = c.NextSibling {
+				if c.Data != "element" {
+					n.ElType = MapNode
+					break
+				}
+			}
+		}
+	}
+	switch n.ElType {
+	case ArrayNode:
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			c.Data = ""
+		}
+	case StringNode, NumberNode, BooleanNode:
+		if n.FirstChild == nil {
+			if n.ElType != StringNode {
+				text = strings.TrimSpace(text)
+			}
+			appendChild(n, &Node{Type: TextNode, Data: text})
+		}
+	}
+}
+
+// ToXMLEncoder writes n as XML to e, using the same conventions as
+// FromXMLDecoder. Array items are written as `element` elements, and
+// every element that is not a string carries a type attribute. A
+// DocumentNode is written as a sequence of top-level elements.
+// Return an error if the key of an object member is not a valid XML name,
+// such as "a b" or "1x", since the XML would be malformed.
+func ToXMLEncoder(n *Node, e *xml.Encoder) error {
+	if n.Type == DocumentNode {
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if err := encodeXMLNode(c, e); err != nil {
+				return err
+			}
+		}
+	} else if err := encodeXMLNode(n, e); err != nil {
+		return err
+	}
+	return e.Flush()
+}
+
+func encodeXMLNode(n *Node, e *xml.Encoder) error {
+	if n.Type == TextNode {
+		return e.EncodeToken(xml.CharData(n.Data))
+	}
+	name := n.Data
+	if n.Parent != nil && n.Parent.ElType == ArrayNode {
+		name = "element"
+	}
+	if !isXMLName(name) {
+		return fmt.Errorf("key %q is not a valid XML name", name)
+	}
+	start := xml.StartElement{Name: xml.Name{Local: name}}
+	for typ, t := range xmlTypes {
+		if t == n.ElType && t != StringNode {
+			start.Attr = append(start.Attr, xml.Attr{Name: xml.Name{Local: "type"}, Value: typ})
+		}
+	}
+	if err := e.EncodeToken(start); err != nil {
+		return err
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if err := encodeXMLNode(c, e); err != nil {
+			return err
+		}
+	}
+	return e.EncodeToken(start.End())
+}
+
+// isXMLName reports whether name is a valid XML element name without a
+// namespace prefix.
+func isXMLName(name string) bool {
+	for i, r := range name {
+		if i == 0 && !isNameStart(r) || !isNameChar(r) {
+			return false
+		}
+	}
+	return name != ""
+}
@@ -0,0 +1,77 @@
+package jsonquery
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestXMLRoundTrip(t *testing.T) {
+	doc, err := parseString(testConfig)
+	assert.Nil(t, err)
+
+	var buf bytes.Buffer
+	err = ToXMLEncoder(doc, xml.NewEncoder(&buf))
+	assert.Nil(t, err)
+
+	doc2, err := FromXMLDecoder(xml.NewDecoder(&buf))
+	assert.Nil(t, err)
+
+	exp, _ := json.Marshal(ConvertNodeToInterface(doc))
+	got, _ := json.Marshal(ConvertNodeToInterface(doc2))
+	assert.Equal(t, string(exp), string(got))
+
+	for _, expr := range []string{"//inner", "//inner/*[1]", "//people/*[1]/age", "//areas", "//area_id"} {
+		n1, n2 := FindOne(doc, expr), FindOne(doc2, expr)
+		if n2 == nil {
+			t.Fatalf("%s: no node found", expr)
+		}
+		assert.Equal(t, n1.ElType, n2.ElType, expr)
+		assert.Equal(t, n1.InnerText(), n2.InnerText(), expr)
+	}
+}
+
+func TestFromXMLDecoder(t *testing.T) {
+	s := `<name>John</name>
+<age>30</age>
+<cars>
+	<element>
+		<name>Ford</name>
+		<models>
+			<element>Fiesta</element>
+			<element>Focus</element>
+		</models>
+	</element>
+	<element>
+		<name>BMW</name>
+		<models><element>320</element></models>
+	</element>
+</cars>`
+	doc, err := FromXMLDecoder(xml.NewDecoder(strings.NewReader(s)))
+	assert.Nil(t, err)
+	assert.Equal(t, MapNode, doc.ElType)
+	assert.Equal(t, "John", FindOne(doc, "name").InnerText())
+	assert.Equal(t, StringNode, FindOne(doc, "age").ElType)
+	assert.Equal(t, ArrayNode, FindOne(doc, "cars").ElType)
+	assert.Equal(t, "BMW", FindOne(doc, "cars/*[2]/name").InnerText())
+	assert.Equal(t, 2, len(Find(doc, "cars/*[1]/models/*")))
+
+	_, err = FromXMLDecoder(xml.NewDecoder(strings.NewReader("<a><b></a>")))
+	assert.NotNil(t, err)
+}
+
+func TestToXMLEncoderInvalidNames(t *testing.T) {
+	for _, s := range []string{`{"a b":1}`, `{"1x":2}`, `{"a":{"ns:b":true}}`, `{"":"x"}`, `[{"<a>":null}]`} {
+		var buf bytes.Buffer
+		if err := ToXMLEncoder(MustParse(s), xml.NewEncoder(&buf)); err == nil {
+			t.Fatalf("%s: expected error but %s", s, buf.String())
+		}
+	}
+	var buf bytes.Buffer
+	assert.Nil(t, ToXMLEncoder(MustParse(`{"a-b.c_d":[1],"é":"x"}`), xml.NewEncoder(&buf)))
+	assert.Equal(t, `<a-b.c_d type="array"><element type="number">1</element></a-b.c_d><é>x</é>`, buf.String())
+}